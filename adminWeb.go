@@ -0,0 +1,427 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adminPage is the data shared by the pages of the admin console, the message is shown when an action failed.
+type adminPage struct {
+	Title     string
+	Username  string
+	Message   string
+	TimeZone  string
+	CSRFToken string
+}
+
+// adminBookingActions is the data of the forms acting on a booking, which post back the student or the teacher of the page
+type adminBookingActions struct {
+	CSRFToken       string
+	StudentUsername string
+	TeacherID       int
+	BookingID       int
+}
+
+// adminFuncs are the functions of the templates of the console, besides the ones of timeToDate
+var adminFuncs = template.FuncMap{
+	"bookingActions": func(csrfToken, studentUsername string, teacherID, bookingID int) adminBookingActions {
+		return adminBookingActions{CSRFToken: csrfToken, StudentUsername: studentUsername, TeacherID: teacherID, BookingID: bookingID}
+	},
+}
+
+// adminHandler logs the administrator in (on POST) and opens the console on the teachers.
+// Every page of the console calls the API with the token of the administrator, so it can't do more than the API allows.
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := checkSessionRole(w, r, roleAdmin); err != nil {
+		if r.Method != http.MethodPost {
+			renderAdminLoginPage(w, r, "")
+			return
+		}
+		login, err := loginAPI(r).Login(r.Context(), r.FormValue("username"), r.FormValue("password"), roleAdmin)
+		if err != nil {
+			renderAdminLoginPage(w, r, apiErrorMessage(err, "Invalid username or password"))
+			return
+		}
+		createSession(w, Session{username: login.Username, role: roleAdmin, token: login.Token, tokenExpiry: login.ExpiresAt, timeZone: login.TimeZone})
+	}
+	http.Redirect(w, r, "/admin/teachers", http.StatusSeeOther)
+}
+
+func adminLoginHandler(w http.ResponseWriter, r *http.Request) {
+	renderAdminLoginPage(w, r, "")
+}
+
+// Teachers
+
+func adminTeachersHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleAdmin)
+	if err != nil {
+		renderAdminLoginPage(w, r, "")
+		return
+	}
+	renderAdminTeachersPage(w, r, userSession, "")
+}
+
+// adminAddTeacherHandler adds a teacher, with an account for the teacher portal when a username is given.
+func adminAddTeacherHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleAdmin)
+	if err != nil {
+		renderAdminLoginPage(w, r, "")
+		return
+	}
+	teacher := Teacher{
+		Name:     strings.TrimSpace(r.FormValue("name")),
+		Surname:  strings.TrimSpace(r.FormValue("surname")),
+		Username: strings.TrimSpace(r.FormValue("username")),
+		Password: r.FormValue("password"),
+		TimeZone: r.FormValue("timezone"),
+		Email:    strings.TrimSpace(r.FormValue("email")),
+		Subjects: splitSubjects(r.FormValue("subjects")),
+	}
+	if err := apiFor(userSession).CreateTeacher(r.Context(), teacher); err != nil {
+		renderAdminTeachersPage(w, r, userSession, apiErrorMessage(err, "The teacher couldn't be added"))
+		return
+	}
+	http.Redirect(w, r, "/admin/teachers", http.StatusSeeOther)
+}
+
+func renderAdminTeachersPage(w http.ResponseWriter, r *http.Request, userSession Session, message string) {
+	teachers, err := apiFor(userSession).ListTeachers(r.Context())
+	if err != nil {
+		http.Error(w, "Error fetching teachers from the API", http.StatusInternalServerError)
+		return
+	}
+	renderAdminTemplate(w, "adminTeachers.html", struct {
+		adminPage
+		Teachers []Teacher
+	}{adminPage: newAdminPage("Teachers", userSession, message), Teachers: teachers})
+}
+
+// Students
+
+func adminStudentsHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleAdmin)
+	if err != nil {
+		renderAdminLoginPage(w, r, "")
+		return
+	}
+	renderAdminStudentsPage(w, r, userSession, "")
+}
+
+// adminAddStudentHandler registers a student on their behalf, the date of birth comes as YYYY-MM-DD.
+func adminAddStudentHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleAdmin)
+	if err != nil {
+		renderAdminLoginPage(w, r, "")
+		return
+	}
+	dateOfBirth, err := time.Parse("2006-01-02", r.FormValue("date_of_birth"))
+	if err != nil {
+		renderAdminStudentsPage(w, r, userSession, "Invalid date of birth")
+		return
+	}
+	student := Student{
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Surname:     strings.TrimSpace(r.FormValue("surname")),
+		DateOfBirth: dateOfBirth,
+		Username:    strings.TrimSpace(r.FormValue("username")),
+		Password:    r.FormValue("password"),
+		TimeZone:    r.FormValue("timezone"),
+		Email:       strings.TrimSpace(r.FormValue("email")),
+	}
+	if err := apiFor(userSession).CreateStudent(r.Context(), student); err != nil {
+		renderAdminStudentsPage(w, r, userSession, apiErrorMessage(err, "The student couldn't be added"))
+		return
+	}
+	http.Redirect(w, r, "/admin/students", http.StatusSeeOther)
+}
+
+// adminDeleteStudentHandler deletes a student with their bookings, cancelling their next lessons.
+func adminDeleteStudentHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleAdmin)
+	if err != nil {
+		renderAdminLoginPage(w, r, "")
+		return
+	}
+	//the administrator doesn't need the password of the student
+	if err := apiFor(userSession).DeleteStudent(r.Context(), r.FormValue("student"), ""); err != nil {
+		renderAdminStudentsPage(w, r, userSession, apiErrorMessage(err, "The student couldn't be deleted"))
+		return
+	}
+	http.Redirect(w, r, "/admin/students", http.StatusSeeOther)
+}
+
+func renderAdminStudentsPage(w http.ResponseWriter, r *http.Request, userSession Session, message string) {
+	students, err := apiFor(userSession).ListStudents(r.Context())
+	if err != nil {
+		http.Error(w, "Error fetching students from the API", http.StatusInternalServerError)
+		return
+	}
+	renderAdminTemplate(w, "adminStudents.html", struct {
+		adminPage
+		Students []Student
+	}{adminPage: newAdminPage("Students", userSession, message), Students: students})
+}
+
+// Availabilities
+
+// adminAvailabilitiesHandler shows the availabilities of the teacher chosen with ?teacher=.
+func adminAvailabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleAdmin)
+	if err != nil {
+		renderAdminLoginPage(w, r, "")
+		return
+	}
+	teacherID, _ := strconv.Atoi(r.FormValue("teacher"))
+	renderAdminAvailabilitiesPage(w, r, userSession, teacherID, "")
+}
+
+// adminAddAvailabilityHandler adds an availability to a teacher, the day and the times are in the time zone of the console.
+func adminAddAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleAdmin)
+	if err != nil {
+		renderAdminLoginPage(w, r, "")
+		return
+	}
+	teacherID, _ := strconv.Atoi(r.FormValue("teacher"))
+	loc := loadLocation(userSession.timeZone)
+	startingTime, errStart := time.ParseInLocation("2006-01-02 15:04", r.FormValue("day")+" "+r.FormValue("starting_time"), loc)
+	endingTime, errEnd := time.ParseInLocation("2006-01-02 15:04", r.FormValue("day")+" "+r.FormValue("ending_time"), loc)
+	if errStart != nil || errEnd != nil {
+		renderAdminAvailabilitiesPage(w, r, userSession, teacherID, "Invalid date or time")
+		return
+	}
+	availability := Availability{
+		StartsAt:        startingTime,
+		DurationMinutes: int(endingTime.Sub(startingTime).Minutes()),
+		Subject:         r.FormValue("subject"),
+	}
+	if err := apiFor(userSession).CreateAvailability(r.Context(), teacherID, availability); err != nil {
+		renderAdminAvailabilitiesPage(w, r, userSession, teacherID, apiErrorMessage(err, "The availability couldn't be added"))
+		return
+	}
+	http.Redirect(w, r, "/admin/availabilities?teacher="+strconv.Itoa(teacherID), http.StatusSeeOther)
+}
+
+func adminDeleteAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleAdmin)
+	if err != nil {
+		renderAdminLoginPage(w, r, "")
+		return
+	}
+	teacherID, _ := strconv.Atoi(r.FormValue("teacher"))
+	availabilityID, _ := strconv.Atoi(r.FormValue("availability_id"))
+	if err := apiFor(userSession).DeleteAvailability(r.Context(), teacherID, availabilityID); err != nil {
+		renderAdminAvailabilitiesPage(w, r, userSession, teacherID, apiErrorMessage(err, "The availability couldn't be deleted"))
+		return
+	}
+	http.Redirect(w, r, "/admin/availabilities?teacher="+strconv.Itoa(teacherID), http.StatusSeeOther)
+}
+
+// renderAdminAvailabilitiesPage shows the availabilities of the teacher, none when teacherID is 0.
+func renderAdminAvailabilitiesPage(w http.ResponseWriter, r *http.Request, userSession Session, teacherID int, message string) {
+	client := apiFor(userSession)
+	teachers, err := client.ListTeachers(r.Context())
+	if err != nil {
+		http.Error(w, "Error fetching teachers from the API", http.StatusInternalServerError)
+		return
+	}
+	var availabilities []Availability
+	if teacherID != 0 {
+		availabilities, err = client.TeacherAvailability(r.Context(), teacherID)
+		if err != nil {
+			message = apiErrorMessage(err, "The availabilities couldn't be retrieved")
+		}
+	}
+	renderAdminTemplate(w, "adminAvailabilities.html", struct {
+		adminPage
+		Teachers       []Teacher
+		TeacherID      int
+		Availabilities []Availability
+	}{adminPage: newAdminPage("Availabilities", userSession, message), Teachers: teachers, TeacherID: teacherID, Availabilities: availabilities})
+}
+
+// Bookings
+
+// adminBookingsHandler shows the bookings of the student chosen with ?student= or of the teacher chosen with ?teacher=.
+func adminBookingsHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleAdmin)
+	if err != nil {
+		renderAdminLoginPage(w, r, "")
+		return
+	}
+	renderAdminBookingsPage(w, r, userSession, "")
+}
+
+// adminCancelBookingHandler cancels a booking on behalf of the school, giving the reason if any.
+func adminCancelBookingHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleAdmin)
+	if err != nil {
+		renderAdminLoginPage(w, r, "")
+		return
+	}
+	bookingID, _ := strconv.Atoi(r.FormValue("booking_id"))
+	if err := apiFor(userSession).CancelBooking(r.Context(), bookingID, r.FormValue("reason")); err != nil {
+		renderAdminBookingsPage(w, r, userSession, apiErrorMessage(err, "The booking couldn't be cancelled"))
+		return
+	}
+	http.Redirect(w, r, adminBookingsURL(r), http.StatusSeeOther)
+}
+
+// adminBookingStatusHandler marks a booked lesson as completed or as a no-show.
+func adminBookingStatusHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleAdmin)
+	if err != nil {
+		renderAdminLoginPage(w, r, "")
+		return
+	}
+	bookingID, _ := strconv.Atoi(r.FormValue("booking_id"))
+	if err := apiFor(userSession).UpdateBookingStatus(r.Context(), bookingID, r.FormValue("status")); err != nil {
+		renderAdminBookingsPage(w, r, userSession, apiErrorMessage(err, "The status of the booking couldn't be changed"))
+		return
+	}
+	http.Redirect(w, r, adminBookingsURL(r), http.StatusSeeOther)
+}
+
+// renderAdminBookingsPage shows the bookings of the student or of the teacher of the request, if any.
+func renderAdminBookingsPage(w http.ResponseWriter, r *http.Request, userSession Session, message string) {
+	client := apiFor(userSession)
+	teachers, err := client.ListTeachers(r.Context())
+	if err != nil {
+		http.Error(w, "Error fetching teachers from the API", http.StatusInternalServerError)
+		return
+	}
+	students, err := client.ListStudents(r.Context())
+	if err != nil {
+		http.Error(w, "Error fetching students from the API", http.StatusInternalServerError)
+		return
+	}
+
+	studentUsername := r.FormValue("student")
+	teacherID, _ := strconv.Atoi(r.FormValue("teacher"))
+	var studentBookings []LessonBooked
+	var teacherLessons []TeacherLesson
+	if studentUsername != "" {
+		studentBookings, err = client.StudentBookings(r.Context(), studentUsername)
+	} else if teacherID != 0 {
+		teacherLessons, err = client.TeacherBookings(r.Context(), teacherID)
+	}
+	if err != nil {
+		message = apiErrorMessage(err, "The bookings couldn't be retrieved")
+	}
+	renderAdminTemplate(w, "adminBookings.html", struct {
+		adminPage
+		Teachers        []Teacher
+		Students        []Student
+		StudentUsername string
+		TeacherID       int
+		StudentBookings []LessonBooked
+		TeacherLessons  []TeacherLesson
+	}{adminPage: newAdminPage("Bookings", userSession, message), Teachers: teachers, Students: students, StudentUsername: studentUsername,
+		TeacherID: teacherID, StudentBookings: studentBookings, TeacherLessons: teacherLessons})
+}
+
+// adminBookingsURL returns the bookings page the form was posted from.
+func adminBookingsURL(r *http.Request) string {
+	query := url.Values{}
+	if student := r.FormValue("student"); student != "" {
+		query.Set("student", student)
+	} else if teacher := r.FormValue("teacher"); teacher != "" {
+		query.Set("teacher", teacher)
+	}
+	return "/admin/bookings?" + query.Encode()
+}
+
+// Administrators
+
+func adminAdminsHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleAdmin)
+	if err != nil {
+		renderAdminLoginPage(w, r, "")
+		return
+	}
+	renderAdminAdminsPage(w, r, userSession, "")
+}
+
+// adminAddAdminHandler creates another administrator account.
+func adminAddAdminHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleAdmin)
+	if err != nil {
+		renderAdminLoginPage(w, r, "")
+		return
+	}
+	if r.FormValue("password") != r.FormValue("password_repeat") {
+		renderAdminAdminsPage(w, r, userSession, "Passwords do not match")
+		return
+	}
+	admin := Admin{Username: strings.TrimSpace(r.FormValue("username")), Password: r.FormValue("password")}
+	if err := apiFor(userSession).CreateAdmin(r.Context(), admin); err != nil {
+		renderAdminAdminsPage(w, r, userSession, apiErrorMessage(err, "The administrator couldn't be added"))
+		return
+	}
+	http.Redirect(w, r, "/admin/admins", http.StatusSeeOther)
+}
+
+func renderAdminAdminsPage(w http.ResponseWriter, r *http.Request, userSession Session, message string) {
+	admins, err := apiFor(userSession).ListAdmins(r.Context())
+	if err != nil {
+		http.Error(w, "Error fetching administrators from the API", http.StatusInternalServerError)
+		return
+	}
+	renderAdminTemplate(w, "adminAdmins.html", struct {
+		adminPage
+		Admins []Admin
+	}{adminPage: newAdminPage("Administrators", userSession, message), Admins: admins})
+}
+
+// adminLoginFailuresHandler lists the latest failed logins, only the ones of ?username= when it is given.
+func adminLoginFailuresHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleAdmin)
+	if err != nil {
+		renderAdminLoginPage(w, r, "")
+		return
+	}
+	username := strings.TrimSpace(r.FormValue("username"))
+	failures, err := apiFor(userSession).LoginFailures(r.Context(), username, defaultLoginFailuresLimit)
+	if err != nil {
+		http.Error(w, "Error fetching failed logins from the API", http.StatusInternalServerError)
+		return
+	}
+	renderAdminTemplate(w, "adminLoginFailures.html", struct {
+		adminPage
+		// Filter is the username the failures are filtered by, not to be confused with the one of the administrator
+		Filter   string
+		Failures []LoginFailure
+	}{adminPage: newAdminPage("Failed Logins", userSession, ""), Filter: username, Failures: failures})
+}
+
+// Utils
+
+func newAdminPage(title string, userSession Session, message string) adminPage {
+	return adminPage{Title: title, Username: userSession.username, Message: message, TimeZone: timeZoneOrUTC(userSession.timeZone), CSRFToken: userSession.csrfToken}
+}
+
+// renderAdminTemplate renders a page of the console together with adminLayout.html, which has its header and footer.
+func renderAdminTemplate(w http.ResponseWriter, name string, data any) {
+	t, err := template.New(name).Funcs(timeToDate).Funcs(adminFuncs).ParseFiles(name, "adminLayout.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := t.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func renderAdminLoginPage(w http.ResponseWriter, r *http.Request, errorMessage string) {
+	t, err := template.New("adminLogin.html").Funcs(timeToDate).ParseFiles("adminLogin.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	t.Execute(w, &Page{Title: "Administration", Body: errorMessage, CSRFToken: formCSRFToken(w, r)})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Getters
+
+// getAdmins retrieves the administrator accounts, without their passwords.
+// The administrator of the environment is not listed.
+func (api *apiServer) getAdmins(c *gin.Context) {
+	admins, err := api.store.AllAdmins()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving the administrators"})
+		return
+	}
+	if len(admins) == 0 {
+		c.JSON(http.StatusOK, []Admin{})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, admins)
+}
+
+// defaultLoginFailuresLimit and maxLoginFailuresLimit are how many failed logins are listed without ?limit=
+// and at most
+const (
+	defaultLoginFailuresLimit = 100
+	maxLoginFailuresLimit     = 1000
+)
+
+// getLoginFailures retrieves the refused logins, the latest first: ?username= for the ones of a username,
+// ?limit= for how many.
+func (api *apiServer) getLoginFailures(c *gin.Context) {
+	limit := defaultLoginFailuresLimit
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid limit"})
+			return
+		}
+		limit = min(limit, maxLoginFailuresLimit)
+	}
+
+	failures, err := api.store.LoginFailures(strings.TrimSpace(c.Query("username")), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving the failed logins"})
+		return
+	}
+	if len(failures) == 0 {
+		c.JSON(http.StatusOK, []LoginFailure{})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, failures)
+}
+
+// Creators
+
+// createNewAdmin creates an administrator account, recording the administrator who created it.
+func (api *apiServer) createNewAdmin(c *gin.Context) {
+	var newAdmin Admin
+	if err := c.ShouldBindJSON(&newAdmin); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return
+	}
+	newAdmin.Username = strings.TrimSpace(newAdmin.Username)
+	var v validator
+	v.check("username", validateUsername(newAdmin.Username))
+	v.check("password", validatePassword(newAdmin.Password))
+	if err := v.err(); err != nil {
+		invalidRequest(c, err)
+		return
+	}
+	//the administrator of the environment can't be shadowed by a stored account
+	if newAdmin.Username == api.auth.admin.Username {
+		c.JSON(http.StatusConflict, gin.H{"message": ErrUsernameTaken.Error()})
+		return
+	}
+	newAdmin.CreatedBy = currentPrincipal(c).Username
+	newAdmin.CreatedAt = time.Now()
+
+	err := api.store.InsertAdmin(newAdmin)
+	switch {
+	case errors.Is(err, ErrUsernameTaken):
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	case errors.Is(err, ErrAdminPasswordRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating the administrator"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Administrator created successfully"})
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestCreatingAnAdminNeedsAPasswordAndAFreeUsername(t *testing.T) {
+	testOnStores(t, func(t *testing.T, api *testAPI) {
+		api.expect(api.do(http.MethodPost, "/api/admins", api.admin, Admin{Username: "grace"}), http.StatusUnprocessableEntity)
+		api.expect(api.do(http.MethodPost, "/api/admins", api.admin, Admin{Username: "grace", Password: "passw0rd1"}), http.StatusCreated)
+		api.expect(api.do(http.MethodPost, "/api/admins", api.admin, Admin{Username: "grace", Password: "0therpass"}), http.StatusConflict)
+
+		if err := api.store.InsertAdmin(Admin{Username: "ada"}); !errors.Is(err, ErrAdminPasswordRequired) {
+			t.Errorf("inserting an admin without a password returned %v", err)
+		}
+		if err := api.store.InsertAdmin(Admin{Username: "grace", Password: "other"}); !errors.Is(err, ErrUsernameTaken) {
+			t.Errorf("inserting a taken username returned %v", err)
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"server/apiclient"
+)
+
+// defaultAPIBaseURL is where the web server and the cli find the API unless GOTUTOR_API_URL says otherwise
+const defaultAPIBaseURL = "http://localhost:8080/api"
+
+// defaultAPITimeout is how long a request to the API can take unless GOTUTOR_API_TIMEOUT says otherwise
+const defaultAPITimeout = 10 * time.Second
+
+// newAPIClientFromEnv returns a client of the API at GOTUTOR_API_URL, with the timeout in GOTUTOR_API_TIMEOUT.
+func newAPIClientFromEnv() *apiclient.Client {
+	baseURL := os.Getenv("GOTUTOR_API_URL")
+	if baseURL == "" {
+		baseURL = defaultAPIBaseURL
+	}
+	return apiclient.New(baseURL, durationFromEnv("GOTUTOR_API_TIMEOUT", defaultAPITimeout))
+}
+
+// apiErrorMessage returns what to tell the user about an error of the client: the reason given
+// by the API, or the fallback when the API couldn't be reached.
+func apiErrorMessage(err error, fallback string) string {
+	var apiErr *apiclient.Error
+	if errors.As(err, &apiErr) {
+		return err.Error()
+	}
+	return fallback
+}
@@ -0,0 +1,577 @@
+// Package apiclient calls the API of the tutoring application. The web server and the CLI go through it
+// instead of building the requests themselves.
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/models"
+)
+
+// defaultRetries is how many more times an idempotent call is tried when the API can't be reached or is unavailable
+const defaultRetries = 2
+
+// defaultRetryDelay is the wait before the first retry, growing with each of the next ones
+const defaultRetryDelay = 200 * time.Millisecond
+
+// the errors an error response of the API matches with errors.Is, by its status code
+var (
+	ErrBadRequest      = errors.New("Bad request")
+	ErrUnauthorized    = errors.New("Not logged in")
+	ErrForbidden       = errors.New("Forbidden")
+	ErrNotFound        = errors.New("Not found")
+	ErrConflict        = errors.New("Conflict")
+	ErrInvalid         = errors.New("Invalid request")
+	ErrTooManyRequests = errors.New("Too many requests")
+)
+
+// statusErrors maps the status codes to the errors above
+var statusErrors = map[int]error{
+	http.StatusBadRequest:          ErrBadRequest,
+	http.StatusUnauthorized:        ErrUnauthorized,
+	http.StatusForbidden:           ErrForbidden,
+	http.StatusNotFound:            ErrNotFound,
+	http.StatusConflict:            ErrConflict,
+	http.StatusUnprocessableEntity: ErrInvalid,
+	http.StatusTooManyRequests:     ErrTooManyRequests,
+}
+
+// Error is an error response of the API, with the message it gave. It matches the error of its
+// status code with errors.Is, like ErrNotFound for 404 Not Found.
+type Error struct {
+	StatusCode int
+	Message    string
+	// Fields lists the invalid fields of a request refused with 422 Unprocessable Entity
+	Fields []models.FieldError
+	// body is the whole response, for the calls whose errors carry more than the message
+	body []byte
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is the error of the status code of the response.
+func (e *Error) Is(target error) bool {
+	statusErr, found := statusErrors[e.StatusCode]
+	return found && statusErr == target
+}
+
+// rawBody is a request body sent as it is instead of encoded as JSON
+type rawBody struct {
+	contentType string
+	data        []byte
+}
+
+// notFoundError is a 404 Not Found response about a teacher or a student. It matches the typed error
+// of the record, like *models.ErrTeacherNotFound, with errors.As, and the Error of the response too.
+type notFoundError struct {
+	record   error
+	response *Error
+}
+
+func (e *notFoundError) Error() string {
+	return e.record.Error()
+}
+
+// Unwrap returns the error of the record and the one of the response.
+func (e *notFoundError) Unwrap() []error {
+	return []error{e.record, e.response}
+}
+
+// Client calls the API on behalf of a user.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	// token is the bearer token of the user, empty for the calls that need no login
+	token string
+	// timeZone is the zone the API renders the times in, empty for the preference of the user
+	timeZone string
+	// clientIP is the address of the browser the web server calls on behalf of, sent as X-Forwarded-For
+	clientIP   string
+	retries    int
+	retryDelay time.Duration
+}
+
+// New returns a client of the API at the base URL, like "http://localhost:8080/api",
+// giving up on a request after the timeout.
+func New(baseURL string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+		retries:    defaultRetries,
+		retryDelay: defaultRetryDelay,
+	}
+}
+
+// BaseURL returns the URL of the API the client calls.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// WithToken returns a copy of the client calling the API as the user of the token.
+func (c *Client) WithToken(token string) *Client {
+	client := *c
+	client.token = token
+	return &client
+}
+
+// WithTimeZone returns a copy of the client asking the API for the times in the zone.
+func (c *Client) WithTimeZone(timeZone string) *Client {
+	client := *c
+	client.timeZone = timeZone
+	return &client
+}
+
+// WithClientIP returns a copy of the client telling the API the calls come from the address, so that
+// the logins are limited per browser rather than for the whole web server.
+func (c *Client) WithClientIP(ip string) *Client {
+	client := *c
+	client.clientIP = ip
+	return &client
+}
+
+// Auth
+
+// Login checks the credentials of a user with the role and returns the token issued by the API.
+func (c *Client) Login(ctx context.Context, username, password, role string) (models.LoginResponse, error) {
+	var login models.LoginResponse
+	err := c.do(ctx, http.MethodPost, "/auth/login", models.LoginRequest{Username: username, Password: password, Role: role}, &login)
+	return login, err
+}
+
+// ForgotPassword asks for a password reset link for the student.
+func (c *Client) ForgotPassword(ctx context.Context, username string) error {
+	return c.do(ctx, http.MethodPost, "/auth/forgot-password", models.ForgotPasswordRequest{Username: username}, nil)
+}
+
+// ResetPassword sets the new password of the student of a reset link, given its token.
+func (c *Client) ResetPassword(ctx context.Context, token, password string) error {
+	return c.do(ctx, http.MethodPost, "/auth/reset-password", models.ResetPasswordRequest{Token: token, Password: password}, nil)
+}
+
+// Teachers
+
+// ListTeachers retrieves all the teachers.
+func (c *Client) ListTeachers(ctx context.Context) ([]models.Teacher, error) {
+	var teachers []models.Teacher
+	err := c.do(ctx, http.MethodGet, "/teachers", nil, &teachers)
+	return teachers, err
+}
+
+// SearchTeachers retrieves the teachers matching the search, see models.TeacherSearch.
+func (c *Client) SearchTeachers(ctx context.Context, search models.TeacherSearch) ([]models.Teacher, error) {
+	query := url.Values{}
+	if search.Subject != "" {
+		query.Set("subject", search.Subject)
+	}
+	if search.NamePrefix != "" {
+		query.Set("name", search.NamePrefix)
+	}
+	if !search.FreeFrom.IsZero() {
+		query.Set("from", search.FreeFrom.Format(time.RFC3339))
+	}
+	if !search.FreeTo.IsZero() {
+		query.Set("to", search.FreeTo.Format(time.RFC3339))
+	}
+	var teachers []models.Teacher
+	err := c.do(ctx, http.MethodGet, "/teachers/search?"+query.Encode(), nil, &teachers)
+	return teachers, err
+}
+
+// FindTeacherID retrieves the ID of the teacher with the name and surname.
+func (c *Client) FindTeacherID(ctx context.Context, name, surname string) (int, error) {
+	var found struct {
+		ID int `json:"id"`
+	}
+	err := c.do(ctx, http.MethodGet, "/teachers/"+url.PathEscape(name)+"/"+url.PathEscape(surname), nil, &found)
+	return found.ID, notFound(err, &models.ErrTeacherNotFound{Name: name, Surname: surname})
+}
+
+// CreateTeacher adds a teacher.
+func (c *Client) CreateTeacher(ctx context.Context, teacher models.Teacher) error {
+	return c.do(ctx, http.MethodPost, "/teachers/addteacher", teacher, nil)
+}
+
+// TeacherAvailability retrieves the availabilities of a teacher, booked or not.
+func (c *Client) TeacherAvailability(ctx context.Context, teacherID int) ([]models.Availability, error) {
+	var availabilities []models.Availability
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/teacher/%d/availability", teacherID), nil, &availabilities)
+	return availabilities, notFound(err, &models.ErrTeacherNotFound{TeacherID: teacherID})
+}
+
+// CreateAvailability adds an availability to a teacher.
+func (c *Client) CreateAvailability(ctx context.Context, teacherID int, availability models.Availability) error {
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/teacher/%d/availability", teacherID), availability, nil)
+	return notFound(err, &models.ErrTeacherNotFound{TeacherID: teacherID})
+}
+
+// DeleteAvailability removes an availability of a teacher.
+func (c *Client) DeleteAvailability(ctx context.Context, teacherID, availabilityID int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/teacher/%d/availability/%d", teacherID, availabilityID), nil, nil)
+}
+
+// TeacherBookings retrieves the lessons booked with a teacher.
+func (c *Client) TeacherBookings(ctx context.Context, teacherID int) ([]models.TeacherLesson, error) {
+	var lessons []models.TeacherLesson
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/teacher/%d/bookings", teacherID), nil, &lessons)
+	return lessons, notFound(err, &models.ErrTeacherNotFound{TeacherID: teacherID})
+}
+
+// TeacherDurationPolicies retrieves the lesson durations allowed by a teacher.
+func (c *Client) TeacherDurationPolicies(ctx context.Context, teacherID int) (models.DurationPolicies, error) {
+	var policies models.DurationPolicies
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/teacher/%d/durations", teacherID), nil, &policies)
+	return policies, notFound(err, &models.ErrTeacherNotFound{TeacherID: teacherID})
+}
+
+// TeacherSubjects retrieves the subjects a teacher teaches, none when the teacher teaches any subject.
+func (c *Client) TeacherSubjects(ctx context.Context, teacherID int) ([]string, error) {
+	var found models.TeacherSubjectsRequest
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/teacher/%d/subjects", teacherID), nil, &found)
+	return found.Subjects, notFound(err, &models.ErrTeacherNotFound{TeacherID: teacherID})
+}
+
+// SetTeacherSubjects replaces the subjects a teacher teaches and returns them as saved.
+func (c *Client) SetTeacherSubjects(ctx context.Context, teacherID int, subjects []string) ([]string, error) {
+	if subjects == nil {
+		subjects = []string{}
+	}
+	var saved models.TeacherSubjectsRequest
+	err := c.do(ctx, http.MethodPut, fmt.Sprintf("/teacher/%d/subjects", teacherID), models.TeacherSubjectsRequest{Subjects: subjects}, &saved)
+	return saved.Subjects, notFound(err, &models.ErrTeacherNotFound{TeacherID: teacherID})
+}
+
+// TeacherCalendarFeed retrieves the URL of the calendar feed of a teacher, created on the first call.
+func (c *Client) TeacherCalendarFeed(ctx context.Context, teacherID int) (models.CalendarFeedResponse, error) {
+	var feed models.CalendarFeedResponse
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/teacher/%d/calendar", teacherID), nil, &feed)
+	return feed, notFound(err, &models.ErrTeacherNotFound{TeacherID: teacherID})
+}
+
+// ResetTeacherCalendarFeed gives a teacher a new calendar feed URL, the previous one stops working.
+func (c *Client) ResetTeacherCalendarFeed(ctx context.Context, teacherID int) (models.CalendarFeedResponse, error) {
+	var feed models.CalendarFeedResponse
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/teacher/%d/calendar", teacherID), nil, &feed)
+	return feed, notFound(err, &models.ErrTeacherNotFound{TeacherID: teacherID})
+}
+
+// Subjects
+
+// ListSubjects retrieves all the subjects, by name.
+func (c *Client) ListSubjects(ctx context.Context) ([]models.Subject, error) {
+	var subjects []models.Subject
+	err := c.do(ctx, http.MethodGet, "/subjects", nil, &subjects)
+	return subjects, err
+}
+
+// Students
+
+// CreateStudent registers a student. It needs no login.
+func (c *Client) CreateStudent(ctx context.Context, student models.Student) error {
+	return c.do(ctx, http.MethodPost, "/student/addstudent", student, nil)
+}
+
+// ListStudents retrieves all the students.
+func (c *Client) ListStudents(ctx context.Context) ([]models.Student, error) {
+	var students []models.Student
+	err := c.do(ctx, http.MethodGet, "/student/allstudents", nil, &students)
+	return students, err
+}
+
+// StudentProfile retrieves the profile of a student.
+func (c *Client) StudentProfile(ctx context.Context, username string) (models.Student, error) {
+	var student models.Student
+	err := c.do(ctx, http.MethodGet, "/student/"+url.PathEscape(username)+"/profile", nil, &student)
+	return student, notFound(err, &models.ErrStudentNotFound{StudentID: username})
+}
+
+// UpdateStudentProfile changes the fields of the request in the profile of a student and returns the profile.
+func (c *Client) UpdateStudentProfile(ctx context.Context, username string, request models.StudentProfileRequest) (models.Student, error) {
+	var response struct {
+		Profile models.Student `json:"profile"`
+	}
+	err := c.do(ctx, http.MethodPatch, "/student/"+url.PathEscape(username)+"/profile", request, &response)
+	return response.Profile, notFound(err, &models.ErrStudentNotFound{StudentID: username})
+}
+
+// ChangeStudentPassword replaces the password of a student, checking the current one. The token of the client
+// stops working: the student gets a new one in the response.
+func (c *Client) ChangeStudentPassword(ctx context.Context, username, oldPassword, newPassword string) (models.StudentPasswordResponse, error) {
+	request := models.StudentPasswordRequest{OldPassword: oldPassword, NewPassword: newPassword}
+	var response models.StudentPasswordResponse
+	err := c.do(ctx, http.MethodPut, "/student/"+url.PathEscape(username)+"/password", request, &response)
+	return response, notFound(err, &models.ErrStudentNotFound{StudentID: username})
+}
+
+// DeleteStudent deletes the account of a student, confirmed with their password.
+func (c *Client) DeleteStudent(ctx context.Context, username, password string) error {
+	err := c.do(ctx, http.MethodDelete, "/student/"+url.PathEscape(username), models.DeleteStudentRequest{Password: password}, nil)
+	return notFound(err, &models.ErrStudentNotFound{StudentID: username})
+}
+
+// StudentCalendarFeed retrieves the URL of the calendar feed of a student, created on the first call.
+func (c *Client) StudentCalendarFeed(ctx context.Context, username string) (models.CalendarFeedResponse, error) {
+	var feed models.CalendarFeedResponse
+	err := c.do(ctx, http.MethodGet, "/student/"+url.PathEscape(username)+"/calendar", nil, &feed)
+	return feed, notFound(err, &models.ErrStudentNotFound{StudentID: username})
+}
+
+// ResetStudentCalendarFeed gives a student a new calendar feed URL, the previous one stops working.
+func (c *Client) ResetStudentCalendarFeed(ctx context.Context, username string) (models.CalendarFeedResponse, error) {
+	var feed models.CalendarFeedResponse
+	err := c.do(ctx, http.MethodPost, "/student/"+url.PathEscape(username)+"/calendar", nil, &feed)
+	return feed, notFound(err, &models.ErrStudentNotFound{StudentID: username})
+}
+
+// Bookings
+
+// StudentBookings retrieves the bookings of a student, cancelled ones included.
+func (c *Client) StudentBookings(ctx context.Context, username string) ([]models.LessonBooked, error) {
+	var bookings []models.LessonBooked
+	err := c.do(ctx, http.MethodGet, "/student/"+url.PathEscape(username)+"/bookings", nil, &bookings)
+	return bookings, notFound(err, &models.ErrStudentNotFound{StudentID: username})
+}
+
+// CreateBooking books an availability for the student of the booking.
+func (c *Client) CreateBooking(ctx context.Context, booking models.LessonReservation) error {
+	err := c.do(ctx, http.MethodPost, "/student/"+url.PathEscape(booking.StudentUsername)+"/bookings", booking, nil)
+	return studentOrTeacherNotFound(err, booking.StudentUsername, booking.TeacherID)
+}
+
+// CancelBooking cancels a booking, giving the reason if any.
+func (c *Client) CancelBooking(ctx context.Context, bookingID int, reason string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/bookings/%d", bookingID), models.CancelBookingRequest{Reason: reason}, nil)
+}
+
+// UpdateBookingStatus marks a booked lesson as completed or as a no-show.
+func (c *Client) UpdateBookingStatus(ctx context.Context, bookingID int, status string) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/bookings/%d/status", bookingID), models.BookingStatusRequest{Status: status}, nil)
+}
+
+// Waitlist
+
+// StudentWaitlist retrieves the waitlist entries of a student.
+func (c *Client) StudentWaitlist(ctx context.Context, username string) ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+	err := c.do(ctx, http.MethodGet, "/student/"+url.PathEscape(username)+"/waitlist", nil, &entries)
+	return entries, notFound(err, &models.ErrStudentNotFound{StudentID: username})
+}
+
+// JoinWaitlist puts a student on the waitlist of a teacher.
+func (c *Client) JoinWaitlist(ctx context.Context, username string, request models.WaitlistRequest) (models.WaitlistEntry, error) {
+	var entry models.WaitlistEntry
+	err := c.do(ctx, http.MethodPost, "/student/"+url.PathEscape(username)+"/waitlist", request, &entry)
+	return entry, studentOrTeacherNotFound(err, username, request.TeacherID)
+}
+
+// LeaveWaitlist removes a waiting entry of a student.
+func (c *Client) LeaveWaitlist(ctx context.Context, username string, entryID int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/student/%s/waitlist/%d", url.PathEscape(username), entryID), nil, nil)
+}
+
+// Administrators
+
+// ListAdmins retrieves the administrator accounts.
+func (c *Client) ListAdmins(ctx context.Context) ([]models.Admin, error) {
+	var admins []models.Admin
+	err := c.do(ctx, http.MethodGet, "/admins", nil, &admins)
+	return admins, err
+}
+
+// CreateAdmin adds an administrator account.
+func (c *Client) CreateAdmin(ctx context.Context, admin models.Admin) error {
+	return c.do(ctx, http.MethodPost, "/admins", admin, nil)
+}
+
+// LoginFailures retrieves the latest failed logins, at most limit of them, only the ones of the username
+// unless it is empty.
+func (c *Client) LoginFailures(ctx context.Context, username string, limit int) ([]models.LoginFailure, error) {
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if username != "" {
+		query.Set("username", username)
+	}
+	var failures []models.LoginFailure
+	err := c.do(ctx, http.MethodGet, "/admins/login-failures?"+query.Encode(), nil, &failures)
+	return failures, err
+}
+
+// Imports
+
+// Import sends a csv or jsonl file of teachers, students or availabilities to import. When rows have errors
+// nothing is saved, and the report listing them is returned together with the error.
+func (c *Client) Import(ctx context.Context, kind, format string, data []byte, dryRun bool) (models.ImportReport, error) {
+	contentType := "text/csv"
+	if format == models.ImportFormatJSONL {
+		contentType = "application/x-ndjson"
+	}
+	query := url.Values{"type": {kind}, "format": {format}, "dry_run": {strconv.FormatBool(dryRun)}}
+	var report models.ImportReport
+	err := c.do(ctx, http.MethodPost, "/import?"+query.Encode(), rawBody{contentType: contentType, data: data}, &report)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnprocessableEntity {
+		json.Unmarshal(apiErr.body, &report)
+		//the rows in error are in the report, with their lines
+		apiErr.Fields = nil
+	}
+	return report, err
+}
+
+// Exports
+
+// Export returns all the data of the application, without the passwords.
+func (c *Client) Export(ctx context.Context) (models.DataExport, error) {
+	var export models.DataExport
+	err := c.do(ctx, http.MethodGet, "/export", nil, &export)
+	return export, err
+}
+
+// Utils
+
+// do sends a request to the API, with the body encoded as JSON if any and not a rawBody, and decodes the response
+// into out if any. The error responses are returned as *Error. The idempotent calls are retried
+// when the API can't be reached or is unavailable.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var payload []byte
+	contentType := "application/json"
+	switch body := body.(type) {
+	case nil:
+	case rawBody:
+		payload, contentType = body.data, body.contentType
+	default:
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	attempts := 1
+	if method == http.MethodGet || method == http.MethodPut || method == http.MethodDelete {
+		attempts += c.retries
+	}
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.retryDelay * time.Duration(attempt)):
+			}
+		}
+		var retry bool
+		if retry, err = c.send(ctx, method, path, payload, contentType, out); !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// send makes one attempt of a call and tells whether it is worth another one.
+func (c *Client) send(ctx context.Context, method, path string, payload []byte, contentType string, out any) (bool, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, c.url(path), body)
+	if err != nil {
+		return false, err
+	}
+	if payload != nil {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.clientIP != "" {
+		request.Header.Set("X-Forwarded-For", c.clientIP)
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		//nothing to retry once the caller gave up
+		return ctx.Err() == nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		unavailable := response.StatusCode == http.StatusBadGateway || response.StatusCode == http.StatusServiceUnavailable ||
+			response.StatusCode == http.StatusGatewayTimeout
+		body, _ := io.ReadAll(response.Body)
+		return unavailable, &Error{StatusCode: response.StatusCode, Message: errorResponseMessage(body), Fields: errorResponseFields(body), body: body}
+	}
+	if out == nil {
+		return false, nil
+	}
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("Invalid response from the API: %w", err)
+	}
+	return false, nil
+}
+
+// url returns the URL of the path, asking for the times in the zone of the client if set.
+func (c *Client) url(path string) string {
+	if c.timeZone == "" {
+		return c.baseURL + path
+	}
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return c.baseURL + path + separator + "tz=" + url.QueryEscape(c.timeZone)
+}
+
+// errorResponseMessage returns the message of an error response of the API.
+func errorResponseMessage(body []byte) string {
+	var apiError struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &apiError); err != nil || apiError.Message == "" {
+		return "Some error occurred"
+	}
+	return apiError.Message
+}
+
+// errorResponseFields returns the invalid fields listed by an error response of the API, if any.
+func errorResponseFields(body []byte) []models.FieldError {
+	var apiError struct {
+		Errors []models.FieldError `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &apiError); err != nil {
+		return nil
+	}
+	return apiError.Errors
+}
+
+// notFound returns the typed error of the missing record when the API answered 404 Not Found.
+func notFound(err error, record error) error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return &notFoundError{record: record, response: apiErr}
+	}
+	return err
+}
+
+// studentOrTeacherNotFound returns the typed error of the one missing when a call about a student
+// and a teacher is answered 404 Not Found.
+func studentOrTeacherNotFound(err error, username string, teacherID int) error {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		return err
+	}
+	switch {
+	case apiErr.Message == "Student not found":
+		return &notFoundError{record: &models.ErrStudentNotFound{StudentID: username}, response: apiErr}
+	case strings.HasPrefix(apiErr.Message, "No teachers"):
+		return &notFoundError{record: &models.ErrTeacherNotFound{TeacherID: teacherID}, response: apiErr}
+	}
+	return err
+}
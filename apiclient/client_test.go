@@ -0,0 +1,82 @@
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"server/models"
+)
+
+// newTestClient returns a client of a server answering every request with the status and the body.
+func newTestClient(t *testing.T, status int, body string) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	client := New(server.URL+"/api", time.Second)
+	client.retries = 0
+	return client
+}
+
+func TestErrorsMatchTheirStatusCode(t *testing.T) {
+	for status, want := range statusErrors {
+		client := newTestClient(t, status, `{"message": "Student not found"}`)
+		_, err := client.StudentProfile(context.Background(), "alice")
+		if !errors.Is(err, want) {
+			t.Errorf("status %d: got %v, want %v", status, err, want)
+		}
+		var apiErr *Error
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != status || apiErr.Message != "Student not found" {
+			t.Errorf("status %d: got %#v", status, err)
+		}
+	}
+}
+
+func TestNotFoundIsOnlyThe404(t *testing.T) {
+	client := newTestClient(t, http.StatusInternalServerError, `{"message": "Error retrieving the student"}`)
+	_, err := client.StudentProfile(context.Background(), "alice")
+	var studentErr *models.ErrStudentNotFound
+	if err == nil || errors.Is(err, ErrNotFound) || errors.As(err, &studentErr) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestNotFoundIsTheErrorOfTheRecord(t *testing.T) {
+	client := newTestClient(t, http.StatusNotFound, `{"message": "Teacher not found"}`)
+	_, err := client.FindTeacherID(context.Background(), "Ada", "Lovelace")
+	var teacherErr *models.ErrTeacherNotFound
+	if !errors.As(err, &teacherErr) || teacherErr.Name != "Ada" || teacherErr.Surname != "Lovelace" {
+		t.Fatalf("got %#v", err)
+	}
+	var apiErr *Error
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("got %#v", err)
+	}
+
+	client = newTestClient(t, http.StatusNotFound, `{"message": "Student not found"}`)
+	err = client.CreateBooking(context.Background(), models.LessonReservation{StudentUsername: "alice", TeacherID: 1})
+	var studentErr *models.ErrStudentNotFound
+	if !errors.As(err, &studentErr) || studentErr.StudentID != "alice" || errors.As(err, &teacherErr) {
+		t.Fatalf("got %#v", err)
+	}
+}
+
+func TestInvalidRequestListsTheFields(t *testing.T) {
+	client := newTestClient(t, http.StatusUnprocessableEntity,
+		`{"message": "The request is invalid", "errors": [{"field": "username", "message": "The username is required"}]}`)
+	err := client.CreateAdmin(context.Background(), models.Admin{Password: "passw0rd1"})
+	var apiErr *Error
+	if !errors.Is(err, ErrInvalid) || !errors.As(err, &apiErr) {
+		t.Fatalf("got %v", err)
+	}
+	if len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "username" {
+		t.Fatalf("got fields %+v", apiErr.Fields)
+	}
+}
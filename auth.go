@@ -0,0 +1,398 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	"server/models"
+)
+
+// tokenTTL is how long an API token stays valid
+const tokenTTL = 12 * time.Hour
+
+// maxPasswordLength is the longest password bcrypt can hash, in bytes
+const maxPasswordLength = 72
+
+// minPasswordLength is the shortest new password, in characters
+const minPasswordLength = 8
+
+// defaultPasswordResetTTL is how long a password reset link works unless GOTUTOR_PASSWORD_RESET_TTL says otherwise
+const defaultPasswordResetTTL = time.Hour
+
+// defaultWebURL is the address of the web server the reset links point to unless GOTUTOR_WEB_URL says otherwise
+const defaultWebURL = "http://localhost:5050"
+
+// defaultTrustedProxies are the addresses trusted to forward the address of the client, like the web server,
+// unless GOTUTOR_TRUSTED_PROXIES says otherwise
+var defaultTrustedProxies = []string{"127.0.0.1", "::1"}
+
+// principalKey is the key of the authenticated user in the gin context
+const principalKey = "principal"
+
+// tokenClaims is the content of an API token: who the user is and until when the token is valid.
+// TeacherID is only set for teachers. PasswordSetAt is only set for students: the time, in Unix nanoseconds,
+// their password was set when the token was issued, so that the token stops working once the password
+// changes or the account is deleted, even if the username is registered again.
+type tokenClaims struct {
+	Username      string `json:"sub"`
+	Role          string `json:"role"`
+	TeacherID     int    `json:"tid,omitempty"`
+	PasswordSetAt int64  `json:"pwd,omitempty"`
+	ExpiresAt     int64  `json:"exp"`
+}
+
+// the bodies of the login, shared with the users of the API
+type (
+	loginRequest  = models.LoginRequest
+	loginResponse = models.LoginResponse
+)
+
+// authConfig holds what the API needs to issue and check tokens.
+type authConfig struct {
+	secret []byte
+	// admin is the administrator account, disabled when the password is empty
+	admin Credentials
+	// resetTTL is how long a password reset link works
+	resetTTL time.Duration
+	// webURL is the address of the web server, where the password reset links point to
+	webURL string
+	// logins limits the login attempts
+	logins loginPolicy
+	// trustedProxies are the addresses whose X-Forwarded-For header is trusted as the address of the client
+	trustedProxies []string
+}
+
+// newAuthConfigFromEnv reads the token secret, the administrator account, the settings of the password
+// resets and the login limits from the environment. Without GOTUTOR_TOKEN_SECRET a random secret is used,
+// so tokens don't survive a restart.
+func newAuthConfigFromEnv() *authConfig {
+	secret := []byte(os.Getenv("GOTUTOR_TOKEN_SECRET"))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("GOTUTOR_TOKEN_SECRET is not set: tokens will be invalidated on restart")
+	}
+	webURL := strings.TrimSuffix(os.Getenv("GOTUTOR_WEB_URL"), "/")
+	if webURL == "" {
+		webURL = defaultWebURL
+	}
+	trustedProxies := defaultTrustedProxies
+	if proxies := os.Getenv("GOTUTOR_TRUSTED_PROXIES"); proxies != "" {
+		trustedProxies = strings.Split(proxies, ",")
+	}
+	return &authConfig{
+		secret: secret,
+		admin: Credentials{
+			Username: os.Getenv("GOTUTOR_ADMIN_USERNAME"),
+			Password: os.Getenv("GOTUTOR_ADMIN_PASSWORD"),
+		},
+		resetTTL:       durationFromEnv("GOTUTOR_PASSWORD_RESET_TTL", defaultPasswordResetTTL),
+		webURL:         webURL,
+		logins:         newLoginPolicyFromEnv(),
+		trustedProxies: trustedProxies,
+	}
+}
+
+// signToken encodes the claims and signs them with HMAC-SHA256.
+func (a *authConfig) signToken(claims tokenClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	return encodedPayload + "." + base64.RawURLEncoding.EncodeToString(a.signature(encodedPayload)), nil
+}
+
+// verifyToken checks the signature and the expiry of a token and returns its claims.
+func (a *authConfig) verifyToken(token string) (tokenClaims, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return tokenClaims{}, errors.New("Malformed token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, a.signature(encodedPayload)) {
+		return tokenClaims{}, errors.New("Invalid token signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return tokenClaims{}, errors.New("Malformed token")
+	}
+
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return tokenClaims{}, errors.New("Malformed token")
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return tokenClaims{}, errors.New("Token expired")
+	}
+	return claims, nil
+}
+
+// isAdmin checks the credentials of the administrator account.
+func (a *authConfig) isAdmin(username, password string) bool {
+	if a.admin.Password == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(username), []byte(a.admin.Username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(a.admin.Password)) == 1
+}
+
+func (a *authConfig) signature(encodedPayload string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(encodedPayload))
+	return mac.Sum(nil)
+}
+
+// validatePassword checks a new password before it is hashed: it needs minPasswordLength characters,
+// with at least a letter and a digit. The passwords already saved keep working.
+func validatePassword(password string) error {
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	if len(password) > maxPasswordLength {
+		return ErrPasswordTooLong
+	}
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return ErrPasswordTooShort
+	}
+	if !strings.ContainsFunc(password, unicode.IsLetter) || !strings.ContainsFunc(password, unicode.IsDigit) {
+		return ErrPasswordTooWeak
+	}
+	return nil
+}
+
+// checkPassword checks a password against its bcrypt hash.
+func checkPassword(hashedPassword, password string) bool {
+	return hashedPassword != "" && bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) == nil
+}
+
+// dummyPasswordHash is the hash the passwords of the accounts that don't exist are checked against
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := hashPassword("not the password of any account")
+	if err != nil {
+		log.Fatal(err)
+	}
+	return hash
+})
+
+// checkAccountPassword checks the password of an account looked up with the given error. When the account
+// wasn't found the password is still checked against a dummy hash, so that the time of the answer doesn't
+// tell whether the account exists.
+func checkAccountPassword(hashedPassword string, lookupErr error, password string) bool {
+	if lookupErr != nil || hashedPassword == "" {
+		checkPassword(dummyPasswordHash(), password)
+		return false
+	}
+	return checkPassword(hashedPassword, password)
+}
+
+// Handlers
+
+// login checks the credentials of a student, a teacher or the administrator and issues a token.
+// The answer is the same whether the account exists or not. Too many attempts from the same address, or too
+// many failures of the same account, are refused with 429 Too Many Requests until the Retry-After header,
+// and the refused logins are recorded for the administrators.
+func (api *apiServer) login(c *gin.Context) {
+	var request loginRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return
+	}
+	if request.Role == "" {
+		request.Role = roleStudent
+	}
+	//only the presence of the credentials is checked: the accounts made before the password rules can still log in
+	var v validator
+	if request.Username == "" {
+		v.add("username", "The username is required")
+	}
+	if request.Password == "" {
+		v.add("password", "The password is required")
+	}
+	if request.Role != roleStudent && request.Role != roleTeacher && request.Role != roleAdmin {
+		v.add("role", "Unknown role")
+	}
+	if err := v.err(); err != nil {
+		invalidRequest(c, err)
+		return
+	}
+
+	account := loginAccount{Role: request.Role, Username: request.Username}
+	now := time.Now()
+	if reason, retryAfter, record := api.logins.allow(c.ClientIP(), account, now); reason != "" {
+		if record {
+			api.recordLoginFailure(c, account, reason, now)
+		}
+		tooManyAttempts(c, "Too many login attempts", retryAfter)
+		return
+	}
+
+	claims := tokenClaims{Username: request.Username, Role: request.Role}
+	authenticated := false
+	timeZone := "UTC"
+	switch request.Role {
+	case roleStudent:
+		student, err := api.store.StudentByUsername(request.Username)
+		authenticated = checkAccountPassword(student.Password, err, request.Password)
+		claims.PasswordSetAt = passwordStamp(student.PasswordChangedAt)
+		timeZone = timeZoneOrUTC(student.TimeZone)
+	case roleTeacher:
+		teacher, err := api.store.TeacherByUsername(request.Username)
+		authenticated = checkAccountPassword(teacher.Password, err, request.Password)
+		claims.TeacherID = teacher.ID
+		timeZone = timeZoneOrUTC(teacher.TimeZone)
+	case roleAdmin:
+		//the administrator of the environment, then the accounts it created
+		authenticated = api.auth.isAdmin(request.Username, request.Password)
+		if !authenticated {
+			admin, err := api.store.AdminByUsername(request.Username)
+			authenticated = checkAccountPassword(admin.Password, err, request.Password)
+		}
+	}
+
+	if !authenticated {
+		api.logins.failed(account, now)
+		api.recordLoginFailure(c, account, loginFailureInvalidCredentials, now)
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid username or password"})
+		return
+	}
+	api.logins.succeeded(account)
+
+	token, expiresAt, err := api.auth.issueToken(claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, loginResponse{Token: token, Username: claims.Username, Role: claims.Role, TeacherID: claims.TeacherID, TimeZone: timeZone, ExpiresAt: expiresAt})
+}
+
+// issueToken signs the claims into a token valid for tokenTTL and returns it with its expiry.
+func (a *authConfig) issueToken(claims tokenClaims) (string, time.Time, error) {
+	expiresAt := time.Now().Add(tokenTTL)
+	claims.ExpiresAt = expiresAt.Unix()
+	token, err := a.signToken(claims)
+	return token, expiresAt, err
+}
+
+// passwordStamp returns the stamp of a password set at the time for the tokens, 0 for the accounts
+// created before the times were saved.
+func passwordStamp(changedAt time.Time) int64 {
+	if changedAt.IsZero() {
+		return 0
+	}
+	return changedAt.UnixNano()
+}
+
+// tooManyAttempts answers 429 Too Many Requests, telling when to try again.
+func tooManyAttempts(c *gin.Context, message string, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"message": message + ", try again in " + formatTimeLeft(retryAfter)})
+}
+
+// recordLoginFailure saves a refused login for the administrators. A failure to save it is only logged:
+// the answer to the login stays the same.
+func (api *apiServer) recordLoginFailure(c *gin.Context, account loginAccount, reason string, at time.Time) {
+	failure := LoginFailure{Username: account.Username, Role: account.Role, IP: c.ClientIP(), Reason: reason, AttemptedAt: at}
+	if err := api.store.InsertLoginFailure(failure); err != nil {
+		log.Printf("Error recording the failed login of %s: %v", account.Username, err)
+	}
+}
+
+// Middlewares
+
+// authenticate rejects the requests without a valid bearer token and stores the claims in the context.
+func (api *apiServer) authenticate(c *gin.Context) {
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Missing bearer token"})
+		return
+	}
+	claims, err := api.auth.verifyToken(token)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	if claims.Role == roleStudent {
+		//a token issued before the password changed, or for a deleted account, is revoked
+		student, err := api.store.StudentByUsername(claims.Username)
+		var notFound *ErrStudentNotFound
+		switch {
+		case errors.As(err, &notFound):
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Token revoked"})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Error checking the token"})
+			return
+		case passwordStamp(student.PasswordChangedAt) != claims.PasswordSetAt:
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Token revoked"})
+			return
+		}
+	}
+	c.Set(principalKey, claims)
+	c.Next()
+}
+
+// requireRoles only lets through the users with one of the given roles.
+func requireRoles(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := currentPrincipal(c)
+		for _, role := range roles {
+			if principal.Role == role {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Forbidden"})
+	}
+}
+
+// requireStudentSelf only lets a student access their own resources, identified by the :username parameter.
+// The administrator can access every student.
+func requireStudentSelf(c *gin.Context) {
+	principal := currentPrincipal(c)
+	if principal.Role == roleAdmin || (principal.Role == roleStudent && principal.Username == c.Param("username")) {
+		c.Next()
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Forbidden"})
+}
+
+// requireTeacherSelf only lets a teacher access their own resources, identified by the :id parameter.
+// The administrator can access every teacher.
+func requireTeacherSelf(c *gin.Context) {
+	principal := currentPrincipal(c)
+	if principal.Role == roleAdmin || (principal.Role == roleTeacher && strconv.Itoa(principal.TeacherID) == c.Param("id")) {
+		c.Next()
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Forbidden"})
+}
+
+// currentPrincipal returns the claims of the authenticated user of the request.
+func currentPrincipal(c *gin.Context) tokenClaims {
+	claims, _ := c.Get(principalKey)
+	principal, _ := claims.(tokenClaims)
+	return principal
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTokenOfDeletedAccountIsRevoked(t *testing.T) {
+	testOnStores(t, func(t *testing.T, api *testAPI) {
+		oldToken := api.addStudent("alice")
+		api.expect(api.do(http.MethodDelete, "/api/student/alice", oldToken, deleteStudentRequest{Password: testPassword}), http.StatusOK)
+		api.expect(api.do(http.MethodGet, "/api/student/alice/profile", oldToken, nil), http.StatusUnauthorized)
+
+		//someone else registers the same username
+		newToken := api.addStudent("alice")
+		api.expect(api.do(http.MethodGet, "/api/student/alice/profile", oldToken, nil), http.StatusUnauthorized)
+		api.expect(api.do(http.MethodGet, "/api/student/alice/profile", newToken, nil), http.StatusOK)
+	})
+}
+
+func TestTokenIsRevokedByPasswordChange(t *testing.T) {
+	testOnStores(t, func(t *testing.T, api *testAPI) {
+		oldToken := api.addStudent("alice")
+		request := studentPasswordRequest{OldPassword: testPassword, NewPassword: "new-passw0rd"}
+		response := api.do(http.MethodPut, "/api/student/alice/password", oldToken, request)
+		api.expect(response, http.StatusOK)
+		var changed studentPasswordResponse
+		api.decode(response, &changed)
+
+		api.expect(api.do(http.MethodGet, "/api/student/alice/profile", oldToken, nil), http.StatusUnauthorized)
+		api.expect(api.do(http.MethodGet, "/api/student/alice/profile", changed.Token, nil), http.StatusOK)
+		api.login("alice", "new-passw0rd", roleStudent)
+	})
+}
+
+func TestTokenIsRevokedByPasswordReset(t *testing.T) {
+	testOnStores(t, func(t *testing.T, api *testAPI) {
+		oldToken := api.addStudent("alice")
+		//the link emailed to the student carries the token, only its hash is saved
+		now := time.Now().UTC()
+		reset := PasswordReset{TokenHash: hashPasswordResetToken("reset-token"), StudentUsername: "alice", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+		if err := api.store.InsertPasswordReset(reset); err != nil {
+			t.Fatal(err)
+		}
+		request := resetPasswordRequest{Token: "reset-token", Password: "new-passw0rd"}
+		api.expect(api.do(http.MethodPost, "/api/auth/reset-password", "", request), http.StatusOK)
+
+		api.expect(api.do(http.MethodGet, "/api/student/alice/profile", oldToken, nil), http.StatusUnauthorized)
+		newToken := api.login("alice", "new-passw0rd", roleStudent)
+		api.expect(api.do(http.MethodGet, "/api/student/alice/profile", newToken, nil), http.StatusOK)
+	})
+}
+
+func TestPasswordChecksOfTheAccountAreLimitedLikeTheLogins(t *testing.T) {
+	api := newTestAPIWithLogins(t, loginPolicy{MaxFailures: 2, Lockout: time.Hour})
+	token := api.addStudent("alice")
+	wrong := studentPasswordRequest{OldPassword: "wrong", NewPassword: "new-passw0rd"}
+	api.expect(api.do(http.MethodPut, "/api/student/alice/password", token, wrong), http.StatusForbidden)
+	api.expect(api.do(http.MethodDelete, "/api/student/alice", token, deleteStudentRequest{Password: "wrong"}), http.StatusForbidden)
+
+	//the account is locked, even with the right password
+	response := api.do(http.MethodDelete, "/api/student/alice", token, deleteStudentRequest{Password: testPassword})
+	api.expect(response, http.StatusTooManyRequests)
+	if response.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+	right := studentPasswordRequest{OldPassword: testPassword, NewPassword: "new-passw0rd"}
+	api.expect(api.do(http.MethodPut, "/api/student/alice/password", token, right), http.StatusTooManyRequests)
+	api.expect(api.do(http.MethodPost, "/api/auth/login", "", loginRequest{Username: "alice", Password: testPassword}), http.StatusTooManyRequests)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRuleDays is the longest period a recurrence rule can cover
+const maxRuleDays = 366
+
+var weekdaysByName = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// Getters
+
+// getTeacherAvailabilityRules retrieves the recurrence rules of a teacher.
+func (api *apiServer) getTeacherAvailabilityRules(c *gin.Context) {
+	teacherID, errID := strconv.Atoi(c.Param("id"))
+	if errID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teacher ID"})
+		return
+	}
+	rules, err := api.store.TeacherAvailabilityRules(teacherID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No teachers associated with ID %d", teacherID)})
+		return
+	}
+	if len(rules) == 0 {
+		c.JSON(http.StatusOK, []AvailabilityRule{})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, rules)
+}
+
+// previewTeacherAvailabilityRule expands a rule without saving it, showing the availabilities
+// it would create and the ones overlapping existing availabilities.
+func (api *apiServer) previewTeacherAvailabilityRule(c *gin.Context) {
+	rule, ok := api.bindAvailabilityRule(c)
+	if !ok {
+		return
+	}
+
+	slots, err := expandAvailabilityRule(rule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	existing, err := api.store.TeacherAvailabilities(rule.TeacherID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving the availabilities"})
+		return
+	}
+
+	expansion := AvailabilityRuleExpansion{Rule: rule, Slots: []Availability{}, Conflicts: []Availability{}}
+	for _, slot := range slots {
+		if isOverlappingAny(slot, existing) {
+			expansion.Conflicts = append(expansion.Conflicts, slot)
+		} else {
+			expansion.Slots = append(expansion.Slots, slot)
+		}
+	}
+	loc := api.viewerLocation(c)
+	availabilitiesIn(expansion.Slots, loc)
+	availabilitiesIn(expansion.Conflicts, loc)
+	c.IndentedJSON(http.StatusOK, expansion)
+}
+
+// Creators
+
+// createTeacherAvailabilityRule saves a recurrence rule and creates its availabilities.
+// The availabilities overlapping existing ones are skipped and reported as conflicts.
+func (api *apiServer) createTeacherAvailabilityRule(c *gin.Context) {
+	rule, ok := api.bindAvailabilityRule(c)
+	if !ok {
+		return
+	}
+
+	expansion, err := api.store.InsertAvailabilityRule(rule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	loc := api.viewerLocation(c)
+	availabilitiesIn(expansion.Slots, loc)
+	availabilitiesIn(expansion.Conflicts, loc)
+	c.IndentedJSON(http.StatusCreated, expansion)
+}
+
+// Deleters
+
+// cancelTeacherAvailabilityRule cancels a recurrence rule and deletes its future availabilities
+// that haven't been booked. Booked lessons are kept.
+func (api *apiServer) cancelTeacherAvailabilityRule(c *gin.Context) {
+	teacherID, errID := strconv.Atoi(c.Param("id"))
+	ruleID, errRuleID := strconv.Atoi(c.Param("ruleID"))
+	if errID != nil || errRuleID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid ID"})
+		return
+	}
+
+	deleted, err := api.store.CancelAvailabilityRule(teacherID, ruleID, time.Now())
+	if err == ErrAvailabilityRuleNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error cancelling the rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Rule cancelled successfully", "deleted_slots": deleted})
+}
+
+// Utils
+
+// bindAvailabilityRule decodes and validates the rule in the request body.
+// It writes the error response and returns false when the rule can't be used.
+func (api *apiServer) bindAvailabilityRule(c *gin.Context) (AvailabilityRule, bool) {
+	teacherID, errID := strconv.Atoi(c.Param("id"))
+	if errID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teacher ID"})
+		return AvailabilityRule{}, false
+	}
+	isPresent, _ := api.store.TeacherExists(teacherID)
+	if !isPresent {
+		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No teachers associated with ID %d", teacherID)})
+		return AvailabilityRule{}, false
+	}
+
+	var rule AvailabilityRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return AvailabilityRule{}, false
+	}
+	rule.ID = 0
+	rule.TeacherID = teacherID
+	rule.Cancelled = false
+	rule.Subject = normalizeSubject(rule.Subject)
+	if rule.DurationMinutes == 0 {
+		rule.DurationMinutes = 60
+	}
+	//the times of the rule are in the zone of the teacher unless another one is given
+	if rule.TimeZone == "" {
+		rule.TimeZone = api.teacherLocation(teacherID).String()
+	}
+	for i, weekday := range rule.Weekdays {
+		rule.Weekdays[i] = strings.ToLower(strings.TrimSpace(weekday))
+	}
+
+	var v validator
+	v.check("", validateAvailabilityRule(rule))
+	if rule.Subject != "" {
+		v.check("subject", api.validateTeacherSubject(teacherID, rule.Subject))
+	}
+	if err := v.err(); err != nil {
+		invalidRequest(c, err)
+		return AvailabilityRule{}, false
+	}
+
+	//every availability of the rule needs to follow the duration policy of the teacher
+	policy, err := api.durationPolicyFor(teacherID, rule.Subject)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving the lesson durations"})
+		return AvailabilityRule{}, false
+	}
+	startingTime, _ := time.Parse("15:04", rule.StartingTime)
+	endingTime, _ := time.Parse("15:04", rule.EndingTime)
+	lesson := time.Duration(rule.DurationMinutes) * time.Minute
+	for start := startingTime; start.Add(lesson).Compare(endingTime) <= 0; start = start.Add(lesson) {
+		if err := checkDuration(policy, start, start.Add(lesson)); err != nil {
+			invalidRequest(c, invalidField("duration_minutes", err))
+			return AvailabilityRule{}, false
+		}
+	}
+	return rule, true
+}
+
+// validateAvailabilityRule checks the weekdays, the times and the period of a rule.
+func validateAvailabilityRule(rule AvailabilityRule) error {
+	var v validator
+	if len(rule.Weekdays) == 0 {
+		v.add("weekdays", "At least one weekday is required")
+	}
+	for _, weekday := range rule.Weekdays {
+		if _, ok := weekdaysByName[strings.ToLower(weekday)]; !ok {
+			v.add("weekdays", fmt.Sprintf("Unknown weekday %s", weekday))
+		}
+	}
+
+	startingTime, errStart := time.Parse("15:04", rule.StartingTime)
+	endingTime, errEnd := time.Parse("15:04", rule.EndingTime)
+	if errStart != nil {
+		v.add("starting_time", "The starting time need to be in the HH:MM format")
+	}
+	if errEnd != nil {
+		v.add("ending_time", "The ending time need to be in the HH:MM format")
+	}
+	if err := validateTimeZone(rule.TimeZone); err != nil {
+		v.add("time_zone", fmt.Sprintf("Unknown time zone %q", rule.TimeZone))
+	}
+	if rule.DurationMinutes <= 0 {
+		v.add("duration_minutes", "The duration of the lessons need to be positive")
+	} else if errStart == nil && errEnd == nil {
+		duration, lesson := endingTime.Sub(startingTime), time.Duration(rule.DurationMinutes)*time.Minute
+		if duration < lesson || duration%lesson != 0 {
+			v.add("ending_time", fmt.Sprintf("The time range of the rule need to be a whole number of %d minutes lessons", rule.DurationMinutes))
+		}
+	}
+
+	if rule.StartDate.IsZero() {
+		v.add("start_date", "The start date is required")
+	}
+	if rule.EndDate.IsZero() {
+		v.add("end_date", "The end date is required")
+	}
+	if !rule.StartDate.IsZero() && !rule.EndDate.IsZero() {
+		startDate, endDate := dateOnly(rule.StartDate), dateOnly(rule.EndDate)
+		if endDate.Before(startDate) {
+			v.add("end_date", "The end date can't be before the start date")
+		} else if endDate.Sub(startDate) > maxRuleDays*24*time.Hour {
+			v.add("end_date", fmt.Sprintf("A rule can't cover more than %d days", maxRuleDays))
+		}
+	}
+	return v.err()
+}
+
+// expandAvailabilityRule generates the availabilities of a rule, in chronological order.
+// The times of the rule are wall-clock times in its zone, so a lesson at 15:00 stays at 15:00
+// when daylight saving time starts or ends. The slots already started are skipped, like a single
+// availability can't start in the past.
+func expandAvailabilityRule(rule AvailabilityRule) ([]Availability, error) {
+	if err := validateAvailabilityRule(rule); err != nil {
+		return nil, err
+	}
+
+	weekdays := map[time.Weekday]bool{}
+	for _, weekday := range rule.Weekdays {
+		weekdays[weekdaysByName[strings.ToLower(weekday)]] = true
+	}
+	excepted := map[time.Time]bool{}
+	for _, date := range rule.ExceptDates {
+		excepted[dateOnly(date)] = true
+	}
+	loc := loadLocation(rule.TimeZone)
+	startingTime, _ := time.Parse("15:04", rule.StartingTime)
+	endingTime, _ := time.Parse("15:04", rule.EndingTime)
+	startMinute := startingTime.Hour()*60 + startingTime.Minute()
+	endMinute := endingTime.Hour()*60 + endingTime.Minute()
+
+	now := time.Now()
+	var slots []Availability
+	for day := dateOnly(rule.StartDate); !day.After(dateOnly(rule.EndDate)); day = day.AddDate(0, 0, 1) {
+		if !weekdays[day.Weekday()] || excepted[day] {
+			continue
+		}
+		for minute := startMinute; minute+rule.DurationMinutes <= endMinute; minute += rule.DurationMinutes {
+			startsAt := time.Date(day.Year(), day.Month(), day.Day(), 0, minute, 0, 0, loc).UTC()
+			if startsAt.Before(now) {
+				continue
+			}
+			slots = append(slots, Availability{
+				StartsAt:        startsAt,
+				DurationMinutes: rule.DurationMinutes,
+				Booked:          false,
+				RuleID:          rule.ID,
+				Subject:         rule.Subject,
+			})
+		}
+	}
+	return slots, nil
+}
+
+// isOverlappingAny checks if the availability overlaps any of the others.
+func isOverlappingAny(availability Availability, others []Availability) bool {
+	for _, other := range others {
+		if isOverlapping(other.StartsAt, other.EndsAt(), availability.StartsAt, availability.EndsAt()) {
+			return true
+		}
+	}
+	return false
+}
+
+// dateOnly returns the date of t at midnight UTC, as the dates of the rules are stored.
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
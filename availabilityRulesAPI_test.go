@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAvailabilityRuleSkipsThePastSlots(t *testing.T) {
+	api := newTestAPI(t)
+	teacherID := api.addTeacher("Lovelace")
+	//every day from a week ago to a week from now
+	rule := AvailabilityRule{
+		Weekdays:     []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"},
+		StartingTime: "10:00",
+		EndingTime:   "11:00",
+		StartDate:    nextHour(-7),
+		EndDate:      nextHour(7),
+	}
+
+	for _, path := range []string{"/api/teacher/%d/rules/preview", "/api/teacher/%d/rules"} {
+		response := api.do(http.MethodPost, fmt.Sprintf(path, teacherID), api.admin, rule)
+		if response.Code != http.StatusOK && response.Code != http.StatusCreated {
+			t.Fatalf("%s got status %d: %s", path, response.Code, response.Body.String())
+		}
+		var expansion AvailabilityRuleExpansion
+		api.decode(response, &expansion)
+		if len(expansion.Slots) < 7 || len(expansion.Slots) > 8 {
+			t.Errorf("%s got %d slots, want the 7 or 8 still to come", path, len(expansion.Slots))
+		}
+		for _, slot := range expansion.Slots {
+			if slot.StartsAt.Before(time.Now()) {
+				t.Errorf("%s got the past slot %s", path, slot.StartsAt)
+			}
+		}
+	}
+}
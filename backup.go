@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// backupPagesPerStep is the number of pages copied at a time by a backup, the writers of the API
+// can take the database between two steps
+const backupPagesPerStep = 100
+
+// backupStepDelay is the pause between two steps of a backup
+const backupStepDelay = 10 * time.Millisecond
+
+// backupCommand runs the "-m backup <file>" mode: it copies the database into a new file,
+// without stopping the API.
+func backupCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: server.exe -m backup <file>")
+		os.Exit(2)
+	}
+	path := args[0]
+	if _, err := os.Stat(databasePath); err != nil {
+		log.Fatalf("There is no database to back up: %v", err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		log.Fatalf("The file %s already exists", path)
+	}
+
+	src, err := openDatabase(databasePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer src.Close()
+	dest, err := openDatabase(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer dest.Close()
+
+	if err := backupDatabase(dest, src); err != nil {
+		dest.Close()
+		os.Remove(path)
+		log.Fatal(err)
+	}
+	version, err := getSchemaVersion(dest)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Database backed up to %s, schema version %d\n", path, version)
+}
+
+// restoreCommand runs the "-m restore <file>" mode: it checks the backup and replaces the database with it.
+// A backup of an older version is then migrated up.
+func restoreCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: server.exe -m restore <file>")
+		os.Exit(2)
+	}
+
+	backup, version, err := openBackup(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer backup.Close()
+	db, err := openDatabase(databasePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := backupDatabase(db, backup); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Database restored from %s, schema version %d\n", args[0], version)
+
+	run, err := migrateUp(db)
+	for _, m := range run {
+		fmt.Printf("Applied migration %d: %s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// openBackup opens a backup read-only and checks it before it is restored: it needs to be an intact
+// database of this application, at a schema version this version of the code knows.
+func openBackup(path string) (*sql.DB, int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, 0, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	version, err := checkBackup(db, path)
+	if err != nil {
+		db.Close()
+		return nil, 0, err
+	}
+	return db, version, nil
+}
+
+// checkBackup checks the integrity and the schema version of a backup, and returns the version.
+func checkBackup(db *sql.DB, path string) (int, error) {
+	var integrity string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&integrity); err != nil {
+		return 0, fmt.Errorf("%s is not a valid database: %w", path, err)
+	}
+	if integrity != "ok" {
+		return 0, fmt.Errorf("%s is corrupted: %s", path, integrity)
+	}
+
+	var versioned bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')").Scan(&versioned)
+	if err != nil {
+		return 0, err
+	}
+	var version int
+	if versioned {
+		if err := db.QueryRow("SELECT COALESCE(MAX(Version), 0) FROM schema_migrations").Scan(&version); err != nil {
+			return 0, err
+		}
+	}
+	if version == 0 {
+		return 0, fmt.Errorf("%s has no schema version, it is not a backup of the database", path)
+	}
+	// the migrations of a newer version are unknown here, so they can't be checked nor reverted
+	if version > latestSchemaVersion() {
+		return 0, fmt.Errorf("%s is at schema version %d, newer than the version %d of this server", path, version, latestSchemaVersion())
+	}
+	return version, nil
+}
+
+// backupDatabase copies the src database over dest with the online backup API of SQLite.
+// When src is written between two steps the copy starts over, so dest is always a consistent snapshot.
+func backupDatabase(dest, src *sql.DB) error {
+	ctx := context.Background()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			backup, err := destDriverConn.(*sqlite3.SQLiteConn).Backup("main", srcDriverConn.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := backup.Step(backupPagesPerStep)
+				if err != nil {
+					backup.Finish()
+					return err
+				}
+				if done {
+					return backup.Finish()
+				}
+				time.Sleep(backupStepDelay)
+			}
+		})
+	})
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"server/models"
+)
+
+// defaultStudentCancellationCutoff is how long before the lesson the students can no longer cancel it
+const defaultStudentCancellationCutoff = 24 * time.Hour
+
+// maxCancellationReasonLength is the longest reason, in characters, that can be given for a cancellation
+const maxCancellationReasonLength = 500
+
+// cancellationPolicy decides until when the bookings can be cancelled.
+// No one can cancel a lesson that has already started.
+type cancellationPolicy struct {
+	// StudentCutoff is how long before the start of the lesson the students can no longer cancel it
+	StudentCutoff time.Duration
+	// TeacherCutoff is the same for the teachers
+	TeacherCutoff time.Duration
+}
+
+// the bodies of the booking changes, shared with the users of the API
+type (
+	cancelBookingRequest = models.CancelBookingRequest
+	bookingStatusRequest = models.BookingStatusRequest
+)
+
+// newCancellationPolicyFromEnv reads the cutoffs from GOTUTOR_STUDENT_CANCELLATION_CUTOFF and
+// GOTUTOR_TEACHER_CANCELLATION_CUTOFF, given as durations like "24h" or "90m".
+// Students can cancel up to 24 hours before the lesson and teachers until it starts unless set otherwise.
+func newCancellationPolicyFromEnv() cancellationPolicy {
+	return cancellationPolicy{
+		StudentCutoff: durationFromEnv("GOTUTOR_STUDENT_CANCELLATION_CUTOFF", defaultStudentCancellationCutoff),
+		TeacherCutoff: durationFromEnv("GOTUTOR_TEACHER_CANCELLATION_CUTOFF", 0),
+	}
+}
+
+// Deleters
+
+// cancelBooking cancels a booking following the cancellation policy. The student who made the booking
+// and its teacher can cancel it until their cutoff, the administrator until the lesson starts.
+// The booking is kept with the cancelled status, who cancelled it and why, and its availability is freed.
+func (api *apiServer) cancelBooking(c *gin.Context) {
+	id := c.Param("id")
+	booking, err := api.store.BookingByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Booking not found"})
+		return
+	}
+
+	//the status records whether the student or the teacher cancelled the lesson:
+	//the administrator cancels on behalf of the school, as a teacher would
+	principal := currentPrincipal(c)
+	var status string
+	var cutoff time.Duration
+	switch {
+	case principal.Role == roleStudent && principal.Username == booking.StudentUsername:
+		status, cutoff = bookingCancelledByStudent, api.cancellation.StudentCutoff
+	case principal.Role == roleTeacher && principal.TeacherID == booking.TeacherID:
+		status, cutoff = bookingCancelledByTeacher, api.cancellation.TeacherCutoff
+	case principal.Role == roleAdmin:
+		status = bookingCancelledByTeacher
+	default:
+		c.JSON(http.StatusForbidden, gin.H{"message": "Forbidden"})
+		return
+	}
+
+	//the reason is optional, and so is the whole body
+	var request cancelBookingRequest
+	if err := c.ShouldBindJSON(&request); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return
+	}
+	request.Reason = strings.TrimSpace(request.Reason)
+	if len(request.Reason) > maxCancellationReasonLength {
+		invalidRequest(c, invalidField("reason", fmt.Errorf("The reason can't be longer than %d characters", maxCancellationReasonLength)))
+		return
+	}
+
+	if booking.Status != bookingBooked {
+		c.JSON(http.StatusConflict, gin.H{"message": ErrBookingClosed.Error()})
+		return
+	}
+	now := time.Now()
+	if !booking.StartsAt.After(now) {
+		c.JSON(http.StatusConflict, gin.H{"message": "The lesson has already started"})
+		return
+	}
+	if booking.StartsAt.Sub(now) < cutoff {
+		c.JSON(http.StatusForbidden, gin.H{"message": fmt.Sprintf("Lessons can't be cancelled less than %s before they start", formatCutoff(cutoff))})
+		return
+	}
+
+	err = api.store.CancelBooking(id, status, BookingCancellation{CancelledBy: principal.Username, CancellationReason: request.Reason, CancelledAt: &now})
+	if err == ErrBookingClosed {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error cancelling the booking"})
+		return
+	}
+	go api.notifyBooking(emailBookingCancelled, booking.ID)
+
+	//the freed availability goes to the first student of the waitlist who can take it
+	entry, err := api.store.AssignFreedAvailability(booking.AvailabilityID)
+	if err != nil {
+		log.Printf("Error assigning availability %d to the waitlist: %v", booking.AvailabilityID, err)
+	} else if entry != nil {
+		go api.notifyBooking(emailBookingConfirmed, entry.BookingID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Booking cancelled successfully", "status": status})
+}
+
+// Updaters
+
+// updateBookingStatus lets the teacher of a lesson, or the administrator, mark it as completed
+// or as a no-show once it has started.
+func (api *apiServer) updateBookingStatus(c *gin.Context) {
+	id := c.Param("id")
+	booking, err := api.store.BookingByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Booking not found"})
+		return
+	}
+	principal := currentPrincipal(c)
+	if principal.Role != roleAdmin && !(principal.Role == roleTeacher && principal.TeacherID == booking.TeacherID) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Forbidden"})
+		return
+	}
+
+	var request bookingStatusRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return
+	}
+	if request.Status != bookingCompleted && request.Status != bookingNoShow {
+		invalidRequest(c, invalidField("status", fmt.Errorf("The status need to be %s or %s", bookingCompleted, bookingNoShow)))
+		return
+	}
+	if booking.StartsAt.After(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"message": "The lesson hasn't started yet"})
+		return
+	}
+
+	err = api.store.UpdateBookingStatus(id, request.Status)
+	if err == ErrBookingClosed {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating the booking"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Booking updated successfully", "status": request.Status})
+}
+
+// Utils
+
+// isCancelled checks if the status is one of the cancelled ones.
+func isCancelled(status string) bool {
+	return status == bookingCancelledByStudent || status == bookingCancelledByTeacher
+}
+
+// formatCutoff writes a cutoff as "24 hours" or "90 minutes".
+func formatCutoff(cutoff time.Duration) string {
+	if cutoff%time.Hour == 0 {
+		return fmt.Sprintf("%d hours", int(cutoff.Hours()))
+	}
+	return fmt.Sprintf("%d minutes", int(cutoff.Minutes()))
+}
+
+// durationFromEnv reads a duration from the environment, returning the default when the variable is not set.
+func durationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		log.Fatalf("Invalid %s %q: use a duration like 24h or 90m", name, value)
+	}
+	return duration
+}
+
+// intFromEnv reads a number from the environment, returning the default when the variable is not set.
+func intFromEnv(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		log.Fatalf("Invalid %s %q: use a whole number like 5", name, value)
+	}
+	return number
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"server/models"
+)
+
+// calendarFeedResponse is returned by the calendar endpoints of the students and the teachers, shared with the users of the API
+type calendarFeedResponse = models.CalendarFeedResponse
+
+// icsEvent is an event of an iCalendar feed. The UID identifies the event across the updates of the feed,
+// so that the calendar apps change or cancel the event they already have instead of adding a new one.
+type icsEvent struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	// Status is CONFIRMED, TENTATIVE or CANCELLED
+	Status   string
+	Sequence int
+	// Free events don't make the owner of the calendar busy
+	Free bool
+}
+
+// Getters
+
+// getStudentCalendarFeed returns the URL of the calendar feed of a student, created on the first call.
+func (api *apiServer) getStudentCalendarFeed(c *gin.Context) {
+	api.calendarFeed(c, CalendarFeed{StudentUsername: c.Param("username")}, false)
+}
+
+// getTeacherCalendarFeed returns the URL of the calendar feed of a teacher, created on the first call.
+func (api *apiServer) getTeacherCalendarFeed(c *gin.Context) {
+	teacherID, errID := strconv.Atoi(c.Param("id"))
+	if errID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teacher ID"})
+		return
+	}
+	api.calendarFeed(c, CalendarFeed{TeacherID: teacherID}, false)
+}
+
+// getCalendar serves the iCalendar file of the feed whose token is in the URL, like /api/calendar/<token>.ics.
+// Calendar apps can't log in, so the token is the only credential.
+func (api *apiServer) getCalendar(c *gin.Context) {
+	token, isICS := strings.CutSuffix(c.Param("file"), ".ics")
+	if !isICS || token == "" {
+		c.JSON(http.StatusNotFound, gin.H{"message": ErrCalendarFeedNotFound.Error()})
+		return
+	}
+	feed, err := api.store.CalendarFeedByToken(token)
+	if err == ErrCalendarFeedNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reading the calendar"})
+		return
+	}
+
+	var name string
+	var events []icsEvent
+	if feed.TeacherID != 0 {
+		name, events, err = api.teacherCalendar(feed.TeacherID)
+	} else {
+		name, events, err = api.studentCalendar(feed.StudentUsername)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reading the calendar"})
+		return
+	}
+
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", `inline; filename="gotutor.ics"`)
+	c.Status(http.StatusOK)
+	writeICS(c.Writer, name, events, time.Now())
+}
+
+// Creators
+
+// resetStudentCalendarFeed gives the student a new calendar feed URL, the previous one stops working.
+func (api *apiServer) resetStudentCalendarFeed(c *gin.Context) {
+	api.calendarFeed(c, CalendarFeed{StudentUsername: c.Param("username")}, true)
+}
+
+// resetTeacherCalendarFeed gives the teacher a new calendar feed URL, the previous one stops working.
+func (api *apiServer) resetTeacherCalendarFeed(c *gin.Context) {
+	teacherID, errID := strconv.Atoi(c.Param("id"))
+	if errID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teacher ID"})
+		return
+	}
+	api.calendarFeed(c, CalendarFeed{TeacherID: teacherID}, true)
+}
+
+// Utils
+
+// calendarFeed responds with the calendar feed of the owner of the feed, a new one with reset.
+func (api *apiServer) calendarFeed(c *gin.Context, feed CalendarFeed, reset bool) {
+	feed.Token = newCalendarFeedToken()
+	feed.CreatedAt = time.Now().UTC()
+
+	var err error
+	if reset {
+		err = api.store.ReplaceCalendarFeed(feed)
+	} else {
+		feed, err = api.store.CalendarFeed(feed)
+	}
+	switch err.(type) {
+	case nil:
+	case *ErrStudentNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": "Student not found"})
+		return
+	case *ErrTeacherNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No teachers associated with ID %d", feed.TeacherID)})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving the calendar feed"})
+		return
+	}
+
+	status := http.StatusOK
+	if reset {
+		status = http.StatusCreated
+	}
+	c.IndentedJSON(status, calendarFeedResponse{URL: calendarFeedURL(c, feed.Token), CreatedAt: feed.CreatedAt})
+}
+
+// studentCalendar returns the name of the calendar of a student and an event for each of their bookings.
+// The cancelled bookings stay in the feed as cancelled events, so that the calendar apps remove them.
+func (api *apiServer) studentCalendar(username string) (string, []icsEvent, error) {
+	student, err := api.store.StudentByUsername(username)
+	if err != nil {
+		return "", nil, err
+	}
+	bookings, err := api.store.StudentBookings(username)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var events []icsEvent
+	for _, booking := range bookings {
+		event := icsEvent{
+			UID:     fmt.Sprintf("booking-%d@gotutor", booking.ID),
+			Start:   booking.StartsAt,
+			End:     booking.EndsAt(),
+			Summary: fmt.Sprintf("Lesson with %s %s (%s)", booking.TeacherName, booking.TeacherSurname, booking.Subject),
+			Status:  "CONFIRMED",
+		}
+		if isCancelled(booking.Status) {
+			event.Status, event.Sequence = "CANCELLED", 1
+			event.Description = "Cancelled by " + booking.CancelledBy
+			if booking.CancellationReason != "" {
+				event.Description += ": " + booking.CancellationReason
+			}
+		}
+		events = append(events, event)
+	}
+	return fmt.Sprintf("GoTutor lessons of %s %s", student.Name, student.Surname), events, nil
+}
+
+// teacherCalendar returns the name of the calendar of a teacher and an event for each of their availabilities,
+// with the student of the booked ones. An availability keeps its event when it is booked or freed, with the
+// sequence of the event counting these changes, and its deletion cancels the event.
+func (api *apiServer) teacherCalendar(teacherID int) (string, []icsEvent, error) {
+	teacher, err := api.store.TeacherByID(teacherID)
+	if err != nil {
+		return "", nil, err
+	}
+	availabilities, err := api.store.TeacherAvailabilities(teacherID)
+	if err != nil {
+		return "", nil, err
+	}
+	lessons, err := api.store.TeacherBookedAvailabilities(teacherID)
+	if err != nil {
+		return "", nil, err
+	}
+	deleted, err := api.store.DeletedTeacherAvailabilities(teacherID)
+	if err != nil {
+		return "", nil, err
+	}
+	lessonsByAvailability := map[int]TeacherLesson{}
+	for _, lesson := range lessons {
+		lessonsByAvailability[lesson.ID] = lesson
+	}
+
+	var events []icsEvent
+	for _, availability := range availabilities {
+		event := icsEvent{
+			UID:      fmt.Sprintf("availability-%d@gotutor", availability.ID),
+			Start:    availability.StartsAt,
+			End:      availability.EndsAt(),
+			Sequence: availability.Sequence,
+		}
+		if lesson, booked := lessonsByAvailability[availability.ID]; booked {
+			event.Summary = fmt.Sprintf("Lesson with %s %s (%s)", lesson.StudentName, lesson.StudentSurname, lesson.Subject)
+			event.Status = "CONFIRMED"
+		} else {
+			event.Summary = freeSlotSummary(availability)
+			event.Status, event.Free = "TENTATIVE", true
+		}
+		events = append(events, event)
+	}
+	// The deleted availabilities stay in the feed as cancelled, or the calendar apps would keep showing them
+	for _, availability := range deleted {
+		events = append(events, icsEvent{
+			UID:      fmt.Sprintf("availability-%d@gotutor", availability.ID),
+			Start:    availability.StartsAt,
+			End:      availability.EndsAt(),
+			Summary:  freeSlotSummary(availability),
+			Status:   "CANCELLED",
+			Sequence: availability.Sequence,
+			Free:     true,
+		})
+	}
+	return fmt.Sprintf("GoTutor schedule of %s %s", teacher.Name, teacher.Surname), events, nil
+}
+
+// freeSlotSummary returns the title of the event of an availability nobody booked.
+func freeSlotSummary(availability Availability) string {
+	if availability.Subject == "" {
+		return "Free slot"
+	}
+	return "Free slot (" + availability.Subject + ")"
+}
+
+// newCalendarFeedToken returns a random token for the URL of a calendar feed.
+func newCalendarFeedToken() string {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		log.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// calendarFeedURL returns the URL of the feed with the token, on the host the request was sent to.
+func calendarFeedURL(c *gin.Context, token string) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/api/calendar/" + token + ".ics"
+}
+
+// writeICS writes the events as an iCalendar file (RFC 5545). The times are written in UTC and
+// the calendar apps show them in the zone of the device.
+func writeICS(w io.Writer, name string, events []icsEvent, now time.Time) {
+	const layout = "20060102T150405Z"
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//GoTutor//Lessons//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + escapeICSText(name),
+		"REFRESH-INTERVAL;VALUE=DURATION:PT1H",
+		"X-PUBLISHED-TTL:PT1H",
+	}
+	for _, event := range events {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+event.UID,
+			"DTSTAMP:"+now.UTC().Format(layout),
+			"DTSTART:"+event.Start.UTC().Format(layout),
+			"DTEND:"+event.End.UTC().Format(layout),
+			"SUMMARY:"+escapeICSText(event.Summary),
+		)
+		if event.Description != "" {
+			lines = append(lines, "DESCRIPTION:"+escapeICSText(event.Description))
+		}
+		transparency := "OPAQUE"
+		if event.Free {
+			transparency = "TRANSPARENT"
+		}
+		lines = append(lines,
+			"STATUS:"+event.Status,
+			"SEQUENCE:"+strconv.Itoa(event.Sequence),
+			"TRANSP:"+transparency,
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		io.WriteString(w, foldICSLine(line)+"\r\n")
+	}
+}
+
+// escapeICSText escapes the characters with a meaning in the text values of iCalendar.
+func escapeICSText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// foldICSLine splits a line longer than 75 bytes into continuation lines starting with a space,
+// without cutting a UTF-8 character in two.
+func foldICSLine(line string) string {
+	var folded strings.Builder
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		folded.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		//the leading space of a continuation line counts in its length
+		limit = 74
+	}
+	folded.WriteString(line)
+	return folded.String()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// teacherFeedEvents fetches the calendar feed of the teacher and returns its events by UID.
+func (a *testAPI) teacherFeedEvents(teacherID int) map[string]string {
+	a.t.Helper()
+	response := a.do(http.MethodGet, fmt.Sprintf("/api/teacher/%d/calendar", teacherID), a.admin, nil)
+	a.expect(response, http.StatusOK)
+	var feed calendarFeedResponse
+	a.decode(response, &feed)
+	feedURL, err := url.Parse(feed.URL)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	response = a.do(http.MethodGet, feedURL.Path, "", nil)
+	a.expect(response, http.StatusOK)
+
+	events := map[string]string{}
+	for _, event := range strings.Split(response.Body.String(), "BEGIN:VEVENT\r\n")[1:] {
+		uid, _, _ := strings.Cut(strings.TrimPrefix(event, "UID:"), "\r\n")
+		events[uid] = event
+	}
+	return events
+}
+
+func TestTeacherCalendarCountsTheChangesOfTheAvailabilities(t *testing.T) {
+	testOnStores(t, func(t *testing.T, api *testAPI) {
+		teacherID := api.addTeacher("Lovelace")
+		bookedID := api.addAvailability(teacherID, nextHour(3))
+		deletedID := api.addAvailability(teacherID, nextHour(4))
+		alice := api.addStudent("alice")
+
+		booking := LessonReservation{TeacherID: teacherID, AvailabilityID: bookedID, Subject: "Maths"}
+		api.expect(api.do(http.MethodPost, "/api/student/alice/bookings", alice, booking), http.StatusCreated)
+		bookings, err := api.store.StudentBookings("alice")
+		if err != nil || len(bookings) != 1 {
+			t.Fatalf("got the bookings %+v, %v", bookings, err)
+		}
+		event := api.teacherFeedEvents(teacherID)[fmt.Sprintf("availability-%d@gotutor", bookedID)]
+		if !strings.Contains(event, "STATUS:CONFIRMED\r\n") || !strings.Contains(event, "SEQUENCE:1\r\n") {
+			t.Errorf("the booked availability got the event\n%s", event)
+		}
+
+		api.expect(api.do(http.MethodDelete, fmt.Sprintf("/api/bookings/%d", bookings[0].ID), api.admin, nil), http.StatusOK)
+		api.expect(api.do(http.MethodDelete, fmt.Sprintf("/api/teacher/%d/availability/%d", teacherID, deletedID), api.admin, nil), http.StatusOK)
+
+		events := api.teacherFeedEvents(teacherID)
+		event = events[fmt.Sprintf("availability-%d@gotutor", bookedID)]
+		if !strings.Contains(event, "STATUS:TENTATIVE\r\n") || !strings.Contains(event, "SEQUENCE:2\r\n") {
+			t.Errorf("the freed availability got the event\n%s", event)
+		}
+		event = events[fmt.Sprintf("availability-%d@gotutor", deletedID)]
+		if !strings.Contains(event, "STATUS:CANCELLED\r\n") || !strings.Contains(event, "SEQUENCE:1\r\n") {
+			t.Errorf("the deleted availability got the event\n%s", event)
+		}
+	})
+}
@@ -2,23 +2,31 @@ package main
 
 import (
 	"bufio"
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"server/apiclient"
 )
 
+// cliAPI is the client of the API, logged in as the administrator using the CLI
+var cliAPI *apiclient.Client
+
+// cliLocation is the zone the times are entered and listed in, from GOTUTOR_TIMEZONE or the machine
+var cliLocation = time.Local
+
 func menuCLI(test bool) {
 	fmt.Println("Welcome to the Menu!")
 
+	if err := loginCLI(); err != nil {
+		printErrorMessage(err, "Login failed: ")
+		os.Exit(1)
+	}
+
 	for {
 		printMenu(test)
 		var message string
@@ -36,38 +44,17 @@ func menuCLI(test bool) {
 			//retrieve data from cli for creating a teacher
 			teacher.Name = getUserInput("Enter the teacher's name: ")
 			teacher.Surname = getUserInput("Enter the teacher's surname: ")
+			//the credentials used by the teacher to log into the web portal
+			teacher.Username = getUserInput("Enter the teacher's username: ")
+			teacher.Password = getUserInput("Enter the teacher's password: ")
+			teacher.TimeZone = getUserInput("Enter the teacher's time zone (e.g. Europe/Rome, empty for UTC): ")
 
 			//api call
-			url := "http://localhost:8080/api/teachers/addteacher"
-			payload, err := json.Marshal(teacher)
-			if err != nil {
-				printErrorMessage(err, "Error: ")
-				break
-			}
-			resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
-			if err != nil {
-				printErrorMessage(err, "Error: ")
-				break
-			}
-			defer resp.Body.Close()
-
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				printErrorMessage(err, "Error reading response body: ")
-				break
-			}
-
-			if resp.StatusCode != http.StatusCreated {
-				err := json.Unmarshal([]byte(body), &errorMessage)
-				if err != nil {
-					printErrorMessage(err, "Error parsing JSON: ")
-					return
-				}
-				printMessage("Some error occurred: " + errorMessage.Message)
+			if err := cliAPI.CreateTeacher(context.Background(), teacher); err != nil {
+				printMessage("Some error occurred: " + err.Error())
 				break
-			} else {
-				printMessage("Teacher added successfully!")
 			}
+			printMessage("Teacher added successfully!")
 
 		case "2":
 			fmt.Println("Adding an availability for a specific teacher...")
@@ -77,30 +64,22 @@ func menuCLI(test bool) {
 			teacher.Surname = getUserInput("Enter the teacher's surname: ")
 
 			//api call
-			baseUrl := "http://localhost:8080/api/teachers/" + teacher.Name + "/" + teacher.Surname + "/"
-			resp, err := http.Get(baseUrl)
+			teacher, err := getTeacherInfo(teacher.Name, teacher.Surname)
 			if err != nil {
-				printErrorMessage(err, "Error: ")
-				break
-			}
-			defer resp.Body.Close()
-			if resp.StatusCode != 200 {
-				printMessage("No teacher found as " + teacher.Name + " " + teacher.Surname)
-				break
-			}
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				printErrorMessage(err, "Error reading response body: ")
 				break
 			}
 
-			err = json.Unmarshal(body, &teacher)
+			//show the lesson durations allowed by the teacher
+			policies, err := cliAPI.TeacherDurationPolicies(context.Background(), teacher.ID)
 			if err != nil {
-				printErrorMessage(err, "Error: ")
+				printErrorMessage(err, "Error retrieving the lesson durations: ")
 				break
 			}
+			printDurationPolicies(policies)
+			subject := getUserInput("Enter the subject (empty for any subject): ")
 
 			//retrieve day, endingTime and starting time from the cli
+			fmt.Println("The day and the times are in the " + cliLocation.String() + " time zone")
 			date := getUserInput("Enter the day: ")
 			dayStr := date[0:2]
 			monthStr := date[3:5]
@@ -129,9 +108,6 @@ func menuCLI(test bool) {
 				break
 			}
 
-			//create a time.Time value using the components
-			parsedDate := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
-
 			startingTime := getUserInput("Enter the starting time: ")
 			hour, err := strconv.Atoi(startingTime[0:2])
 			if err != nil {
@@ -143,9 +119,9 @@ func menuCLI(test bool) {
 				printErrorMessage(err, "Error converting minute: ")
 				break
 			}
-			parsedStartingTIme := time.Date(year, time.Month(month), day, hour, min, 0, 0, time.UTC)
+			parsedStartingTIme := time.Date(year, time.Month(month), day, hour, min, 0, 0, cliLocation)
 
-			endingTime := getUserInput("Enter the starting time: ")
+			endingTime := getUserInput("Enter the ending time: ")
 			hour, err = strconv.Atoi(endingTime[0:2])
 			if err != nil {
 				printErrorMessage(err, "Error converting hour: ")
@@ -156,42 +132,22 @@ func menuCLI(test bool) {
 				printErrorMessage(err, "Error converting minute: ")
 				break
 			}
-			parsedEndingTime := time.Date(year, time.Month(month), day, hour, min, 0, 0, time.UTC)
+			parsedEndingTime := time.Date(year, time.Month(month), day, hour, min, 0, 0, cliLocation)
 
 			//generate the availability with booked false
-			availability := Availability{Day: parsedDate, StartingTime: parsedStartingTIme, EndingTime: parsedEndingTime, Booked: false}
-
-			//insert it into the database using a POST request
-			baseUrl = fmt.Sprintf("http://localhost:8080/api/teacher/%d/availability", teacher.ID)
-			payload, err := json.Marshal(availability)
-			if err != nil {
-				printMessage("It wasn't possible to encode the availability to JSON")
-				break
-			}
-			resp, err = http.Post(baseUrl, "application/json", bytes.NewBuffer(payload))
-			if err != nil {
-				printErrorMessage(err, "The availability couldn't be inserted into the database: ")
-				break
+			availability := Availability{
+				StartsAt:        parsedStartingTIme,
+				DurationMinutes: int(parsedEndingTime.Sub(parsedStartingTIme).Minutes()),
+				Booked:          false,
+				Subject:         subject,
 			}
-			defer resp.Body.Close()
 
-			body, err = io.ReadAll(resp.Body)
-			if err != nil {
-				printErrorMessage(err, "Error reading response body: ")
+			//insert it into the database using a POST request
+			if err := cliAPI.CreateAvailability(context.Background(), teacher.ID, availability); err != nil {
+				printMessage("Some error occurred: " + err.Error())
 				break
 			}
-			if resp.StatusCode != http.StatusCreated {
-				err := json.Unmarshal([]byte(body), &errorMessage)
-				if err != nil {
-					printErrorMessage(err, "Error parsing JSON: ")
-					return
-				}
-				printMessage("Some error occurred: " + errorMessage.Message)
-				break
-			} else {
-				printMessage("Availability added successfully!")
-
-			}
+			printMessage("Availability added successfully!")
 
 		case "3":
 			fmt.Println("Listing all availabilities for a specific teacher...")
@@ -204,33 +160,27 @@ func menuCLI(test bool) {
 				break
 			}
 			//api call
-			baseUrl := fmt.Sprintf("http://localhost:8080/api/teacher/%d/availability", teacher.ID)
-			resp, err := http.Get(baseUrl)
+			availabilities, err := cliAPI.TeacherAvailability(context.Background(), teacher.ID)
 			if err != nil {
+				printErrorMessage(err, "Error: ")
 				break
 			}
 			//list out all the element of the rsponse body
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				printErrorMessage(err, "Error reading response body: ")
-				break
-			}
-			if string(body) == "[]" {
+			if len(availabilities) == 0 {
 				printMessage("#### There are no availabilities for this teacher ####")
 				break
 			} else {
-				var availabilities []Availability
-				err = json.Unmarshal(body, &availabilities)
-				if err != nil {
-					printErrorMessage(err, "Error: ")
-					break
-				}
 				fmt.Println("Availabilities: ")
 				for i := 0; i < len(availabilities); i++ {
 					fmt.Println("ID: ", availabilities[i].ID)
-					fmt.Println("Day: ", availabilities[i].Day.Format("Monday, 2 January 2006"))
-					fmt.Println("Starting time: ", availabilities[i].StartingTime.Format("15:04"))
-					fmt.Println("Ending time: ", availabilities[i].EndingTime.Format("15:04"))
+					startsAt, endsAt := availabilities[i].StartsAt.In(cliLocation), availabilities[i].EndsAt().In(cliLocation)
+					fmt.Println("Day: ", startsAt.Format("Monday, 2 January 2006"))
+					fmt.Println("Starting time: ", startsAt.Format("15:04 MST"))
+					fmt.Println("Ending time: ", endsAt.Format("15:04 MST"))
+					fmt.Println("Duration: ", availabilities[i].DurationMinutes, "minutes")
+					if availabilities[i].Subject != "" {
+						fmt.Println("Subject: ", availabilities[i].Subject)
+					}
 					fmt.Println("Booked: ", availabilities[i].Booked)
 					fmt.Println("----------------------------------------------------------------")
 				}
@@ -239,36 +189,23 @@ func menuCLI(test bool) {
 		case "4":
 			fmt.Println("Listing all teachers...")
 			//api call
-			url := "http://localhost:8080/api/teachers"
-
-			resp, err := http.Get(url)
+			teachers, err := cliAPI.ListTeachers(context.Background())
 			if err != nil {
 				printErrorMessage(err, "Error: ")
 				break
 			}
-			defer resp.Body.Close()
-
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				printErrorMessage(err, "Error reading response body: ")
-				break
-			}
 			//list out all the teachers
-			if string(body) == "[]" {
-				printMessage("#### There are no availabilities for this teacher ####")
+			if len(teachers) == 0 {
+				printMessage("#### There are no teachers ####")
 				break
 			} else {
-				var teachers []Teacher
-				err = json.Unmarshal(body, &teachers)
-				if err != nil {
-					printErrorMessage(err, "Error: ")
-					break
-				}
 				fmt.Println("Teachers: ")
 				for i := 0; i < len(teachers); i++ {
 					fmt.Println("Teacher ID: ", teachers[i].ID)
 					fmt.Println("Name: ", teachers[i].Name)
 					fmt.Println("Surname: ", teachers[i].Surname)
+					fmt.Println("Username: ", teachers[i].Username)
+					fmt.Println("Time zone: ", teachers[i].TimeZone)
 					fmt.Println("----------------------------------------------------------------")
 				}
 			}
@@ -310,69 +247,30 @@ func menuCLI(test bool) {
 
 			username := getUserInput("Enter the student's username: ")
 			password := getUserInput("Enter the student's password: ")
+			timeZone := getUserInput("Enter the student's time zone (e.g. Europe/Rome, empty for UTC): ")
 
 			//create the object that represent the student
-			student := Student{Name: name, Surname: surname, DateOfBirth: parsedDate, Username: username, Password: password}
+			student := Student{Name: name, Surname: surname, DateOfBirth: parsedDate, Username: username, Password: password, TimeZone: timeZone}
 
 			//api call
-			url := "http://localhost:8080/api/student/addstudent"
-			payload, err := json.Marshal(student)
-			if err != nil {
-				printMessage(err.Error())
-				break
-			}
-			resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
-			if err != nil {
-				printErrorMessage(err, "Error: ")
+			if err := cliAPI.CreateStudent(context.Background(), student); err != nil {
+				printMessage("Some error occurred: " + err.Error())
 				break
 			}
-			defer resp.Body.Close()
-
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				printErrorMessage(err, "Error reading response body: ")
-				break
-			}
-
-			if resp.StatusCode != http.StatusCreated {
-				err := json.Unmarshal([]byte(body), &errorMessage)
-				if err != nil {
-					printErrorMessage(err, "Error parsing JSON: ")
-					return
-				}
-				printMessage("Some error occurred: " + errorMessage.Message)
-				break
-			} else {
-				printMessage("Student added successfully!")
-			}
+			printMessage("Student added successfully!")
 		case "6":
 			fmt.Println("Listing all students...")
 			//api call
-			url := "http://localhost:8080/api/student/allstudents"
-
-			resp, err := http.Get(url)
+			students, err := cliAPI.ListStudents(context.Background())
 			if err != nil {
 				printErrorMessage(err, "Error: ")
 				break
 			}
-			defer resp.Body.Close()
-
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				printErrorMessage(err, "Error reading response body: ")
-				break
-			}
 			//list out all the students
-			if string(body) == "[]" {
-				printMessage("#### There are no availabilities for this teacher ####")
+			if len(students) == 0 {
+				printMessage("#### There are no students ####")
 				break
 			} else {
-				var students []Student
-				err = json.Unmarshal(body, &students)
-				if err != nil {
-					printErrorMessage(err, "Error: ")
-					break
-				}
 				fmt.Println("Students: ")
 				for i := 0; i < len(students); i++ {
 					fmt.Println("UserName: ", students[i].Username)
@@ -384,21 +282,10 @@ func menuCLI(test bool) {
 			}
 		case "7":
 			fmt.Println("Showing profile of a specific student...")
-			//retrieve data from cli for creating an availability
+			//the administrator can read any profile, without the password of the student
 			username := getUserInput("Enter the student's username: ")
-			//find it the username is already in use
 			student, err := getStudentInfo(username)
 			if err != nil {
-				printErrorMessage(err, "Error: ")
-				break
-			}
-			//retrieve password from the cli
-			password := getUserInput("Enter the student's password: ")
-
-			//check if the passowrd is correct
-			err = bcrypt.CompareHashAndPassword([]byte(student.Password), []byte(password))
-			if err != nil {
-				printMessage("#### Wrong password ####")
 				break
 			}
 			printStudentProfile(student)
@@ -410,7 +297,6 @@ func menuCLI(test bool) {
 			//retrieve ID of the student
 			student, err := getStudentInfo(username)
 			if err != nil {
-				printErrorMessage(err, "Error: ")
 				break
 			}
 			//retrieve form cli name and surname of the teacher
@@ -423,20 +309,7 @@ func menuCLI(test bool) {
 				break
 			}
 			//api call
-			baseUrl := fmt.Sprintf("http://localhost:8080/api/teacher/%d/availability", teacher.ID)
-			resp, err := http.Get(baseUrl)
-			if err != nil {
-				printErrorMessage(err, "Error: ")
-				break
-			}
-			//list out all the element of the rsponse body
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				printErrorMessage(err, "Error reading response body: ")
-				break
-			}
-			var availabilities []Availability
-			err = json.Unmarshal(body, &availabilities)
+			availabilities, err := cliAPI.TeacherAvailability(context.Background(), teacher.ID)
 			if err != nil {
 				printErrorMessage(err, "Error: ")
 				break
@@ -447,15 +320,17 @@ func menuCLI(test bool) {
 				fmt.Println("Availabilties of " + teacherName + " " + teacherSurname)
 				for _, a := range availabilities {
 					if a.Booked == false {
-						fmt.Printf("%d. %02d/%02d/%4d %02d:%02d - %02d:%02d\n",
+						startsAt, endsAt := a.StartsAt.In(cliLocation), a.EndsAt().In(cliLocation)
+						fmt.Printf("%d. %02d/%02d/%4d %02d:%02d - %02d:%02d %s\n",
 							a.ID,
-							a.Day.Day(),
-							a.Day.Month(),
-							a.Day.Year(),
-							a.StartingTime.Hour(),
-							a.StartingTime.Minute(),
-							a.EndingTime.Hour(),
-							a.EndingTime.Minute())
+							startsAt.Day(),
+							startsAt.Month(),
+							startsAt.Year(),
+							startsAt.Hour(),
+							startsAt.Minute(),
+							endsAt.Hour(),
+							endsAt.Minute(),
+							startsAt.Format("MST"))
 					} else {
 						count = count + 1
 					}
@@ -478,32 +353,16 @@ func menuCLI(test bool) {
 					newBooking.Subject = subject
 
 					//api call
-					url := "http://localhost:8080/api/student/" + student.Username + "/bookings"
-					payload, err := json.Marshal(newBooking)
-					resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
-					if err != nil {
-						printErrorMessage(err, "Error: ")
-						break
-					}
-					defer resp.Body.Close()
-					body, err = io.ReadAll(resp.Body)
-					if err != nil {
-						printErrorMessage(err, "Error reading response body: ")
+					if err := cliAPI.CreateBooking(context.Background(), newBooking); err != nil {
+						printMessage("Some error occurred: " + err.Error())
 						break
 					}
-					if resp.StatusCode != 201 {
-						err = json.Unmarshal(body, &errorMessage)
-						if err != nil {
-							fmt.Println(err)
-							break
-						}
-						printMessage("Some error occurred: " + errorMessage.Message)
-						break
-					} else {
-						printMessage("Lesson booked successfully")
-					}
+					printMessage("Lesson booked successfully")
 				} else {
 					printMessage("All the availabilities are already booked")
+					if strings.ToLower(getUserInput("Join the waitlist for a week? (y/n): ")) == "y" {
+						joinWaitlistCLI(student.Username, teacher.ID)
+					}
 					break
 				}
 
@@ -514,43 +373,26 @@ func menuCLI(test bool) {
 
 		case "9":
 			fmt.Println("Listing all the booking made by a specific student...")
-			var student Student
 			//retrieve username from cli
-			student.Username = getUserInput("Enter the student's username: ")
-			//api call 
-			baseUrl := "http://localhost:8080/api/student/" + student.Username + "/bookings"
-			resp, err := http.Get(baseUrl)
-			if err != nil {
-				printErrorMessage(err, "Error: ")
-				break
-			}
-			defer resp.Body.Close()
-
-			//list out all the booking
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				printErrorMessage(err, "Error reading response body: ")
-				break
-			}
-			if resp.StatusCode != 200 {
-				printMessage("#### No student found as " + student.Username + " ####")
-				break
-			}
-			var bookings []LessonBooked
-			err = json.Unmarshal(body, &bookings)
+			username := getUserInput("Enter the student's username: ")
+			//api call
+			bookings, err := cliAPI.StudentBookings(context.Background(), username)
 			if err != nil {
-				printErrorMessage(err, "Error: ")
+				printMessage("#### No student found as " + username + " ####")
 				break
 			}
 			for i := 0; i < len(bookings); i++ {
-				fmt.Printf("%d. %s %02d:%02d - %02d:%02d - %s\n",
+				startsAt, endsAt := bookings[i].StartsAt.In(cliLocation), bookings[i].EndsAt().In(cliLocation)
+				fmt.Printf("%d. %s %02d:%02d - %02d:%02d %s - %s (%s)\n",
 					bookings[i].ID,
-					bookings[i].Day,
-					bookings[i].StartingTime.Hour(),
-					bookings[i].StartingTime.Minute(),
-					bookings[i].EndingTime.Hour(),
-					bookings[i].EndingTime.Minute(),
-					bookings[i].Subject)
+					startsAt.Format("Monday, 2 January 2006"),
+					startsAt.Hour(),
+					startsAt.Minute(),
+					endsAt.Hour(),
+					endsAt.Minute(),
+					startsAt.Format("MST"),
+					bookings[i].Subject,
+					bookings[i].Status)
 			}
 
 		case "0":
@@ -587,59 +429,90 @@ func getUserInput(prompt string) string {
 }
 
 func getStudentInfo(username string) (Student, error) { //used to retrieve the student from the username
-	var student Student
-	//api call 
-	baseUrl := "http://localhost:8080/api/student/" + username + "/profile"
-	resp, err := http.Get(baseUrl)
-	if err != nil {
-		printMessage("Error:" + err.Error())
+	student, err := cliAPI.StudentProfile(context.Background(), username)
+	var studentErr *ErrStudentNotFound
+	if errors.As(err, &studentErr) {
+		printMessage("#### No student found as " + studentErr.StudentID + " ####")
 		return Student{}, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		printMessage("Error reading response body:" + err.Error())
-		return Student{}, err
-	}
-	if resp.StatusCode != 200 {
-		fmt.Println("#### No student found as " + username + " ####")
-		return Student{}, errors.New("No student found")
-	}
-	err = json.Unmarshal(body, &student)
-	if err != nil {
-		printMessage(err.Error())
+		printMessage("Some error occurred: " + err.Error())
 		return Student{}, err
 	}
 	return student, nil
 }
 
 func getTeacherInfo(teacherName, teacherSurname string) (Teacher, error) { //used to retrieve teacher info from name and surname
-	var teacher Teacher
-	//api call 
-	baseUrl := "http://localhost:8080/api/teachers/" + teacherName + "/" + teacherSurname + "/"
-	resp, err := http.Get(baseUrl)
-	if err != nil {
-		printMessage("Error:" + err.Error())
+	id, err := cliAPI.FindTeacherID(context.Background(), teacherName, teacherSurname)
+	var teacherErr *ErrTeacherNotFound
+	if errors.As(err, &teacherErr) {
+		printMessage("No teacher found as " + teacherErr.Name + " " + teacherErr.Surname)
 		return Teacher{}, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		printMessage("Error reading response body:" + err.Error())
+		printMessage("Some error occurred: " + err.Error())
 		return Teacher{}, err
 	}
-	if resp.StatusCode != 200 {
-		printMessage("No teacher found as " + teacher.Name + " " + teacher.Surname)
-		return Teacher{}, err
+	return Teacher{ID: id, Name: teacherName, Surname: teacherSurname}, nil
+}
+
+func printDurationPolicies(policies durationPolicies) {
+	fmt.Printf("Allowed lesson durations: %s minutes, starting every %d minutes\n",
+		formatDurations(policies.Default.DurationsMinutes), policies.Default.GranularityMinutes)
+	for _, policy := range policies.Subjects {
+		fmt.Printf("  %s: %s minutes, starting every %d minutes\n",
+			policy.Subject, formatDurations(policy.DurationsMinutes), policy.GranularityMinutes)
+	}
+}
+
+// loginCLI logs the administrator into the API, with the credentials in
+// GOTUTOR_ADMIN_USERNAME and GOTUTOR_ADMIN_PASSWORD or the ones typed in the cli
+func loginCLI() error {
+	username := os.Getenv("GOTUTOR_ADMIN_USERNAME")
+	password := os.Getenv("GOTUTOR_ADMIN_PASSWORD")
+	if username == "" || password == "" {
+		username = getUserInput("Enter the admin username: ")
+		password = getUserInput("Enter the admin password: ")
 	}
-	err = json.Unmarshal(body, &teacher)
+	return loginAdmin(username, password)
+}
+
+// loginAdmin logs the administrator into the API and sets the time zone of the cli from GOTUTOR_TIMEZONE
+func loginAdmin(username, password string) error {
+	_, err := loginAdminResponse(username, password)
+	return err
+}
+
+// loginAdminResponse logs the administrator into the API like loginAdmin and returns the token issued.
+func loginAdminResponse(username, password string) (loginResponse, error) {
+	client := newAPIClientFromEnv()
+	login, err := client.Login(context.Background(), username, password, roleAdmin)
 	if err != nil {
-		printMessage(err.Error())
-		return Teacher{}, err
+		return loginResponse{}, err
+	}
+	useAdminToken(client, login.Token)
+	return login, nil
+}
+
+// useAdminToken makes the cli call the API with the token of the administrator, in the time zone of GOTUTOR_TIMEZONE.
+func useAdminToken(client *apiclient.Client, token string) {
+	cliAPI = client.WithToken(token)
+	if timeZone := os.Getenv("GOTUTOR_TIMEZONE"); timeZone != "" {
+		cliLocation = loadLocation(timeZone)
 	}
-	return teacher, nil
+}
+
+// joinWaitlistCLI puts the student on the waitlist of the teacher for a week read from the cli
+func joinWaitlistCLI(username string, teacherID int) {
+	week := getUserInput("Enter a day of the week (YYYY-MM-DD): ")
+	subject := getUserInput("Enter the subject you want to book: ")
+	//the week is a day in the time zone of the cli
+	request := waitlistRequest{TeacherID: teacherID, Week: week, Subject: subject}
+	if _, err := cliAPI.WithTimeZone(cliLocation.String()).JoinWaitlist(context.Background(), username, request); err != nil {
+		printMessage("Some error occurred: " + err.Error())
+		return
+	}
+	printMessage("Added to the waitlist: the first lesson freed that week will be booked")
 }
 
 func printMessage(message string) {
@@ -678,7 +551,10 @@ func printStudentProfile(student Student) {
 
 	// Determine the maximum length among labels and values
 	maxLength := len("Date of Birth:") + len(dateOfBirth)
-	labels := []string{"Name:", "Surname:", "Date of Birth:", "Username:"}
+	if len("Date of Birth:")+len(student.TimeZone) > maxLength {
+		maxLength = len("Date of Birth:") + len(student.TimeZone)
+	}
+	labels := []string{"Name:", "Surname:", "Date of Birth:", "Username:", "Time Zone:"}
 	for _, label := range labels {
 		if len(label) > maxLength {
 			maxLength = len(label)
@@ -694,6 +570,7 @@ func printStudentProfile(student Student) {
 ║ Surname:       %s%s║
 ║ Date of Birth: %s%s║
 ║ Username:      %s%s║
+║ Time Zone:     %s%s║
 ╚%s╝
 `,
 		strings.Repeat("═", maxLength),
@@ -703,6 +580,7 @@ func printStudentProfile(student Student) {
 		student.Surname, strings.Repeat(" ", maxLength-len("Surname:     ")-len(student.Surname)-3),
 		dateOfBirth, strings.Repeat(" ", maxLength-len("Date of Birth:")-len(dateOfBirth)-2),
 		student.Username, strings.Repeat(" ", maxLength-len("Username:    ")-len(student.Username)-3),
+		student.TimeZone, strings.Repeat(" ", maxLength-len("Time Zone:   ")-len(student.TimeZone)-3),
 		strings.Repeat("═", maxLength),
 	)
 
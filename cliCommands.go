@@ -0,0 +1,657 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"server/apiclient"
+)
+
+// exit codes of the cli subcommands
+const (
+	exitOK = 0
+	// exitFailure is returned when the API refused the request or couldn't be reached
+	exitFailure = 1
+	// exitUsage is returned for an unknown subcommand or wrong flags
+	exitUsage = 2
+	// exitNotFound is returned when the teacher or the student doesn't exist
+	exitNotFound = 3
+)
+
+// output formats of the cli subcommands
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+)
+
+// cliCommand is a subcommand of the cli, like "teacher add", run without the menu so that it can be scripted.
+type cliCommand struct {
+	name string
+	// flags lists the flags of the command for the usage message
+	flags string
+	run   func(fs *flag.FlagSet, args []string) error
+}
+
+// synopsis returns the command with its flags, like "booking list --student".
+func (c cliCommand) synopsis() string {
+	return strings.TrimSpace(c.name + " " + c.flags)
+}
+
+// cliCommands are the subcommands, in the order they are listed by the usage message
+var cliCommands = []cliCommand{
+	{"teacher add", "--name --surname --username --password [--timezone] [--email] [--subjects]", teacherAddCommand},
+	{"teacher list", "", teacherListCommand},
+	{"teacher search", "[--subject] [--name] [--from \"YYYY-MM-DD HH:MM\"] [--to \"YYYY-MM-DD HH:MM\"]", teacherSearchCommand},
+	{"teacher subjects", "--teacher-id [--set]", teacherSubjectsCommand},
+	{"availability add", "--teacher-id --day YYYY-MM-DD --start HH:MM --end HH:MM [--subject]", availabilityAddCommand},
+	{"availability list", "--teacher-id", availabilityListCommand},
+	{"student add", "--name --surname --date-of-birth YYYY-MM-DD --username --password [--timezone] [--email]", studentAddCommand},
+	{"student list", "", studentListCommand},
+	{"booking create", "--student --teacher-id --availability-id --subject", bookingCreateCommand},
+	{"booking list", "--student", bookingListCommand},
+	{"admin add", "--username --password", adminAddCommand},
+	{"admin list", "", adminListCommand},
+	{"admin failed-logins", "[--username] [--limit]", adminFailedLoginsCommand},
+	{"import teachers", "--file [--format csv|jsonl] [--dry-run]", importCommand(importTypeTeachers)},
+	{"import students", "--file [--format csv|jsonl] [--dry-run]", importCommand(importTypeStudents)},
+	{"import availabilities", "--file [--format csv|jsonl] [--dry-run]", importCommand(importTypeAvailabilities)},
+	{"export all", "[--file]", exportCommand("")},
+	{"export teachers", "[--file]", exportCommand(importTypeTeachers)},
+	{"export students", "[--file]", exportCommand(importTypeStudents)},
+	{"export availabilities", "[--file]", exportCommand(importTypeAvailabilities)},
+	{"export bookings", "[--file]", exportCommand(exportTypeBookings)},
+}
+
+// cliUsageError is a subcommand used with missing or wrong flags
+type cliUsageError struct {
+	message string
+}
+
+func (e *cliUsageError) Error() string {
+	return e.message
+}
+
+// cliOutput is the result of a subcommand: data is printed as is in json, and as the header
+// and the rows in table and csv.
+type cliOutput struct {
+	data   any
+	header []string
+	rows   [][]string
+}
+
+// runCLICommand runs the subcommand in args, like ["teacher", "list", "--output", "json"], logged in
+// with GOTUTOR_ADMIN_USERNAME and GOTUTOR_ADMIN_PASSWORD, and returns the exit code.
+func runCLICommand(args []string) int {
+	if len(args) == 1 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		printCLIUsage(os.Stdout)
+		return exitOK
+	}
+	if len(args) < 2 {
+		printCLIUsage(os.Stderr)
+		return exitUsage
+	}
+	name := args[0] + " " + args[1]
+	var command *cliCommand
+	for i := range cliCommands {
+		if cliCommands[i].name == name {
+			command = &cliCommands[i]
+		}
+	}
+	if command == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", name)
+		printCLIUsage(os.Stderr)
+		return exitUsage
+	}
+
+	//the errors of the flags are printed below, together with the usage of the command
+	fs := newCommandFlagSet(name)
+	err := command.run(fs, args[2:])
+	if cachedTokenRejected(err) {
+		//the API didn't run the command, which runs again after a new login
+		fs = newCommandFlagSet(name)
+		err = command.run(fs, args[2:])
+	}
+	var usageErr *cliUsageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		printCommandUsage(os.Stdout, fs, *command)
+		return exitOK
+	case errors.As(err, &usageErr):
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		printCommandUsage(os.Stderr, fs, *command)
+		return exitUsage
+	case isNotFound(err):
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitNotFound
+	default:
+		printCLIError(os.Stderr, err)
+		return exitFailure
+	}
+}
+
+// newCommandFlagSet returns the flags of a command, which print nothing themselves.
+func newCommandFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	return fs
+}
+
+// printCLIError prints the error of a command, with every invalid field on its own line when the API
+// refused the request with 422 Unprocessable Entity.
+func printCLIError(w io.Writer, err error) {
+	var apiErr *apiclient.Error
+	if !errors.As(err, &apiErr) || len(apiErr.Fields) == 0 {
+		fmt.Fprintln(w, "Error:", err)
+		return
+	}
+	fmt.Fprintln(w, "Error: the request is invalid")
+	for _, field := range apiErr.Fields {
+		if field.Field == "" {
+			fmt.Fprintf(w, "  %s\n", field.Message)
+		} else {
+			fmt.Fprintf(w, "  %s: %s\n", field.Field, field.Message)
+		}
+	}
+}
+
+func printCLIUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: server.exe -m cli [-test]            for the menu")
+	fmt.Fprintln(w, "       server.exe -m cli <command> [flags]  for a single command")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, command := range cliCommands {
+		fmt.Fprintln(w, " ", command.synopsis())
+	}
+	fmt.Fprintln(w, "\nEvery command takes --output table|json|csv, table by default. The administrator is logged in")
+	fmt.Fprintln(w, "with GOTUTOR_ADMIN_USERNAME and GOTUTOR_ADMIN_PASSWORD.")
+	fmt.Fprintf(w, "Exit codes: %d success, %d failure, %d wrong usage, %d teacher or student not found\n", exitOK, exitFailure, exitUsage, exitNotFound)
+}
+
+func printCommandUsage(w io.Writer, fs *flag.FlagSet, command cliCommand) {
+	fmt.Fprintf(w, "Usage: server.exe -m cli %s [--output table|json|csv]\n", command.synopsis())
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+// Teachers
+
+func teacherAddCommand(fs *flag.FlagSet, args []string) error {
+	var teacher Teacher
+	fs.StringVar(&teacher.Name, "name", "", "name of the teacher")
+	fs.StringVar(&teacher.Surname, "surname", "", "surname of the teacher")
+	fs.StringVar(&teacher.Username, "username", "", "username of the teacher for the web portal")
+	fs.StringVar(&teacher.Password, "password", "", "password of the teacher for the web portal")
+	fs.StringVar(&teacher.TimeZone, "timezone", "", "time zone of the teacher, like Europe/Rome (UTC when empty)")
+	fs.StringVar(&teacher.Email, "email", "", "email address of the teacher for the notifications (none when empty)")
+	subjects := fs.String("subjects", "", "comma-separated subjects the teacher teaches (any subject when empty)")
+	output := outputFlag(fs)
+	if err := parseCommandFlags(fs, args, "name", "surname", "username", "password"); err != nil {
+		return err
+	}
+	teacher.Subjects = splitSubjects(*subjects)
+	if err := cliAPI.CreateTeacher(context.Background(), teacher); err != nil {
+		return err
+	}
+	return printOutput(*output, messageOutput("Teacher added successfully"))
+}
+
+func teacherListCommand(fs *flag.FlagSet, args []string) error {
+	output := outputFlag(fs)
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+	teachers, err := cliAPI.ListTeachers(context.Background())
+	if err != nil {
+		return err
+	}
+	return printOutput(*output, teachersOutput(teachers))
+}
+
+// teacherSearchCommand lists the teachers of a subject, with a name starting with --name, or with a free
+// availability between --from and --to, in the time zone of the cli.
+func teacherSearchCommand(fs *flag.FlagSet, args []string) error {
+	var search TeacherSearch
+	fs.StringVar(&search.Subject, "subject", "", "subject the teachers teach")
+	fs.StringVar(&search.NamePrefix, "name", "", "start of the name or the surname of the teachers")
+	from := fs.String("from", "", "start of the free slot, YYYY-MM-DD HH:MM")
+	to := fs.String("to", "", "end of the free slot, YYYY-MM-DD HH:MM")
+	output := outputFlag(fs)
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+	var err error
+	if *from != "" {
+		if search.FreeFrom, err = time.ParseInLocation("2006-01-02 15:04", *from, cliLocation); err != nil {
+			return &cliUsageError{"The from time need to be in the YYYY-MM-DD HH:MM format"}
+		}
+	}
+	if *to != "" {
+		if search.FreeTo, err = time.ParseInLocation("2006-01-02 15:04", *to, cliLocation); err != nil {
+			return &cliUsageError{"The to time need to be in the YYYY-MM-DD HH:MM format"}
+		}
+	}
+	teachers, err := cliAPI.SearchTeachers(context.Background(), search)
+	if err != nil {
+		return err
+	}
+	return printOutput(*output, teachersOutput(teachers))
+}
+
+// teacherSubjectsCommand lists the subjects of a teacher, or replaces them with the ones of --set.
+func teacherSubjectsCommand(fs *flag.FlagSet, args []string) error {
+	teacherID := fs.Int("teacher-id", 0, "ID of the teacher")
+	set := fs.String("set", "", "comma-separated subjects replacing the ones of the teacher, \"\" for any subject")
+	output := outputFlag(fs)
+	if err := parseCommandFlags(fs, args, "teacher-id"); err != nil {
+		return err
+	}
+	replace := false
+	fs.Visit(func(f *flag.Flag) { replace = replace || f.Name == "set" })
+	var subjects []string
+	var err error
+	if replace {
+		subjects, err = cliAPI.SetTeacherSubjects(context.Background(), *teacherID, splitSubjects(*set))
+	} else {
+		subjects, err = cliAPI.TeacherSubjects(context.Background(), *teacherID)
+	}
+	if err != nil {
+		return err
+	}
+	out := cliOutput{data: subjects, header: []string{"SUBJECT"}}
+	for _, subject := range subjects {
+		out.rows = append(out.rows, []string{subject})
+	}
+	return printOutput(*output, out)
+}
+
+// teachersOutput lists the teachers, with their subjects separated by commas.
+func teachersOutput(teachers []Teacher) cliOutput {
+	out := cliOutput{data: teachers, header: []string{"ID", "NAME", "SURNAME", "USERNAME", "TIME ZONE", "EMAIL", "SUBJECTS"}}
+	for _, teacher := range teachers {
+		out.rows = append(out.rows, []string{strconv.Itoa(teacher.ID), teacher.Name, teacher.Surname, teacher.Username, teacher.TimeZone,
+			teacher.Email, strings.Join(teacher.Subjects, ", ")})
+	}
+	return out
+}
+
+// splitSubjects splits a comma-separated list of subjects, dropping the blank ones.
+func splitSubjects(list string) []string {
+	var subjects []string
+	for _, subject := range strings.Split(list, ",") {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			subjects = append(subjects, subject)
+		}
+	}
+	return subjects
+}
+
+// Availabilities
+
+// availabilityAddCommand adds an availability from the day and the times in the time zone of the cli.
+func availabilityAddCommand(fs *flag.FlagSet, args []string) error {
+	teacherID := fs.Int("teacher-id", 0, "ID of the teacher")
+	day := fs.String("day", "", "day of the availability, YYYY-MM-DD")
+	start := fs.String("start", "", "starting time, HH:MM")
+	end := fs.String("end", "", "ending time, HH:MM")
+	subject := fs.String("subject", "", "subject the availability is reserved for (any subject when empty)")
+	output := outputFlag(fs)
+	if err := parseCommandFlags(fs, args, "teacher-id", "day", "start", "end"); err != nil {
+		return err
+	}
+	startsAt, err := time.ParseInLocation("2006-01-02 15:04", *day+" "+*start, cliLocation)
+	if err != nil {
+		return &cliUsageError{"The day need to be in the YYYY-MM-DD format and the starting time in the HH:MM one"}
+	}
+	endsAt, err := time.ParseInLocation("2006-01-02 15:04", *day+" "+*end, cliLocation)
+	if err != nil {
+		return &cliUsageError{"The ending time need to be in the HH:MM format"}
+	}
+	availability := Availability{
+		StartsAt:        startsAt,
+		DurationMinutes: int(endsAt.Sub(startsAt).Minutes()),
+		Subject:         *subject,
+	}
+	if err := cliAPI.CreateAvailability(context.Background(), *teacherID, availability); err != nil {
+		return err
+	}
+	return printOutput(*output, messageOutput("Availability added successfully"))
+}
+
+func availabilityListCommand(fs *flag.FlagSet, args []string) error {
+	teacherID := fs.Int("teacher-id", 0, "ID of the teacher")
+	output := outputFlag(fs)
+	if err := parseCommandFlags(fs, args, "teacher-id"); err != nil {
+		return err
+	}
+	availabilities, err := cliAPI.TeacherAvailability(context.Background(), *teacherID)
+	if err != nil {
+		return err
+	}
+	out := cliOutput{data: availabilities, header: []string{"ID", "DAY", "START", "END", "TIME ZONE", "SUBJECT", "BOOKED"}}
+	for i, a := range availabilities {
+		startsAt, endsAt := a.StartsAt.In(cliLocation), a.EndsAt().In(cliLocation)
+		availabilities[i].StartsAt = startsAt
+		out.rows = append(out.rows, []string{strconv.Itoa(a.ID), startsAt.Format("2006-01-02"), startsAt.Format("15:04"),
+			endsAt.Format("15:04"), startsAt.Format("MST"), a.Subject, strconv.FormatBool(a.Booked)})
+	}
+	return printOutput(*output, out)
+}
+
+// Students
+
+func studentAddCommand(fs *flag.FlagSet, args []string) error {
+	var student Student
+	fs.StringVar(&student.Name, "name", "", "name of the student")
+	fs.StringVar(&student.Surname, "surname", "", "surname of the student")
+	dateOfBirth := fs.String("date-of-birth", "", "date of birth of the student, YYYY-MM-DD")
+	fs.StringVar(&student.Username, "username", "", "username of the student")
+	fs.StringVar(&student.Password, "password", "", "password of the student")
+	fs.StringVar(&student.TimeZone, "timezone", "", "time zone of the student, like Europe/Rome (UTC when empty)")
+	fs.StringVar(&student.Email, "email", "", "email address of the student for the notifications (none when empty)")
+	output := outputFlag(fs)
+	if err := parseCommandFlags(fs, args, "name", "surname", "date-of-birth", "username", "password"); err != nil {
+		return err
+	}
+	date, err := time.Parse("2006-01-02", *dateOfBirth)
+	if err != nil {
+		return &cliUsageError{"The date of birth need to be in the YYYY-MM-DD format"}
+	}
+	student.DateOfBirth = date
+	if err := cliAPI.CreateStudent(context.Background(), student); err != nil {
+		return err
+	}
+	return printOutput(*output, messageOutput("Student added successfully"))
+}
+
+func studentListCommand(fs *flag.FlagSet, args []string) error {
+	output := outputFlag(fs)
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+	students, err := cliAPI.ListStudents(context.Background())
+	if err != nil {
+		return err
+	}
+	out := cliOutput{data: students, header: []string{"USERNAME", "NAME", "SURNAME", "DATE OF BIRTH", "TIME ZONE", "EMAIL"}}
+	for _, student := range students {
+		out.rows = append(out.rows, []string{student.Username, student.Name, student.Surname, student.DateOfBirth.Format("2006-01-02"),
+			student.TimeZone, student.Email})
+	}
+	return printOutput(*output, out)
+}
+
+// Bookings
+
+func bookingCreateCommand(fs *flag.FlagSet, args []string) error {
+	var booking LessonReservation
+	fs.StringVar(&booking.StudentUsername, "student", "", "username of the student")
+	fs.IntVar(&booking.TeacherID, "teacher-id", 0, "ID of the teacher")
+	fs.IntVar(&booking.AvailabilityID, "availability-id", 0, "ID of the availability to book")
+	fs.StringVar(&booking.Subject, "subject", "", "subject of the lesson")
+	output := outputFlag(fs)
+	if err := parseCommandFlags(fs, args, "student", "teacher-id", "availability-id", "subject"); err != nil {
+		return err
+	}
+	if err := cliAPI.CreateBooking(context.Background(), booking); err != nil {
+		return err
+	}
+	return printOutput(*output, messageOutput("Lesson booked successfully"))
+}
+
+func bookingListCommand(fs *flag.FlagSet, args []string) error {
+	username := fs.String("student", "", "username of the student")
+	output := outputFlag(fs)
+	if err := parseCommandFlags(fs, args, "student"); err != nil {
+		return err
+	}
+	bookings, err := cliAPI.StudentBookings(context.Background(), *username)
+	if err != nil {
+		return err
+	}
+	out := cliOutput{data: bookings, header: []string{"ID", "DAY", "START", "END", "TIME ZONE", "TEACHER", "SUBJECT", "STATUS"}}
+	for i, b := range bookings {
+		startsAt, endsAt := b.StartsAt.In(cliLocation), b.EndsAt().In(cliLocation)
+		bookings[i].StartsAt = startsAt
+		out.rows = append(out.rows, []string{strconv.Itoa(b.ID), startsAt.Format("2006-01-02"), startsAt.Format("15:04"),
+			endsAt.Format("15:04"), startsAt.Format("MST"), b.TeacherName + " " + b.TeacherSurname, b.Subject, b.Status})
+	}
+	return printOutput(*output, out)
+}
+
+// Imports
+
+// importCommand returns the command importing a csv or jsonl file of the type. When rows have errors nothing
+// is saved and they are all listed.
+func importCommand(kind string) func(fs *flag.FlagSet, args []string) error {
+	return func(fs *flag.FlagSet, args []string) error {
+		file := fs.String("file", "", "csv or jsonl file to import")
+		format := fs.String("format", "", "format of the file, csv or jsonl (from the extension of the file when empty)")
+		dryRun := fs.Bool("dry-run", false, "only check the rows, without saving them")
+		output := outputFlag(fs)
+		if err := parseCommandFlags(fs, args, "file"); err != nil {
+			return err
+		}
+		if *format == "" {
+			switch strings.ToLower(filepath.Ext(*file)) {
+			case ".csv":
+				*format = importFormatCSV
+			case ".jsonl", ".ndjson":
+				*format = importFormatJSONL
+			default:
+				return &cliUsageError{"The format of the file need to be given with --format csv|jsonl"}
+			}
+		}
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+
+		report, err := cliAPI.Import(context.Background(), kind, *format, data, *dryRun)
+		if len(report.Errors) == 0 {
+			if err != nil {
+				return err
+			}
+			return printOutput(*output, cliOutput{data: report, header: []string{"MESSAGE"}, rows: [][]string{{report.Message}}})
+		}
+		out := cliOutput{data: report, header: []string{"LINE", "FIELD", "ERROR"}}
+		for _, rowError := range report.Errors {
+			out.rows = append(out.rows, []string{strconv.Itoa(rowError.Line), rowError.Field, rowError.Message})
+		}
+		if printErr := printOutput(*output, out); printErr != nil {
+			return printErr
+		}
+		return err
+	}
+}
+
+// Exports
+
+// exportCommand returns the command exporting the rows of the type, or all the data in json when the type is empty.
+// The passwords are never exported.
+func exportCommand(kind string) func(fs *flag.FlagSet, args []string) error {
+	return func(fs *flag.FlagSet, args []string) error {
+		file := fs.String("file", "", "file to write the export to (stdout when empty)")
+		var output *string
+		if kind == "" {
+			//all the data doesn't fit in a table, so it is printed in json
+			output = fs.String("output", outputJSON, "output format: json only, export a single type for table or csv")
+		} else {
+			output = outputFlag(fs)
+		}
+		if err := parseCommandFlags(fs, args); err != nil {
+			return err
+		}
+		if kind == "" && *output != outputJSON {
+			return &cliUsageError{"All the data can only be exported in json, export a single type for table or csv"}
+		}
+
+		export, err := cliAPI.Export(context.Background())
+		if err != nil {
+			return err
+		}
+		out := cliOutput{data: exportSection(export, kind), rows: exportRows(export, kind)}
+		for _, column := range exportColumns[kind] {
+			out.header = append(out.header, strings.ToUpper(strings.ReplaceAll(column, "_", " ")))
+		}
+		if *file == "" {
+			return printOutput(*output, out)
+		}
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		if err := fprintOutput(f, *output, out); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+}
+
+// Administrators
+
+func adminAddCommand(fs *flag.FlagSet, args []string) error {
+	var admin Admin
+	fs.StringVar(&admin.Username, "username", "", "username of the administrator")
+	fs.StringVar(&admin.Password, "password", "", "password of the administrator")
+	output := outputFlag(fs)
+	if err := parseCommandFlags(fs, args, "username", "password"); err != nil {
+		return err
+	}
+	if err := cliAPI.CreateAdmin(context.Background(), admin); err != nil {
+		return err
+	}
+	return printOutput(*output, messageOutput("Administrator added successfully"))
+}
+
+func adminListCommand(fs *flag.FlagSet, args []string) error {
+	output := outputFlag(fs)
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+	admins, err := cliAPI.ListAdmins(context.Background())
+	if err != nil {
+		return err
+	}
+	out := cliOutput{data: admins, header: []string{"USERNAME", "CREATED BY", "CREATED AT"}}
+	for _, admin := range admins {
+		out.rows = append(out.rows, []string{admin.Username, admin.CreatedBy, admin.CreatedAt.In(cliLocation).Format("2006-01-02 15:04")})
+	}
+	return printOutput(*output, out)
+}
+
+func adminFailedLoginsCommand(fs *flag.FlagSet, args []string) error {
+	username := fs.String("username", "", "only the failed logins of this username")
+	limit := fs.Int("limit", defaultLoginFailuresLimit, "how many of the latest failed logins to list")
+	output := outputFlag(fs)
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+	failures, err := cliAPI.LoginFailures(context.Background(), *username, *limit)
+	if err != nil {
+		return err
+	}
+	out := cliOutput{data: failures, header: []string{"ATTEMPTED AT", "USERNAME", "ROLE", "IP", "REASON"}}
+	for _, failure := range failures {
+		out.rows = append(out.rows, []string{failure.AttemptedAt.In(cliLocation).Format("2006-01-02 15:04:05"), failure.Username, failure.Role, failure.IP, failure.Reason})
+	}
+	return printOutput(*output, out)
+}
+
+// Utils
+
+// outputFlag adds the --output flag to the flags of a command.
+func outputFlag(fs *flag.FlagSet) *string {
+	return fs.String("output", outputTable, "output format: table, json or csv")
+}
+
+// parseCommandFlags parses the flags of a command, checks that the required ones are set and
+// logs the administrator in.
+func parseCommandFlags(fs *flag.FlagSet, args []string, required ...string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &cliUsageError{err.Error()}
+	}
+	if fs.NArg() > 0 {
+		return &cliUsageError{fmt.Sprintf("Unexpected argument %q", fs.Arg(0))}
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var missing []string
+	for _, name := range required {
+		if !set[name] {
+			missing = append(missing, "--"+name)
+		}
+	}
+	if len(missing) > 0 {
+		return &cliUsageError{"Missing " + strings.Join(missing, ", ")}
+	}
+	if output := fs.Lookup("output").Value.String(); output != outputTable && output != outputJSON && output != outputCSV {
+		return &cliUsageError{fmt.Sprintf("Unknown output format %q: use table, json or csv", output)}
+	}
+
+	username := os.Getenv("GOTUTOR_ADMIN_USERNAME")
+	password := os.Getenv("GOTUTOR_ADMIN_PASSWORD")
+	if username == "" || password == "" {
+		return &cliUsageError{"GOTUTOR_ADMIN_USERNAME and GOTUTOR_ADMIN_PASSWORD need to be set"}
+	}
+	if err := loginAdminCached(username, password); err != nil {
+		return fmt.Errorf("Login failed: %w", err)
+	}
+	return nil
+}
+
+// messageOutput is the output of a command that only reports its success.
+func messageOutput(message string) cliOutput {
+	return cliOutput{data: map[string]string{"message": message}, header: []string{"MESSAGE"}, rows: [][]string{{message}}}
+}
+
+// printOutput prints the output of a command on stdout in the format.
+func printOutput(format string, out cliOutput) error {
+	return fprintOutput(os.Stdout, format, out)
+}
+
+// fprintOutput writes the output of a command to w in the format.
+func fprintOutput(w io.Writer, format string, out cliOutput) error {
+	switch format {
+	case outputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(out.data)
+	case outputCSV:
+		writer := csv.NewWriter(w)
+		writer.Write(out.header)
+		writer.WriteAll(out.rows)
+		return writer.Error()
+	default:
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.Join(out.header, "\t"))
+		for _, row := range out.rows {
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		return writer.Flush()
+	}
+}
+
+// isNotFound checks if the error is about a teacher or a student that doesn't exist.
+func isNotFound(err error) bool {
+	var teacherErr *ErrTeacherNotFound
+	var studentErr *ErrStudentNotFound
+	return errors.As(err, &teacherErr) || errors.As(err, &studentErr)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"server/apiclient"
+)
+
+// cliTokenMargin is how long before its expiry a cached token is no longer used, so that it doesn't
+// expire during a command
+const cliTokenMargin = time.Minute
+
+// cachedAdminToken is the token of the administrator kept between the CLI commands, so that every command
+// doesn't log in again and run into the login limits of the API.
+type cachedAdminToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// cliTokenCache is the file of the token the CLI is logged in with, empty when it logged in for this command
+var cliTokenCache string
+
+// adminTokenCachePath returns the file caching the token of the administrator on the API, in the cache
+// directory of the user, named after the API and the username.
+func adminTokenCachePath(baseURL, username string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	key := sha256.Sum256([]byte(baseURL + "\n" + username))
+	return filepath.Join(dir, "gotutor", "admin-token-"+hex.EncodeToString(key[:8])+".json"), nil
+}
+
+// loadAdminToken returns the token cached in the file, if it is still valid for a while.
+func loadAdminToken(path string, now time.Time) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	var cached cachedAdminToken
+	if err := json.Unmarshal(data, &cached); err != nil || cached.Token == "" || !now.Add(cliTokenMargin).Before(cached.ExpiresAt) {
+		return "", false
+	}
+	return cached.Token, true
+}
+
+// saveAdminToken caches the token in the file, readable only by the user.
+func saveAdminToken(path string, login loginResponse) error {
+	data, err := json.Marshal(cachedAdminToken{Token: login.Token, ExpiresAt: login.ExpiresAt})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	//written aside and renamed, so that the commands running at the same time never read half a token
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loginAdminCached logs the administrator into the API with the token cached by a previous command,
+// or logs in and caches the new token. A cache that can't be written only costs the next command a login.
+func loginAdminCached(username, password string) error {
+	path, err := adminTokenCachePath(newAPIClientFromEnv().BaseURL(), username)
+	if err != nil {
+		return loginAdmin(username, password)
+	}
+	if token, found := loadAdminToken(path, time.Now()); found {
+		useAdminToken(newAPIClientFromEnv(), token)
+		cliTokenCache = path
+		return nil
+	}
+	login, err := loginAdminResponse(username, password)
+	if err != nil {
+		return err
+	}
+	saveAdminToken(path, login)
+	return nil
+}
+
+// cachedTokenRejected checks if the API refused the cached token the command ran with, like after a restart
+// of the API with another secret. The cache is then dropped, so that the command can log in again.
+func cachedTokenRejected(err error) bool {
+	if cliTokenCache == "" || !errors.Is(err, apiclient.ErrUnauthorized) {
+		return false
+	}
+	os.Remove(cliTokenCache)
+	cliTokenCache = ""
+	return true
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// setupCLI points the commands of the CLI at the API, as its administrator, with the cache in a temporary
+// directory and the output discarded.
+func setupCLI(t *testing.T, api *testAPI) {
+	t.Helper()
+	server := httptest.NewServer(api.router)
+	t.Cleanup(server.Close)
+	t.Setenv("GOTUTOR_API_URL", server.URL+"/api")
+	t.Setenv("GOTUTOR_ADMIN_USERNAME", testAdminUsername)
+	t.Setenv("GOTUTOR_ADMIN_PASSWORD", testAdminPassword)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	stdout, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = stdout
+	t.Cleanup(func() {
+		os.Stdout = saved
+		stdout.Close()
+		cliTokenCache = ""
+	})
+}
+
+func TestCLICommandsReuseTheAdminToken(t *testing.T) {
+	api := newTestAPIWithLogins(t, loginPolicy{IPLimit: 2})
+	setupCLI(t, api)
+
+	//more commands than the logins allowed a minute
+	for i := 0; i < 5; i++ {
+		if code := runCLICommand([]string{"admin", "list"}); code != exitOK {
+			t.Fatalf("command %d exited with %d", i+1, code)
+		}
+	}
+}
+
+func TestCLILogsInAgainWhenTheCachedTokenIsRejected(t *testing.T) {
+	api := newTestAPI(t)
+	setupCLI(t, api)
+
+	path, err := adminTokenCachePath(os.Getenv("GOTUTOR_API_URL"), testAdminUsername)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//a token signed with the secret of a previous run of the API
+	if err := saveAdminToken(path, loginResponse{Token: "stale.token", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if code := runCLICommand([]string{"admin", "list"}); code != exitOK {
+		t.Fatalf("command exited with %d", code)
+	}
+	token, found := loadAdminToken(path, time.Now())
+	if !found || token == "stale.token" {
+		t.Fatalf("got cached token %q, want the new one", token)
+	}
+}
+
+func TestExpiredAdminTokenIsNotReused(t *testing.T) {
+	path := t.TempDir() + "/token.json"
+	if err := saveAdminToken(path, loginResponse{Token: "token", ExpiresAt: time.Now().Add(30 * time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := loadAdminToken(path, time.Now()); found {
+		t.Error("a token expiring within the margin was reused")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log"
+	"net/http"
+)
+
+// csrfFieldName is the hidden field of the forms carrying the CSRF token
+const csrfFieldName = "csrf_token"
+
+// csrfCookieName is the cookie holding the CSRF token of the visitors who are not logged in
+const csrfCookieName = "csrf_token"
+
+// anonymousForms are the paths the forms of the visitors who are not logged in are posted to: the logins,
+// the registration and the password resets. Only they accept the token of the csrf_token cookie.
+var anonymousForms = map[string]bool{
+	"/profile":          true,
+	"/teacher/portal":   true,
+	"/admin":            true,
+	"/userregistration": true,
+	"/forgotPassword":   true,
+	"/resetPassword":    true,
+}
+
+// newCSRFToken returns a random token to put in the forms.
+func newCSRFToken() string {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		log.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// anonymousCSRFToken returns the CSRF token of a visitor who is not logged in, used by the login and
+// registration forms. It is kept in a cookie that only this site can read, and set on the first visit.
+func anonymousCSRFToken(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(csrfCookieName); err == nil && c.Value != "" {
+		return c.Value
+	}
+	token := newCSRFToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
+
+// formCSRFToken returns the CSRF token of the login and registration forms: the token of the session when the
+// visitor is already logged in, since only that one is accepted then, otherwise the anonymous one.
+func formCSRFToken(w http.ResponseWriter, r *http.Request) string {
+	if userSession, loggedIn, err := requestSession(r); err == nil && loggedIn {
+		return userSession.csrfToken
+	}
+	return anonymousCSRFToken(w, r)
+}
+
+// csrfProtect rejects the requests changing something whose form doesn't carry the CSRF token of the
+// session, or of the visitor when they are not logged in and post one of the anonymousForms. A page of
+// another site can make the browser send the cookies, but it can't read the token to put in the form.
+func csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !hasValidCSRFToken(r) {
+			http.Error(w, "Forbidden: invalid CSRF token", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hasValidCSRFToken checks the token of the form against the session when the visitor is logged in,
+// otherwise against the anonymous cookie.
+func hasValidCSRFToken(r *http.Request) bool {
+	token := r.PostFormValue(csrfFieldName)
+	if token == "" {
+		return false
+	}
+	userSession, loggedIn, err := requestSession(r)
+	if err != nil {
+		return false
+	}
+	if loggedIn {
+		//the anonymous token can't stand in for the one of the session
+		return sameToken(userSession.csrfToken, token)
+	}
+	if !anonymousForms[r.URL.Path] {
+		return false
+	}
+	c, err := r.Cookie(csrfCookieName)
+	return err == nil && sameToken(c.Value, token)
+}
+
+// requestSession returns the session of the cookie of the request, and false when there is no cookie or the
+// session doesn't exist or has expired.
+func requestSession(r *http.Request) (Session, bool, error) {
+	c, err := r.Cookie("session_token")
+	if err != nil {
+		return Session{}, false, nil
+	}
+	userSession, exists, err := webSessions.Session(c.Value)
+	if err != nil || !exists || userSession.isExpired() {
+		return Session{}, false, err
+	}
+	return userSession, true, nil
+}
+
+// sameToken compares two tokens in constant time. Empty tokens never match.
+func sameToken(expected, actual string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) == 1
+}
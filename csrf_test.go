@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testWebSessions replaces the sessions of the web server with empty ones for the test.
+func testWebSessions(t *testing.T) {
+	saved := webSessions
+	webSessions = newMemorySessionStore()
+	t.Cleanup(func() { webSessions = saved })
+}
+
+// addTestSession saves a session of the student and returns the token of its cookie.
+func addTestSession(t *testing.T, username string) (sessionToken string, userSession Session) {
+	t.Helper()
+	sessionToken = newCSRFToken()
+	userSession = Session{username: username, role: roleStudent, csrfToken: newCSRFToken(), expiry: time.Now().Add(time.Hour)}
+	if err := webSessions.SaveSession(sessionToken, userSession); err != nil {
+		t.Fatal(err)
+	}
+	return sessionToken, userSession
+}
+
+// postForm posts the form with the CSRF token through csrfProtect and returns the status, with the cookies set.
+func postForm(path, csrfToken string, cookies ...*http.Cookie) int {
+	form := url.Values{}
+	if csrfToken != "" {
+		form.Set(csrfFieldName, csrfToken)
+	}
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	csrfProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(recorder, request)
+	return recorder.Code
+}
+
+func TestCSRFTokenOfTheSession(t *testing.T) {
+	testWebSessions(t)
+	sessionToken, userSession := addTestSession(t, "alice")
+	session := &http.Cookie{Name: "session_token", Value: sessionToken}
+
+	if status := postForm("/deleteBooking", userSession.csrfToken, session); status != http.StatusOK {
+		t.Errorf("the token of the session got %d", status)
+	}
+	if status := postForm("/deleteBooking", "", session); status != http.StatusForbidden {
+		t.Errorf("a form without token got %d", status)
+	}
+	_, otherSession := addTestSession(t, "bob")
+	if status := postForm("/deleteBooking", otherSession.csrfToken, session); status != http.StatusForbidden {
+		t.Errorf("the token of another session got %d", status)
+	}
+}
+
+func TestAnonymousCSRFTokenIsRefusedWhenLoggedIn(t *testing.T) {
+	testWebSessions(t)
+	sessionToken, _ := addTestSession(t, "alice")
+	session := &http.Cookie{Name: "session_token", Value: sessionToken}
+
+	//a forged form with a token of its own, and the same token in the cookie set by another page of the site
+	forged := newCSRFToken()
+	anonymous := &http.Cookie{Name: csrfCookieName, Value: forged}
+	for _, path := range []string{"/deleteBooking", "/profile"} {
+		if status := postForm(path, forged, session, anonymous); status != http.StatusForbidden {
+			t.Errorf("the anonymous token on %s got %d", path, status)
+		}
+	}
+}
+
+func TestAnonymousCSRFTokenOnlyPostsTheAnonymousForms(t *testing.T) {
+	testWebSessions(t)
+	token := newCSRFToken()
+	anonymous := &http.Cookie{Name: csrfCookieName, Value: token}
+
+	for _, path := range []string{"/profile", "/userregistration", "/teacher/portal"} {
+		if status := postForm(path, token, anonymous); status != http.StatusOK {
+			t.Errorf("the anonymous token on %s got %d", path, status)
+		}
+	}
+	for _, path := range []string{"/deleteBooking", "/teacher/addAvailability"} {
+		if status := postForm(path, token, anonymous); status != http.StatusForbidden {
+			t.Errorf("the anonymous token on %s got %d", path, status)
+		}
+	}
+	if status := postForm("/userregistration", newCSRFToken(), anonymous); status != http.StatusForbidden {
+		t.Errorf("a token other than the cookie got %d", status)
+	}
+}
+
+func TestFormCSRFTokenOfLoggedInVisitor(t *testing.T) {
+	testWebSessions(t)
+	sessionToken, userSession := addTestSession(t, "alice")
+	request := httptest.NewRequest(http.MethodGet, "/login", nil)
+	request.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+
+	if token := formCSRFToken(httptest.NewRecorder(), request); token != userSession.csrfToken {
+		t.Errorf("the login form of a logged in visitor got %q, want the token of the session", token)
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mattn/go-sqlite3"
@@ -12,83 +15,70 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-var db *sql.DB
+// dbExecutor is implemented by both *sql.DB and *sql.Tx, so that the helpers
+// below can be used inside and outside a transaction.
+type dbExecutor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// isUniqueViolation checks if the error is a unique or primary key constraint failing, like a username
+// already taken. The other constraints, like a missing NOT NULL value, are not about a duplicate.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+// isDatabaseFailure checks if the error comes from the database itself, like a busy or unreadable file,
+// rather than from the rows being refused by a constraint.
+func isDatabaseFailure(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code != sqlite3.ErrConstraint
+}
+
+// databasePath is the SQLite file used by the API server
+const databasePath = "database.db"
 
 // Database setup and connection
 func initializeDatabase() {
 	fmt.Println("Database connection...")
-	connectToDB()
+	db, err := openDatabase(databasePath)
+	if err != nil {
+		log.Fatal(err)
+	}
 	defer db.Close()
 
-	createTables()
-}
-
-func connectToDB() {
-	var err error
-	db, err = sql.Open("sqlite3", "database.db")
+	// bring the schema up to date with the pending migrations
+	run, err := migrateUp(db)
+	for _, m := range run {
+		fmt.Printf("Applied migration %d: %s\n", m.Version, m.Name)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
-func createTables() {
-	tables := []string{
-		`CREATE TABLE IF NOT EXISTS students (
-			Name TEXT NOT NULL,
-			Surname TEXT NOT NULL,
-			DateOfBirth DATE NOT NULL,
-			Username TEXT NOT NULL UNIQUE,
-			Password TEXT NOT NULL,
-			PRIMARY KEY (Username)
-		)`,
-		`CREATE TABLE IF NOT EXISTS teachers (
-			ID INTEGER PRIMARY KEY AUTOINCREMENT,
-			Name TEXT NOT NULL,
-			Surname TEXT NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS availabilities (
-			ID INTEGER PRIMARY KEY AUTOINCREMENT,
-			TeacherID INTEGER NOT NULL,
-			Day DATE NOT NULL,
-			StartingTime DATE NOT NULL,
-			EndingTime DATE NOT NULL,
-			Booked BOOLEAN NOT NULL,
-			FOREIGN KEY (TeacherID) REFERENCES teachers(ID)
-		)`,
-		`CREATE TABLE IF NOT EXISTS bookings (
-			ID INTEGER PRIMARY KEY AUTOINCREMENT,
-			StudentUsername TEXT NOT NULL,
-			TeacherID INTEGER NOT NULL,
-			AvailabilityID INTEGER NOT NULL,
-			Subject TEXT NOT NULL,
-			FOREIGN KEY (StudentUsername) REFERENCES students(Username),
-			FOREIGN KEY (TeacherID) REFERENCES teachers(ID),
-			FOREIGN KEY (AvailabilityID) REFERENCES availabilities(ID)
-		)`,
-	}
-
-	for _, table := range tables {
-		err := createTableIfNotExists(db, table)
-		if err != nil {
-			printMessage("Error creating table: " + err.Error())
-			return
-		}
-	}
+// openDatabase opens the SQLite database stored in the given file.
+func openDatabase(path string) (*sql.DB, error) {
+	// _txlock=immediate takes the write lock when a transaction begins and
+	// _busy_timeout makes concurrent writers wait for it instead of failing
+	return sql.Open("sqlite3", path+"?_txlock=immediate&_busy_timeout=5000")
 }
 
-func createTableIfNotExists(db *sql.DB, tableDefinition string) error {
-	_, err := db.Exec(fmt.Sprintf(`
-		%s
-	`, tableDefinition))
-	return err
+// openReadOnlyDatabase opens the SQLite database stored in the given file for reading only. Its transactions
+// are deferred: they don't take the write lock, so the API keeps writing while they read.
+func openReadOnlyDatabase(path string) (*sql.DB, error) {
+	return sql.Open("sqlite3", "file:"+path+"?mode=ro&_busy_timeout=5000")
 }
 
 // Getters methods
 // getAvailabilityByID returns the availability
-func getAvailabilityByID(db *sql.DB, id int) (Availability, error) {
+func getAvailabilityByID(db dbExecutor, id int) (Availability, error) {
 	var availability Availability
-	row := db.QueryRow("SELECT ID, Day, StartingTime, EndingTime, Booked FROM availabilities WHERE ID =?", id)
-	err := row.Scan(&availability.ID, &availability.Day, &availability.StartingTime, &availability.EndingTime, &availability.Booked)
+	row := db.QueryRow("SELECT ID, StartsAt, DurationMinutes, Booked, Subject FROM availabilities WHERE ID =?", id)
+	err := row.Scan(&availability.ID, &availability.StartsAt, &availability.DurationMinutes, &availability.Booked, &availability.Subject)
 	return availability, err
 }
 
@@ -121,9 +111,10 @@ func getTeacherAvailabilities(db *sql.DB, teacherID int) ([]Availability, error)
 	var availabilities []Availability
 
 	rows, err := db.Query(`
-		SELECT ID, Day, StartingTime, EndingTime, Booked
+		SELECT ID, StartsAt, DurationMinutes, Booked, COALESCE(RuleID, 0), Subject, Sequence
 		FROM availabilities
 		WHERE TeacherID = ?
+		ORDER BY StartsAt
 	`, teacherID)
 
 	if err != nil {
@@ -133,7 +124,7 @@ func getTeacherAvailabilities(db *sql.DB, teacherID int) ([]Availability, error)
 
 	for rows.Next() {
 		var availability Availability
-		err := rows.Scan(&availability.ID, &availability.Day, &availability.StartingTime, &availability.EndingTime, &availability.Booked)
+		err := rows.Scan(&availability.ID, &availability.StartsAt, &availability.DurationMinutes, &availability.Booked, &availability.RuleID, &availability.Subject, &availability.Sequence)
 		if err != nil {
 			return nil, err
 		}
@@ -147,11 +138,37 @@ func getTeacherAvailabilities(db *sql.DB, teacherID int) ([]Availability, error)
 	return availabilities, nil
 }
 
+// getDeletedTeacherAvailabilities retrieves the availabilities a teacher deleted from the database,
+// with the sequence of their deletion.
+func getDeletedTeacherAvailabilities(db *sql.DB, teacherID int) ([]Availability, error) {
+	rows, err := db.Query(`
+		SELECT ID, StartsAt, DurationMinutes, Subject, Sequence
+		FROM deleted_availabilities
+		WHERE TeacherID = ?
+		ORDER BY StartsAt
+	`, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var availabilities []Availability
+	for rows.Next() {
+		var availability Availability
+		if err := rows.Scan(&availability.ID, &availability.StartsAt, &availability.DurationMinutes, &availability.Subject, &availability.Sequence); err != nil {
+			return nil, err
+		}
+		availabilities = append(availabilities, availability)
+	}
+
+	return availabilities, rows.Err()
+}
+
 // getAllTeachers retrieves all teachers from the database.
-func getAllTeachers(db *sql.DB) ([]Teacher, error) {
+func getAllTeachers(db dbExecutor) ([]Teacher, error) {
 	var teachers []Teacher
 
-	rows, err := db.Query("SELECT ID, Name, Surname FROM teachers")
+	rows, err := db.Query("SELECT ID, Name, Surname, COALESCE(Username, ''), TimeZone, Email FROM teachers")
 	if err != nil {
 		return nil, err
 	}
@@ -159,7 +176,7 @@ func getAllTeachers(db *sql.DB) ([]Teacher, error) {
 
 	for rows.Next() {
 		var teacher Teacher
-		err := rows.Scan(&teacher.ID, &teacher.Name, &teacher.Surname)
+		err := rows.Scan(&teacher.ID, &teacher.Name, &teacher.Surname, &teacher.Username, &teacher.TimeZone, &teacher.Email)
 		if err != nil {
 			return nil, err
 		}
@@ -170,11 +187,20 @@ func getAllTeachers(db *sql.DB) ([]Teacher, error) {
 		return nil, err
 	}
 
+	subjects, err := getSubjectsByTeacher(db)
+	if err != nil {
+		return nil, err
+	}
+	for i := range teachers {
+		teachers[i].Subjects = subjects[teachers[i].ID]
+	}
+
 	return teachers, nil
 }
 
-// getTeacherAvailabilitiesByID retrieves the bookings of a teacher by their ID from the database.
-func getTeacherAvailabilitiesByID(db *sql.DB, teacherID int) ([]Availability, error) {
+// getTeacherAvailabilitiesByID retrieves the bookings of a teacher by their ID from the database,
+// together with the student who booked each lesson.
+func getTeacherAvailabilitiesByID(db *sql.DB, teacherID int) ([]TeacherLesson, error) {
 	isPresent, err := isTeacherExists(db, teacherID)
 	if err != nil {
 		return nil, err
@@ -182,13 +208,17 @@ func getTeacherAvailabilitiesByID(db *sql.DB, teacherID int) ([]Availability, er
 	if !isPresent {
 		return nil, &ErrTeacherNotFound{TeacherID: teacherID}
 	}
-	var availabilities []Availability
+	var lessons []TeacherLesson
 
 	rows, err := db.Query(`
-        SELECT ID, Day, StartingTime, EndingTime, Booked
-        FROM availabilities
-        WHERE TeacherID = ? AND Booked = 1
-    `, teacherID)
+        SELECT a.ID, a.StartsAt, a.DurationMinutes, a.Booked,
+            b.ID, b.StudentUsername, s.Name, s.Surname, b.Subject, b.Status
+        FROM availabilities a
+        JOIN bookings b ON b.AvailabilityID = a.ID
+        JOIN students s ON s.Username = b.StudentUsername
+        WHERE a.TeacherID = ? AND a.Booked = 1 AND b.Status NOT IN (?, ?)
+        ORDER BY a.StartsAt
+    `, teacherID, bookingCancelledByStudent, bookingCancelledByTeacher)
 
 	if err != nil {
 		return nil, err
@@ -196,26 +226,63 @@ func getTeacherAvailabilitiesByID(db *sql.DB, teacherID int) ([]Availability, er
 	defer rows.Close()
 
 	for rows.Next() {
-		var availability Availability
-		err := rows.Scan(&availability.ID, &availability.Day, &availability.StartingTime, &availability.EndingTime, &availability.Booked)
+		var lesson TeacherLesson
+		err := rows.Scan(&lesson.ID, &lesson.StartsAt, &lesson.DurationMinutes, &lesson.Booked,
+			&lesson.BookingID, &lesson.StudentUsername, &lesson.StudentName, &lesson.StudentSurname, &lesson.Subject, &lesson.Status)
 		if err != nil {
 			return nil, err
 		}
-		availabilities = append(availabilities, availability)
+		lessons = append(lessons, lesson)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return availabilities, nil
+	return lessons, nil
+}
+
+// getTeacherByID retrieves a teacher, including the hashed password, by their ID from the database.
+func getTeacherByID(db *sql.DB, teacherID int) (Teacher, error) {
+	var teacher Teacher
+	row := db.QueryRow(`
+        SELECT ID, Name, Surname, COALESCE(Username, ''), COALESCE(Password, ''), TimeZone, Email
+        FROM teachers
+        WHERE ID = ?
+    `, teacherID)
+	err := row.Scan(&teacher.ID, &teacher.Name, &teacher.Surname, &teacher.Username, &teacher.Password, &teacher.TimeZone, &teacher.Email)
+	if err == sql.ErrNoRows {
+		return Teacher{}, &ErrTeacherNotFound{TeacherID: teacherID}
+	} else if err != nil {
+		return Teacher{}, err
+	}
+	teacher.Subjects, err = getTeacherSubjects(db, teacher.ID)
+	return teacher, err
+}
+
+// getTeacherByUsername retrieves a teacher, including the hashed password, by their username from the database.
+func getTeacherByUsername(db *sql.DB, username string) (Teacher, error) {
+	var teacher Teacher
+	row := db.QueryRow(`
+        SELECT ID, Name, Surname, Username, Password, TimeZone, Email
+        FROM teachers
+        WHERE Username = ?
+    `, username)
+	err := row.Scan(&teacher.ID, &teacher.Name, &teacher.Surname, &teacher.Username, &teacher.Password, &teacher.TimeZone, &teacher.Email)
+	if err == sql.ErrNoRows {
+		return Teacher{}, &ErrTeacherNotFound{Username: username}
+	} else if err != nil {
+		return Teacher{}, err
+	}
+	teacher.Subjects, err = getTeacherSubjects(db, teacher.ID)
+	return teacher, err
 }
 
 // getAllStudents retrieves all students from the database.
-func getAllStudents(db *sql.DB) ([]Student, error) {
+func getAllStudents(db dbExecutor) ([]Student, error) {
 	var students []Student
 
-	rows, err := db.Query("SELECT * FROM students")
+	rows, err := db.Query("SELECT Name, Surname, DateOfBirth, Username, Password, TimeZone, Email FROM students")
 	if err != nil {
 		return nil, err
 	}
@@ -223,7 +290,7 @@ func getAllStudents(db *sql.DB) ([]Student, error) {
 
 	for rows.Next() {
 		var student Student
-		err := rows.Scan(&student.Name, &student.Surname, &student.DateOfBirth, &student.Username, &student.Password)
+		err := rows.Scan(&student.Name, &student.Surname, &student.DateOfBirth, &student.Username, &student.Password, &student.TimeZone, &student.Email)
 		if err != nil {
 			return nil, err
 		}
@@ -241,9 +308,11 @@ func getAllStudents(db *sql.DB) ([]Student, error) {
 func getStudentByUsername(db *sql.DB, username string) (Student, error) {
 	var student Student
 	var date time.Time
+	//the students registered before the times were saved have none
+	var passwordChangedAt sql.NullTime
 
-	row := db.QueryRow("SELECT * FROM students WHERE Username =?", username)
-	err := row.Scan(&student.Name, &student.Surname, &date, &student.Username, &student.Password)
+	row := db.QueryRow("SELECT Name, Surname, DateOfBirth, Username, Password, TimeZone, Email, PasswordChangedAt FROM students WHERE Username =?", username)
+	err := row.Scan(&student.Name, &student.Surname, &date, &student.Username, &student.Password, &student.TimeZone, &student.Email, &passwordChangedAt)
 
 	if err == sql.ErrNoRows {
 		// No student found with the specified username
@@ -258,46 +327,143 @@ func getStudentByUsername(db *sql.DB, username string) (Student, error) {
 	if err != nil {
 		return Student{}, err
 	}
+	student.PasswordChangedAt = passwordChangedAt.Time
 
 	return student, nil
 }
 
-// deleteBookingByID deletes a booking by its ID from the database.
-func deleteBookingByID(db *sql.DB, id string) (string, error) {
-	var availabilityID int
-	var studentUsername string
-
+// getBookingByID retrieves a booking by its ID from the database.
+func getBookingByID(db *sql.DB, id string) (LessonReservation, error) {
+	var booking LessonReservation
+	var cancelledAt sql.NullTime
 	row := db.QueryRow(`
-        SELECT AvailabilityID, StudentUsername
+        SELECT ID, StudentUsername, TeacherID, AvailabilityID, Subject, StartsAt, DurationMinutes,
+            Status, CancelledBy, CancellationReason, CancelledAt
         FROM bookings
-        WHERE ID =?
+        WHERE ID = ?
     `, id)
-	err := row.Scan(&availabilityID, &studentUsername)
+	err := row.Scan(&booking.ID, &booking.StudentUsername, &booking.TeacherID, &booking.AvailabilityID, &booking.Subject,
+		&booking.StartsAt, &booking.DurationMinutes, &booking.Status, &booking.CancelledBy, &booking.CancellationReason, &cancelledAt)
+	if err == sql.ErrNoRows {
+		return LessonReservation{}, ErrBookingNotFound
+	}
+	booking.CancelledAt = timeOrNil(cancelledAt)
+	return booking, err
+}
+
+// cancelBooking sets the cancelled status of a booking, records who cancelled it and why,
+// and frees its availability so that it can be booked again.
+func cancelBooking(db *sql.DB, id string, status string, cancellation BookingCancellation) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return "", err
+		return err
+	}
+	defer tx.Rollback()
+
+	// Only the bookings still booked can be cancelled
+	result, err := tx.Exec(`
+        UPDATE bookings
+        SET Status = ?, CancelledBy = ?, CancellationReason = ?, CancelledAt = ?
+        WHERE ID = ? AND Status = ?
+    `, status, cancellation.CancelledBy, cancellation.CancellationReason, cancellation.CancelledAt.UTC(), id, bookingBooked)
+	if err != nil {
+		return err
+	}
+	if err := checkBookingUpdated(tx, result, id); err != nil {
+		return err
 	}
 
-	// Update availability status booked to false
-	stmt, err := db.Prepare("UPDATE availabilities SET Booked = 0 WHERE ID =?")
+	_, err = tx.Exec("UPDATE availabilities SET Booked = 0, Sequence = Sequence + 1 WHERE ID = (SELECT AvailabilityID FROM bookings WHERE ID = ?)", id)
 	if err != nil {
-		return "", err
+		return err
 	}
-	_, err = stmt.Exec(availabilityID)
+
+	return tx.Commit()
+}
+
+// updateBookingStatus marks a booked lesson as completed or as a no-show. The availability stays booked.
+func updateBookingStatus(db *sql.DB, id string, status string) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return "", err
+		return err
 	}
+	defer tx.Rollback()
 
-	// Delete the booking
-	stmt, err = db.Prepare("DELETE FROM bookings WHERE id =?")
+	result, err := tx.Exec("UPDATE bookings SET Status = ? WHERE ID = ? AND Status = ?", status, id, bookingBooked)
 	if err != nil {
-		return "", err
+		return err
+	}
+	if err := checkBookingUpdated(tx, result, id); err != nil {
+		return err
 	}
-	_, err = stmt.Exec(id)
+
+	return tx.Commit()
+}
+
+// checkBookingUpdated tells apart, when an update of a booked lesson affected no rows,
+// a booking that doesn't exist from one that is no longer booked.
+func checkBookingUpdated(db dbExecutor, result sql.Result, id string) error {
+	updated, err := result.RowsAffected()
 	if err != nil {
-		return "", err
+		return err
+	}
+	if updated > 0 {
+		return nil
+	}
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM bookings WHERE ID = ?)", id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrBookingNotFound
+	}
+	return ErrBookingClosed
+}
+
+// getBookingsStartingBetween retrieves the lessons still booked starting in [from, to), the first ones first.
+func getBookingsStartingBetween(db *sql.DB, from, to time.Time) ([]LessonReservation, error) {
+	return queryReservations(db, `
+        SELECT ID, StudentUsername, TeacherID, AvailabilityID, Subject, StartsAt, DurationMinutes, Status
+        FROM bookings
+        WHERE Status = ? AND julianday(StartsAt) >= julianday(?) AND julianday(StartsAt) < julianday(?)
+        ORDER BY StartsAt, ID
+    `, bookingBooked, from.UTC(), to.UTC())
+}
+
+// queryReservations runs a query selecting the ID, the student, the teacher, the availability, the subject,
+// the start, the duration and the status of bookings, and reads them.
+func queryReservations(db dbExecutor, query string, args ...any) ([]LessonReservation, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookings []LessonReservation
+	for rows.Next() {
+		var booking LessonReservation
+		err := rows.Scan(&booking.ID, &booking.StudentUsername, &booking.TeacherID, &booking.AvailabilityID, &booking.Subject,
+			&booking.StartsAt, &booking.DurationMinutes, &booking.Status)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, booking)
 	}
 
-	return studentUsername, nil
+	return bookings, rows.Err()
+}
+
+// completeBookingsEndedBefore marks as completed the lessons still booked that ended before the given time.
+func completeBookingsEndedBefore(db *sql.DB, before time.Time) (int, error) {
+	result, err := db.Exec(`
+        UPDATE bookings SET Status = ?
+        WHERE Status = ? AND julianday(StartsAt, '+' || DurationMinutes || ' minutes') < julianday(?)
+    `, bookingCompleted, bookingBooked, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	completed, err := result.RowsAffected()
+	return int(completed), err
 }
 
 // getStudentBookingsByUsername retrieves the bookings of a student by their username from the database.
@@ -314,22 +480,25 @@ func getStudentBookingsByUsername(db *sql.DB, studentUsername string) ([]LessonB
 	query := `
         SELECT
             b.ID AS id,
-            a.Day AS day,
-            a.StartingTime AS starting_time,
-            a.EndingTime AS ending_time,
+            b.StartsAt AS starts_at,
+            b.DurationMinutes AS duration_minutes,
             t.Name AS teacher_name,
             t.Surname AS teacher_surname,
-            b.Subject AS subject
+            b.Subject AS subject,
+            b.Status AS status,
+            b.CancelledBy AS cancelled_by,
+            b.CancellationReason AS cancellation_reason,
+            b.CancelledAt AS cancelled_at
         FROM
             bookings b
-        JOIN
-            availabilities a ON b.AvailabilityID = a.ID
         JOIN
             teachers t ON b.TeacherID = t.ID
         JOIN
             students u ON b.StudentUsername = u.Username
         WHERE
-            u.Username = ?;
+            u.Username = ?
+        ORDER BY
+            b.StartsAt;
     `
 
 	rows, err := db.Query(query, studentUsername)
@@ -343,11 +512,14 @@ func getStudentBookingsByUsername(db *sql.DB, studentUsername string) ([]LessonB
 
 	for rows.Next() {
 		var booking LessonBooked
+		var cancelledAt sql.NullTime
 		// Scan and parse the data
-		err := rows.Scan(&booking.ID, &booking.Day, &booking.StartingTime, &booking.EndingTime, &booking.TeacherName, &booking.TeacherSurname, &booking.Subject)
+		err := rows.Scan(&booking.ID, &booking.StartsAt, &booking.DurationMinutes, &booking.TeacherName, &booking.TeacherSurname, &booking.Subject,
+			&booking.Status, &booking.CancelledBy, &booking.CancellationReason, &cancelledAt)
 		if err != nil {
 			return nil, err
 		}
+		booking.CancelledAt = timeOrNil(cancelledAt)
 		bookings = append(bookings, booking)
 	}
 
@@ -358,19 +530,148 @@ func getStudentBookingsByUsername(db *sql.DB, studentUsername string) ([]LessonB
 	return bookings, nil
 }
 
+// exportData reads all the data inside a single read-only transaction, so that the bookings of the export
+// always match its availabilities, even while the API is writing. The db needs to be opened with
+// openReadOnlyDatabase, an immediate transaction would hold the write lock during the whole export.
+func exportData(db *sql.DB) (DataExport, error) {
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return DataExport{}, err
+	}
+	defer tx.Rollback()
+
+	export := DataExport{ExportedAt: time.Now().UTC()}
+	if export.Teachers, err = getAllTeachers(tx); err != nil {
+		return DataExport{}, err
+	}
+	if export.Students, err = getAllStudents(tx); err != nil {
+		return DataExport{}, err
+	}
+	for i := range export.Students {
+		export.Students[i].Password = ""
+	}
+	if export.Availabilities, err = getAllAvailabilities(tx); err != nil {
+		return DataExport{}, err
+	}
+	if export.Bookings, err = getAllBookings(tx); err != nil {
+		return DataExport{}, err
+	}
+	return export, nil
+}
+
+// getAllAvailabilities retrieves the availabilities of all the teachers from the database.
+func getAllAvailabilities(db dbExecutor) ([]ExportedAvailability, error) {
+	rows, err := db.Query(`
+		SELECT TeacherID, ID, StartsAt, DurationMinutes, Booked, COALESCE(RuleID, 0), Subject
+		FROM availabilities
+		ORDER BY ID
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var availabilities []ExportedAvailability
+	for rows.Next() {
+		var a ExportedAvailability
+		err := rows.Scan(&a.TeacherID, &a.ID, &a.StartsAt, &a.DurationMinutes, &a.Booked, &a.RuleID, &a.Subject)
+		if err != nil {
+			return nil, err
+		}
+		availabilities = append(availabilities, a)
+	}
+
+	return availabilities, rows.Err()
+}
+
+// getAllBookings retrieves all the bookings from the database, cancelled ones included.
+func getAllBookings(db dbExecutor) ([]LessonReservation, error) {
+	rows, err := db.Query(`
+        SELECT ID, StudentUsername, TeacherID, AvailabilityID, Subject, StartsAt, DurationMinutes,
+            Status, CancelledBy, CancellationReason, CancelledAt
+        FROM bookings
+        ORDER BY ID
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookings []LessonReservation
+	for rows.Next() {
+		var booking LessonReservation
+		var cancelledAt sql.NullTime
+		err := rows.Scan(&booking.ID, &booking.StudentUsername, &booking.TeacherID, &booking.AvailabilityID, &booking.Subject,
+			&booking.StartsAt, &booking.DurationMinutes, &booking.Status, &booking.CancelledBy, &booking.CancellationReason, &cancelledAt)
+		if err != nil {
+			return nil, err
+		}
+		booking.CancelledAt = timeOrNil(cancelledAt)
+		bookings = append(bookings, booking)
+	}
+
+	return bookings, rows.Err()
+}
+
 // Insert methods
 
 // insertTeacher inserts a new teacher into the database.
-func insertTeacher(db *sql.DB, teacher Teacher) error {
-	_, err := db.Exec(`
-		INSERT INTO teachers (Name, Surname)
-		VALUES (?, ?)
-	`, teacher.Name, teacher.Surname)
+// A teacher with a username gets an account, and their password is stored hashed.
+func insertTeacher(db dbExecutor, teacher Teacher) error {
+	// Teachers without an account keep NULL credentials
+	var username, password any
+	if teacher.Username != "" {
+		if teacher.Password == "" {
+			return ErrTeacherPasswordRequired
+		}
+		hashedPassword, err := hashPassword(teacher.Password)
+		if err != nil {
+			return err
+		}
+		username, password = teacher.Username, hashedPassword
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO teachers (Name, Surname, Username, Password, TimeZone, Email)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, teacher.Name, teacher.Surname, username, password, timeZoneOrUTC(teacher.TimeZone), teacher.Email)
+
+	if err != nil {
+		// Check if the error is due to a unique constraint violation
+		if isUniqueViolation(err) {
+			return ErrUsernameTaken
+		}
+		return err
+	}
+
+	if len(teacher.Subjects) == 0 {
+		return nil
+	}
+	teacherID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	_, err = setTeacherSubjects(db, int(teacherID), teacher.Subjects)
 	return err
 }
 
+// createTeacher inserts a new teacher together with their subjects, in a single transaction.
+func createTeacher(db *sql.DB, teacher Teacher) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertTeacher(tx, teacher); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 // insertAvailability inserts a new availability for a teacher into the database.
-func insertAvailability(db *sql.DB, availability Availability, teacherID int) error {
+// When the availability comes from a recurrence rule, RuleID links it to the rule.
+func insertAvailability(db dbExecutor, availability Availability, teacherID int) error {
 	// Check if the teacher exists
 	isPresent, err := isTeacherExists(db, teacherID)
 	if err != nil {
@@ -381,17 +682,15 @@ func insertAvailability(db *sql.DB, availability Availability, teacherID int) er
 		return &ErrTeacherNotFound{TeacherID: teacherID}
 	}
 
-	// Check for overlapping availabilities
+	// Check for overlapping availabilities, comparing the instants whatever the day
 	var count int
 	err = db.QueryRow(`
 		SELECT COUNT(*)
 		FROM availabilities
-		WHERE TeacherID = ? AND Day = ? AND (
-			(StartingTime <= ? AND EndingTime > ?) OR
-			(StartingTime < ? AND EndingTime >= ?) OR
-			(StartingTime >= ? AND EndingTime <= ?)
-		)
-	`, teacherID, availability.Day, availability.StartingTime, availability.StartingTime, availability.EndingTime, availability.EndingTime, availability.StartingTime, availability.EndingTime).Scan(&count)
+		WHERE TeacherID = ? AND
+			julianday(StartsAt) < julianday(?) AND
+			julianday(StartsAt, '+' || DurationMinutes || ' minutes') > julianday(?)
+	`, teacherID, availability.EndsAt().UTC(), availability.StartsAt.UTC()).Scan(&count)
 
 	if err != nil {
 		return err
@@ -399,159 +698,1332 @@ func insertAvailability(db *sql.DB, availability Availability, teacherID int) er
 
 	if count > 0 {
 		// Overlapping availabilities
-		return errors.New("Overlapping availabilities")
+		return ErrOverlappingAvailabilities
+	}
+
+	// Availabilities added by hand have no rule
+	var ruleID any
+	if availability.RuleID != 0 {
+		ruleID = availability.RuleID
 	}
 
 	_, err = db.Exec(`
-		INSERT INTO availabilities (TeacherID, Day, StartingTime, EndingTime, Booked)
-		VALUES (?, ?, ?, ?, ?)
-	`, teacherID, availability.Day, availability.StartingTime, availability.EndingTime, availability.Booked)
+		INSERT INTO availabilities (TeacherID, StartsAt, DurationMinutes, Booked, RuleID, Subject)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, teacherID, availability.StartsAt.UTC(), availability.DurationMinutes, availability.Booked, ruleID, availability.Subject)
 
 	return err
 }
 
-// insertStudent inserts a new student into the database.
-func insertStudent(db *sql.DB, student Student) error {
-	// Hash the password
-	hashedPassword, err := hashPassword(student.Password)
-	if err != nil {
-		return err
-	}
-
-	_, err = db.Exec(`
-        INSERT INTO students (Name, Surname, DateOfBirth, Username, Password)
-        VALUES (?,?,?,?,?)
-    `, student.Name, student.Surname, student.DateOfBirth.Format("2006-01-02"), student.Username, hashedPassword)
-
+// deleteAvailability deletes an availability of a teacher that hasn't been booked.
+func deleteAvailability(db *sql.DB, teacherID, availabilityID int) error {
+	tx, err := db.Begin()
 	if err != nil {
-		// Check if the error is due to a unique constraint violation
-		if sqliteErr, ok := err.(*sqlite3.Error); ok && sqliteErr.Code == sqlite3.ErrConstraint {
-			return errors.New("Username already exists")
-		}
 		return err
 	}
+	defer tx.Rollback()
 
-	return nil
-}
-
-// insertBooking inserts a new booking into the database.
-func insertBooking(db *sql.DB, booking LessonReservation) error {
-	// Check if the student and the teacher of the booking exists
-	isPresent, err := isStudentExists(db, booking.StudentUsername)
+	isPresent, err := isAvailabilityRelatedToTeacher(tx, availabilityID, teacherID)
 	if err != nil {
 		return err
 	}
 	if !isPresent {
-		return &ErrStudentNotFound{StudentID: booking.StudentUsername}
+		return ErrAvailabilityNotFound
 	}
 
-	isPresent, err = isTeacherExists(db, booking.TeacherID)
+	// Only free availabilities can be removed, they are kept aside for the calendar feed of the teacher
+	_, err = tx.Exec(`
+		INSERT INTO deleted_availabilities (ID, TeacherID, StartsAt, DurationMinutes, Subject, Sequence, DeletedAt)
+		SELECT ID, TeacherID, StartsAt, DurationMinutes, Subject, Sequence + 1, ?
+		FROM availabilities
+		WHERE ID = ? AND Booked = 0
+	`, time.Now().UTC(), availabilityID)
 	if err != nil {
 		return err
 	}
-	if !isPresent {
-		return &ErrTeacherNotFound{TeacherID: booking.TeacherID}
+	result, err := tx.Exec("DELETE FROM availabilities WHERE ID = ? AND Booked = 0", availabilityID)
+	if err != nil {
+		return err
 	}
-
-	isPresent, err = isAvailabilityRelatedToTeacher(db, booking.AvailabilityID, booking.TeacherID)
+	deleted, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-	if !isPresent {
-		return errors.New("Availability not related to the teacher")
+	if deleted == 0 {
+		return ErrAvailabilityAlreadyBooked
 	}
 
-	// Check if the availability is already booked
-	var count int
-	err = db.QueryRow(`
-        SELECT COUNT(*)
-        FROM availabilities
-        WHERE ID =? AND Booked = 1
-    `, booking.AvailabilityID).Scan(&count)
-
+	// No one can wait for a deleted availability any longer
+	_, err = tx.Exec("DELETE FROM waitlist WHERE AvailabilityID = ? AND Status = ?", availabilityID, waitlistWaiting)
 	if err != nil {
 		return err
 	}
 
-	if count > 0 {
-		return errors.New("Availability already booked")
-	}
+	return tx.Commit()
+}
 
-	availability, err := getAvailabilityByID(db, booking.AvailabilityID)
+// insertAvailabilityRule saves a recurrence rule and inserts its availabilities, all in one transaction.
+// The availabilities overlapping existing ones are skipped and returned as conflicts.
+func insertAvailabilityRule(db *sql.DB, rule AvailabilityRule) (AvailabilityRuleExpansion, error) {
+	tx, err := db.Begin()
 	if err != nil {
-		return err
+		return AvailabilityRuleExpansion{}, err
 	}
-	// Check for overlapping times with other bookings made by the same student
-	var overlappingCount int
-	err = db.QueryRow(`
-		SELECT COUNT(*) AS OverlappingCount
-		FROM bookings b
-		JOIN availabilities a ON b.AvailabilityID = a.ID
-		WHERE b.StudentUsername = ? AND b.AvailabilityID <> ? AND Day = ? AND (
-			(a.StartingTime <= ? AND a.EndingTime > ?) OR
-			(a.StartingTime < ? AND a.EndingTime >= ?) OR
-			(a.StartingTime >= ? AND a.EndingTime <= ?)
-		)
-		`, booking.StudentUsername, booking.AvailabilityID, availability.Day,
-		availability.StartingTime, availability.EndingTime,
-		availability.StartingTime, availability.EndingTime,
-		availability.StartingTime, availability.EndingTime).Scan(&overlappingCount)
+	defer tx.Rollback()
 
+	isPresent, err := isTeacherExists(tx, rule.TeacherID)
 	if err != nil {
-		return err
+		return AvailabilityRuleExpansion{}, err
 	}
-
-	if overlappingCount > 0 {
-		return errors.New("Overlapped times with existing bookings for the same student")
+	if !isPresent {
+		return AvailabilityRuleExpansion{}, &ErrTeacherNotFound{TeacherID: rule.TeacherID}
 	}
 
-	_, err = db.Exec(`
-        INSERT INTO bookings (StudentUsername, TeacherID, AvailabilityID, Subject)
-        VALUES (?,?,?,?)
-    `, booking.StudentUsername, booking.TeacherID, booking.AvailabilityID, booking.Subject)
-
+	var exceptDates []string
+	for _, date := range rule.ExceptDates {
+		exceptDates = append(exceptDates, date.Format("2006-01-02"))
+	}
+	result, err := tx.Exec(`
+		INSERT INTO availability_rules (TeacherID, Weekdays, StartingTime, EndingTime, StartDate, EndDate, ExceptDates, Cancelled, Duration, Subject, TimeZone)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?, ?, ?)
+	`, rule.TeacherID, strings.Join(rule.Weekdays, ","), rule.StartingTime, rule.EndingTime,
+		dateOnly(rule.StartDate), dateOnly(rule.EndDate), strings.Join(exceptDates, ","), rule.DurationMinutes, rule.Subject, timeZoneOrUTC(rule.TimeZone))
 	if err != nil {
-		return err
+		return AvailabilityRuleExpansion{}, err
 	}
+	ruleID, err := result.LastInsertId()
+	if err != nil {
+		return AvailabilityRuleExpansion{}, err
+	}
+	rule.ID = int(ruleID)
 
-	// Update booking availability status
-	_, err = db.Exec(`
-        UPDATE availabilities
-        SET Booked = 1
-        WHERE ID =?
-    `, booking.AvailabilityID)
-
+	slots, err := expandAvailabilityRule(rule)
 	if err != nil {
-		return err
+		return AvailabilityRuleExpansion{}, err
+	}
+	expansion := AvailabilityRuleExpansion{Rule: rule, Slots: []Availability{}, Conflicts: []Availability{}}
+	for _, slot := range slots {
+		err := insertAvailability(tx, slot, rule.TeacherID)
+		if err == ErrOverlappingAvailabilities {
+			expansion.Conflicts = append(expansion.Conflicts, slot)
+			continue
+		} else if err != nil {
+			return AvailabilityRuleExpansion{}, err
+		}
+		expansion.Slots = append(expansion.Slots, slot)
 	}
 
-	return err
+	return expansion, tx.Commit()
 }
 
-// Utilities methods
-
-// isTeacherExists checks if a teacher with the given ID exists in the database.
-func isTeacherExists(db *sql.DB, teacherID int) (bool, error) {
-	var exists bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM teachers WHERE ID = ?)", teacherID).Scan(&exists)
+// getTeacherAvailabilityRules retrieves the recurrence rules of a teacher from the database.
+func getTeacherAvailabilityRules(db *sql.DB, teacherID int) ([]AvailabilityRule, error) {
+	isPresent, err := isTeacherExists(db, teacherID)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	if !isPresent {
+		return nil, &ErrTeacherNotFound{TeacherID: teacherID}
 	}
-	return exists, nil
-}
 
-// isStudentExists checks if a student with the given username exists in the database.
-func isStudentExists(db *sql.DB, studentUsername string) (bool, error) {
-	var exists bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM students WHERE Username = ?)", studentUsername).Scan(&exists)
+	rows, err := db.Query(`
+		SELECT ID, TeacherID, Weekdays, StartingTime, EndingTime, StartDate, EndDate, ExceptDates, Cancelled, Duration, Subject, TimeZone
+		FROM availability_rules
+		WHERE TeacherID = ?
+	`, teacherID)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	return exists, nil
-}
+	defer rows.Close()
 
-// isAvailabilityRelatedToTeacher checks if an availability with the given ID is related to the specified teacher.
-func isAvailabilityRelatedToTeacher(db *sql.DB, availabilityID int, teacherID int) (bool, error) {
+	var rules []AvailabilityRule
+	for rows.Next() {
+		var rule AvailabilityRule
+		var weekdays, exceptDates string
+		err := rows.Scan(&rule.ID, &rule.TeacherID, &weekdays, &rule.StartingTime, &rule.EndingTime,
+			&rule.StartDate, &rule.EndDate, &exceptDates, &rule.Cancelled, &rule.DurationMinutes, &rule.Subject, &rule.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+		rule.Weekdays = strings.Split(weekdays, ",")
+		rule.ExceptDates = []time.Time{}
+		for _, date := range strings.Split(exceptDates, ",") {
+			if parsedDate, err := time.Parse("2006-01-02", date); err == nil {
+				rule.ExceptDates = append(rule.ExceptDates, parsedDate)
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// cancelAvailabilityRule cancels a recurrence rule of a teacher and deletes the availabilities
+// of the rule starting from the given time that haven't been booked. It returns how many were deleted.
+func cancelAvailabilityRule(db *sql.DB, teacherID, ruleID int, from time.Time) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE availability_rules SET Cancelled = 1 WHERE ID = ? AND TeacherID = ?", ruleID, teacherID)
+	if err != nil {
+		return 0, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if updated == 0 {
+		return 0, ErrAvailabilityRuleNotFound
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO deleted_availabilities (ID, TeacherID, StartsAt, DurationMinutes, Subject, Sequence, DeletedAt)
+		SELECT ID, TeacherID, StartsAt, DurationMinutes, Subject, Sequence + 1, ?
+		FROM availabilities
+		WHERE RuleID = ? AND Booked = 0 AND julianday(StartsAt) >= julianday(?)
+	`, time.Now().UTC(), ruleID, from.UTC())
+	if err != nil {
+		return 0, err
+	}
+	result, err = tx.Exec("DELETE FROM availabilities WHERE RuleID = ? AND Booked = 0 AND julianday(StartsAt) >= julianday(?)", ruleID, from.UTC())
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(deleted), tx.Commit()
+}
+
+// getTeacherDurationPolicies retrieves the duration policies saved by a teacher.
+func getTeacherDurationPolicies(db *sql.DB, teacherID int) ([]DurationPolicy, error) {
+	isPresent, err := isTeacherExists(db, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	if !isPresent {
+		return nil, &ErrTeacherNotFound{TeacherID: teacherID}
+	}
+
+	rows, err := db.Query(`
+		SELECT TeacherID, Subject, Durations, Granularity
+		FROM duration_policies
+		WHERE TeacherID = ?
+		ORDER BY Subject
+	`, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []DurationPolicy
+	for rows.Next() {
+		var policy DurationPolicy
+		var durations string
+		if err := rows.Scan(&policy.TeacherID, &policy.Subject, &durations, &policy.GranularityMinutes); err != nil {
+			return nil, err
+		}
+		for _, duration := range strings.Split(durations, ",") {
+			if minutes, err := strconv.Atoi(duration); err == nil {
+				policy.DurationsMinutes = append(policy.DurationsMinutes, minutes)
+			}
+		}
+		policies = append(policies, policy)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// saveDurationPolicy inserts or replaces the duration policy of a teacher for a subject.
+func saveDurationPolicy(db *sql.DB, policy DurationPolicy) error {
+	isPresent, err := isTeacherExists(db, policy.TeacherID)
+	if err != nil {
+		return err
+	}
+	if !isPresent {
+		return &ErrTeacherNotFound{TeacherID: policy.TeacherID}
+	}
+
+	var durations []string
+	for _, minutes := range policy.DurationsMinutes {
+		durations = append(durations, strconv.Itoa(minutes))
+	}
+	_, err = db.Exec(`
+		INSERT INTO duration_policies (TeacherID, Subject, Durations, Granularity)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (TeacherID, Subject) DO UPDATE SET Durations = excluded.Durations, Granularity = excluded.Granularity
+	`, policy.TeacherID, policy.Subject, strings.Join(durations, ","), policy.GranularityMinutes)
+	return err
+}
+
+// deleteDurationPolicy deletes the duration policy of a teacher for a subject.
+func deleteDurationPolicy(db *sql.DB, teacherID int, subject string) error {
+	result, err := db.Exec("DELETE FROM duration_policies WHERE TeacherID = ? AND Subject = ?", teacherID, subject)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrDurationPolicyNotFound
+	}
+	return nil
+}
+
+// updateStudentTimeZone changes the time zone preference of a student.
+func updateStudentTimeZone(db *sql.DB, username, timeZone string) error {
+	result, err := db.Exec("UPDATE students SET TimeZone = ? WHERE Username = ?", timeZone, username)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return &ErrStudentNotFound{StudentID: username}
+	}
+	return nil
+}
+
+// updateStudentProfile changes the name, the surname, the date of birth, the time zone and the email of a student.
+func updateStudentProfile(db *sql.DB, student Student) error {
+	result, err := db.Exec(`
+        UPDATE students SET Name = ?, Surname = ?, DateOfBirth = ?, TimeZone = ?, Email = ?
+        WHERE Username = ?
+    `, student.Name, student.Surname, student.DateOfBirth.Format("2006-01-02"), timeZoneOrUTC(student.TimeZone), student.Email,
+		student.Username)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return &ErrStudentNotFound{StudentID: student.Username}
+	}
+	return nil
+}
+
+// updateStudentPassword replaces the password of a student with the hash of the new one.
+func updateStudentPassword(db dbExecutor, username, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec("UPDATE students SET Password = ?, PasswordChangedAt = ? WHERE Username = ?", hashedPassword, time.Now().UTC(), username)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return &ErrStudentNotFound{StudentID: username}
+	}
+	return nil
+}
+
+// updateTeacherTimeZone changes the time zone preference of a teacher.
+func updateTeacherTimeZone(db *sql.DB, teacherID int, timeZone string) error {
+	result, err := db.Exec("UPDATE teachers SET TimeZone = ? WHERE ID = ?", timeZone, teacherID)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return &ErrTeacherNotFound{TeacherID: teacherID}
+	}
+	return nil
+}
+
+// insertStudent inserts a new student into the database.
+func insertStudent(db dbExecutor, student Student) error {
+	if err := validatePassword(student.Password); err != nil {
+		return err
+	}
+	// Hash the password
+	hashedPassword, err := hashPassword(student.Password)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+        INSERT INTO students (Name, Surname, DateOfBirth, Username, Password, TimeZone, Email, PasswordChangedAt)
+        VALUES (?,?,?,?,?,?,?,?)
+    `, student.Name, student.Surname, student.DateOfBirth.Format("2006-01-02"), student.Username, hashedPassword,
+		timeZoneOrUTC(student.TimeZone), student.Email, time.Now().UTC())
+
+	if err != nil {
+		// Check if the error is due to a unique constraint violation
+		if isUniqueViolation(err) {
+			return ErrUsernameTaken
+		}
+		return err
+	}
+
+	return nil
+}
+
+// deleteStudent deletes a student together with their bookings, their waitlist entries, their calendar feed
+// and their password resets, inside a single transaction. The lessons still booked starting after from are
+// returned, and their availabilities are freed so that they can be booked again. The lessons already started
+// keep their availabilities.
+func deleteStudent(db *sql.DB, username string, from time.Time) ([]LessonReservation, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	exists, err := isStudentExists(tx, username)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, &ErrStudentNotFound{StudentID: username}
+	}
+
+	freed, err := queryReservations(tx, `
+        SELECT ID, StudentUsername, TeacherID, AvailabilityID, Subject, StartsAt, DurationMinutes, Status
+        FROM bookings
+        WHERE StudentUsername = ? AND Status = ? AND julianday(StartsAt) > julianday(?)
+        ORDER BY StartsAt, ID
+    `, username, bookingBooked, from.UTC())
+	if err != nil {
+		return nil, err
+	}
+	for _, booking := range freed {
+		if _, err := tx.Exec("UPDATE availabilities SET Booked = 0, Sequence = Sequence + 1 WHERE ID = ?", booking.AvailabilityID); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, query := range []string{
+		"DELETE FROM lesson_reminders WHERE BookingID IN (SELECT ID FROM bookings WHERE StudentUsername = ?)",
+		"DELETE FROM waitlist WHERE StudentUsername = ?",
+		"DELETE FROM bookings WHERE StudentUsername = ?",
+		"DELETE FROM calendar_feeds WHERE StudentUsername = ?",
+		"DELETE FROM password_resets WHERE StudentUsername = ?",
+		"DELETE FROM students WHERE Username = ?",
+	} {
+		if _, err := tx.Exec(query, username); err != nil {
+			return nil, err
+		}
+	}
+
+	return freed, tx.Commit()
+}
+
+// importTeachers inserts the teachers of a bulk import, all of them or none.
+func importTeachers(db *sql.DB, teachers []Teacher, dryRun bool) (map[int]error, error) {
+	return importRows(db, len(teachers), dryRun, func(tx *sql.Tx, i int) error {
+		return insertTeacher(tx, teachers[i])
+	})
+}
+
+// importStudents inserts the students of a bulk import, all of them or none.
+func importStudents(db *sql.DB, students []Student, dryRun bool) (map[int]error, error) {
+	return importRows(db, len(students), dryRun, func(tx *sql.Tx, i int) error {
+		return insertStudent(tx, students[i])
+	})
+}
+
+// importAvailabilities inserts the availabilities of a bulk import, all of them or none.
+// An availability overlapping another one of the same import is refused like one overlapping a saved availability.
+func importAvailabilities(db *sql.DB, availabilities []ImportedAvailability, dryRun bool) (map[int]error, error) {
+	return importRows(db, len(availabilities), dryRun, func(tx *sql.Tx, i int) error {
+		return insertAvailability(tx, availabilities[i].Availability, availabilities[i].TeacherID)
+	})
+}
+
+// importRows inserts the rows of an import one by one inside a single transaction and collects the error
+// of each row that is refused. The transaction is only committed when every row is inserted and dryRun is false.
+// The failures of the database itself, like a busy or unreadable file, stop the import and are returned as err.
+func importRows(db *sql.DB, count int, dryRun bool, insert func(tx *sql.Tx, i int) error) (map[int]error, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// each row runs in a savepoint: a refused row is rolled back as a whole, even when some of its
+	// statements went through, and the next rows are still checked against the ones before
+	rowErrors := map[int]error{}
+	for i := 0; i < count; i++ {
+		if _, err := tx.Exec("SAVEPOINT import_row"); err != nil {
+			return nil, err
+		}
+		if err := insert(tx, i); err != nil {
+			if isDatabaseFailure(err) {
+				return nil, err
+			}
+			rowErrors[i] = err
+			if _, err := tx.Exec("ROLLBACK TO import_row"); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.Exec("RELEASE import_row"); err != nil {
+			return nil, err
+		}
+	}
+	if len(rowErrors) > 0 || dryRun {
+		return rowErrors, nil
+	}
+	return rowErrors, tx.Commit()
+}
+
+// insertBooking inserts a new booking into the database.
+// The checks, the insert and the update of the availability run inside a single
+// transaction, and the availability is flipped with a conditional update so that
+// two concurrent requests can never book the same slot.
+func insertBooking(db *sql.DB, booking LessonReservation) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := reserveAvailability(tx, booking)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// reserveAvailability runs the checks of a new booking, marks its availability as booked and inserts it,
+// returning its ID. It runs inside the transaction of the caller.
+func reserveAvailability(tx *sql.Tx, booking LessonReservation) (int, error) {
+	// Check if the student and the teacher of the booking exists
+	isPresent, err := isStudentExists(tx, booking.StudentUsername)
+	if err != nil {
+		return 0, err
+	}
+	if !isPresent {
+		return 0, &ErrStudentNotFound{StudentID: booking.StudentUsername}
+	}
+
+	isPresent, err = isTeacherExists(tx, booking.TeacherID)
+	if err != nil {
+		return 0, err
+	}
+	if !isPresent {
+		return 0, &ErrTeacherNotFound{TeacherID: booking.TeacherID}
+	}
+
+	isPresent, err = isAvailabilityRelatedToTeacher(tx, booking.AvailabilityID, booking.TeacherID)
+	if err != nil {
+		return 0, err
+	}
+	if !isPresent {
+		return 0, errors.New("Availability not related to the teacher")
+	}
+
+	availability, err := getAvailabilityByID(tx, booking.AvailabilityID)
+	if err != nil {
+		return 0, err
+	}
+	if availability.Booked {
+		return 0, ErrAvailabilityAlreadyBooked
+	}
+	if !isSubjectAllowed(availability, booking.Subject) {
+		return 0, fmt.Errorf("This availability is reserved for %s lessons", availability.Subject)
+	}
+	// the lesson is saved with the subject as the teacher spells it
+	booking.Subject, err = teacherSubject(tx, booking.TeacherID, booking.Subject)
+	if err != nil {
+		return 0, err
+	}
+
+	// Check for overlapping times with other bookings made by the same student,
+	// the cancelled ones don't count
+	var overlappingCount int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) AS OverlappingCount
+		FROM bookings b
+		WHERE b.StudentUsername = ? AND b.AvailabilityID <> ? AND b.Status NOT IN (?, ?) AND
+			julianday(b.StartsAt) < julianday(?) AND
+			julianday(b.StartsAt, '+' || b.DurationMinutes || ' minutes') > julianday(?)
+		`, booking.StudentUsername, booking.AvailabilityID, bookingCancelledByStudent, bookingCancelledByTeacher,
+		availability.EndsAt().UTC(), availability.StartsAt.UTC()).Scan(&overlappingCount)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if overlappingCount > 0 {
+		return 0, errors.New("Overlapped times with existing bookings for the same student")
+	}
+
+	// Update booking availability status only if it is still free:
+	// if another booking got there first no row is affected
+	result, err := tx.Exec(`
+        UPDATE availabilities
+        SET Booked = 1, Sequence = Sequence + 1
+        WHERE ID =? AND Booked = 0
+    `, booking.AvailabilityID)
+	if err != nil {
+		return 0, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if updated == 0 {
+		return 0, ErrAvailabilityAlreadyBooked
+	}
+
+	result, err = tx.Exec(`
+        INSERT INTO bookings (StudentUsername, TeacherID, AvailabilityID, Subject, StartsAt, DurationMinutes, Status)
+        VALUES (?,?,?,?,?,?,?)
+    `, booking.StudentUsername, booking.TeacherID, booking.AvailabilityID, booking.Subject,
+		availability.StartsAt.UTC(), availability.DurationMinutes, bookingBooked)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// insertWaitlistEntry adds a student to the waitlist of a teacher, either for a booked availability
+// or for any availability of a week.
+func insertWaitlistEntry(db *sql.DB, entry WaitlistEntry) (WaitlistEntry, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+	defer tx.Rollback()
+
+	isPresent, err := isStudentExists(tx, entry.StudentUsername)
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+	if !isPresent {
+		return WaitlistEntry{}, &ErrStudentNotFound{StudentID: entry.StudentUsername}
+	}
+	isPresent, err = isTeacherExists(tx, entry.TeacherID)
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+	if !isPresent {
+		return WaitlistEntry{}, &ErrTeacherNotFound{TeacherID: entry.TeacherID}
+	}
+	// the entry is saved with the subject as the teacher spells it
+	entry.Subject, err = teacherSubject(tx, entry.TeacherID, entry.Subject)
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+
+	// The same student can't wait twice for the same lesson
+	var availabilityID any
+	var duplicates int
+	if entry.AvailabilityID != 0 {
+		isPresent, err = isAvailabilityRelatedToTeacher(tx, entry.AvailabilityID, entry.TeacherID)
+		if err != nil {
+			return WaitlistEntry{}, err
+		}
+		if !isPresent {
+			return WaitlistEntry{}, ErrAvailabilityNotFound
+		}
+		availability, err := getAvailabilityByID(tx, entry.AvailabilityID)
+		if err != nil {
+			return WaitlistEntry{}, err
+		}
+		if err := checkWaitlistAvailability(availability, entry.Subject); err != nil {
+			return WaitlistEntry{}, err
+		}
+		var ownBooking bool
+		err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM bookings WHERE AvailabilityID = ? AND StudentUsername = ? AND Status = ?)",
+			entry.AvailabilityID, entry.StudentUsername, bookingBooked).Scan(&ownBooking)
+		if err != nil {
+			return WaitlistEntry{}, err
+		}
+		if ownBooking {
+			return WaitlistEntry{}, ErrAvailabilityAlreadyBooked
+		}
+		availabilityID = entry.AvailabilityID
+		err = tx.QueryRow(`
+			SELECT COUNT(*) FROM waitlist
+			WHERE StudentUsername = ? AND AvailabilityID = ? AND Status = ?
+		`, entry.StudentUsername, entry.AvailabilityID, waitlistWaiting).Scan(&duplicates)
+	} else {
+		err = tx.QueryRow(`
+			SELECT COUNT(*) FROM waitlist
+			WHERE StudentUsername = ? AND TeacherID = ? AND AvailabilityID IS NULL AND
+				julianday(WeekStart) = julianday(?) AND Status = ?
+		`, entry.StudentUsername, entry.TeacherID, entry.WeekStart.UTC(), waitlistWaiting).Scan(&duplicates)
+	}
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+	if duplicates > 0 {
+		return WaitlistEntry{}, ErrAlreadyOnWaitlist
+	}
+
+	var weekStart, weekEnd any
+	if entry.WeekStart != nil && entry.WeekEnd != nil {
+		weekStart, weekEnd = entry.WeekStart.UTC(), entry.WeekEnd.UTC()
+	}
+	entry.Status = waitlistWaiting
+	entry.CreatedAt = time.Now().UTC()
+	result, err := tx.Exec(`
+		INSERT INTO waitlist (StudentUsername, TeacherID, AvailabilityID, WeekStart, WeekEnd, Subject, Status, CreatedAt)
+		VALUES (?,?,?,?,?,?,?,?)
+	`, entry.StudentUsername, entry.TeacherID, availabilityID, weekStart, weekEnd, entry.Subject, entry.Status, entry.CreatedAt)
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+	entry.ID = int(id)
+
+	return entry, tx.Commit()
+}
+
+// getStudentWaitlist retrieves the waitlist entries of a student, the assigned ones included.
+func getStudentWaitlist(db *sql.DB, username string) ([]WaitlistEntry, error) {
+	isPresent, err := isStudentExists(db, username)
+	if err != nil {
+		return nil, err
+	}
+	if !isPresent {
+		return nil, &ErrStudentNotFound{StudentID: username}
+	}
+	return queryWaitlist(db, waitlistColumns+" WHERE w.StudentUsername = ? ORDER BY w.ID", username)
+}
+
+// getTeacherWaitlist retrieves the entries waiting for a lesson with a teacher, in order of arrival.
+func getTeacherWaitlist(db *sql.DB, teacherID int) ([]WaitlistEntry, error) {
+	isPresent, err := isTeacherExists(db, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	if !isPresent {
+		return nil, &ErrTeacherNotFound{TeacherID: teacherID}
+	}
+	return queryWaitlist(db, waitlistColumns+" WHERE w.TeacherID = ? AND w.Status = ? ORDER BY w.ID", teacherID, waitlistWaiting)
+}
+
+// deleteWaitlistEntry removes a waiting entry of a student from the waitlist.
+func deleteWaitlistEntry(db *sql.DB, username string, entryID int) error {
+	result, err := db.Exec("DELETE FROM waitlist WHERE ID = ? AND StudentUsername = ? AND Status = ?", entryID, username, waitlistWaiting)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrWaitlistEntryNotFound
+	}
+	return nil
+}
+
+// assignFreedAvailability books a free availability for the first entry of the waitlist waiting for it,
+// or for any availability of its week, skipping the students who can't take it.
+// It returns the assigned entry, nil if no one took the availability.
+func assignFreedAvailability(db *sql.DB, availabilityID int) (*WaitlistEntry, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var teacherID int
+	err = tx.QueryRow("SELECT TeacherID FROM availabilities WHERE ID = ?", availabilityID).Scan(&teacherID)
+	if err == sql.ErrNoRows {
+		return nil, ErrAvailabilityNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	availability, err := getAvailabilityByID(tx, availabilityID)
+	if err != nil {
+		return nil, err
+	}
+	if availability.Booked || !availability.StartsAt.After(time.Now()) {
+		return nil, nil
+	}
+
+	entries, err := queryWaitlist(tx, waitlistColumns+`
+		WHERE w.TeacherID = ? AND w.Status = ? AND (w.AvailabilityID = ? OR
+			(w.AvailabilityID IS NULL AND julianday(w.WeekStart) <= julianday(?) AND julianday(?) < julianday(w.WeekEnd)))
+		ORDER BY w.ID
+	`, teacherID, waitlistWaiting, availabilityID, availability.StartsAt.UTC(), availability.StartsAt.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		bookingID, err := reserveAvailability(tx, LessonReservation{
+			StudentUsername: entry.StudentUsername,
+			TeacherID:       teacherID,
+			AvailabilityID:  availabilityID,
+			Subject:         entry.Subject,
+		})
+		if _, isDatabaseError := err.(sqlite3.Error); isDatabaseError {
+			return nil, err
+		} else if err != nil {
+			// the student can't take this lesson, for example because of another booking at the same time
+			continue
+		}
+
+		_, err = tx.Exec("UPDATE waitlist SET Status = ?, BookingID = ? WHERE ID = ?", waitlistAssigned, bookingID, entry.ID)
+		if err != nil {
+			return nil, err
+		}
+		entry.Status, entry.BookingID = waitlistAssigned, bookingID
+		return &entry, tx.Commit()
+	}
+
+	return nil, tx.Commit()
+}
+
+// waitlistColumns selects the columns of a waitlist entry, in the order read by queryWaitlist
+const waitlistColumns = `
+	SELECT w.ID, w.StudentUsername, w.TeacherID, COALESCE(w.AvailabilityID, 0), w.WeekStart, w.WeekEnd, w.Subject, w.Status,
+		COALESCE(w.BookingID, 0), w.CreatedAt, t.Name, t.Surname, a.StartsAt
+	FROM waitlist w
+	JOIN teachers t ON t.ID = w.TeacherID
+	LEFT JOIN availabilities a ON a.ID = w.AvailabilityID`
+
+// queryWaitlist runs a query selecting waitlistColumns and reads the entries.
+func queryWaitlist(db dbExecutor, query string, args ...any) ([]WaitlistEntry, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []WaitlistEntry
+	for rows.Next() {
+		var entry WaitlistEntry
+		var weekStart, weekEnd, startsAt sql.NullTime
+		err := rows.Scan(&entry.ID, &entry.StudentUsername, &entry.TeacherID, &entry.AvailabilityID, &weekStart, &weekEnd,
+			&entry.Subject, &entry.Status, &entry.BookingID, &entry.CreatedAt, &entry.TeacherName, &entry.TeacherSurname, &startsAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.WeekStart, entry.WeekEnd, entry.StartsAt = timeOrNil(weekStart), timeOrNil(weekEnd), timeOrNil(startsAt)
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Subjects
+
+// getAllSubjects retrieves all the subjects, in alphabetical order.
+func getAllSubjects(db *sql.DB) ([]Subject, error) {
+	rows, err := db.Query("SELECT ID, Name FROM subjects ORDER BY Name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subjects []Subject
+	for rows.Next() {
+		var subject Subject
+		if err := rows.Scan(&subject.ID, &subject.Name); err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, subject)
+	}
+	return subjects, rows.Err()
+}
+
+// getTeacherSubjects retrieves the names of the subjects of a teacher, in alphabetical order.
+func getTeacherSubjects(db dbExecutor, teacherID int) ([]string, error) {
+	rows, err := db.Query(`
+        SELECT s.Name
+        FROM teacher_subjects ts JOIN subjects s ON s.ID = ts.SubjectID
+        WHERE ts.TeacherID = ?
+        ORDER BY s.Name
+    `, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subjects []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, name)
+	}
+	return subjects, rows.Err()
+}
+
+// getSubjectsByTeacher retrieves the names of the subjects of every teacher, by teacher ID.
+func getSubjectsByTeacher(db dbExecutor) (map[int][]string, error) {
+	rows, err := db.Query(`
+        SELECT ts.TeacherID, s.Name
+        FROM teacher_subjects ts JOIN subjects s ON s.ID = ts.SubjectID
+        ORDER BY s.Name
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subjects := map[int][]string{}
+	for rows.Next() {
+		var teacherID int
+		var name string
+		if err := rows.Scan(&teacherID, &name); err != nil {
+			return nil, err
+		}
+		subjects[teacherID] = append(subjects[teacherID], name)
+	}
+	return subjects, rows.Err()
+}
+
+// replaceTeacherSubjects replaces the subjects of a teacher in a single transaction.
+func replaceTeacherSubjects(db *sql.DB, teacherID int, subjects []string) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	isPresent, err := isTeacherExists(tx, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	if !isPresent {
+		return nil, &ErrTeacherNotFound{TeacherID: teacherID}
+	}
+	if _, err := tx.Exec("DELETE FROM teacher_subjects WHERE TeacherID = ?", teacherID); err != nil {
+		return nil, err
+	}
+	saved, err := setTeacherSubjects(tx, teacherID, subjects)
+	if err != nil {
+		return nil, err
+	}
+	return saved, tx.Commit()
+}
+
+// setTeacherSubjects adds the subjects to a teacher, creating the ones that don't exist yet,
+// and returns the names of all the subjects of the teacher.
+func setTeacherSubjects(db dbExecutor, teacherID int, subjects []string) ([]string, error) {
+	for _, name := range subjects {
+		// the names are unique without the case, so an existing subject keeps its spelling
+		_, err := db.Exec("INSERT INTO subjects (Name) VALUES (?) ON CONFLICT (Name) DO NOTHING", name)
+		if err != nil {
+			return nil, err
+		}
+		_, err = db.Exec(`
+            INSERT INTO teacher_subjects (TeacherID, SubjectID)
+            SELECT ?, ID FROM subjects WHERE Name = ?
+            ON CONFLICT (TeacherID, SubjectID) DO NOTHING
+        `, teacherID, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return getTeacherSubjects(db, teacherID)
+}
+
+// teacherSubject returns the subject of a lesson with the teacher as the teacher spells it, and
+// ErrSubjectNotTaught if the teacher doesn't teach it. A teacher without subjects teaches any subject.
+func teacherSubject(db dbExecutor, teacherID int, subject string) (string, error) {
+	subjects, err := getTeacherSubjects(db, teacherID)
+	if err != nil {
+		return "", err
+	}
+	if len(subjects) == 0 {
+		return subject, nil
+	}
+	for _, name := range subjects {
+		if strings.EqualFold(name, strings.TrimSpace(subject)) {
+			return name, nil
+		}
+	}
+	return "", ErrSubjectNotTaught
+}
+
+// searchTeachers retrieves the teachers matching the search, by surname and name.
+func searchTeachers(db *sql.DB, search TeacherSearch) ([]Teacher, error) {
+	var conditions []string
+	var args []any
+	if search.Subject != "" {
+		conditions = append(conditions, `EXISTS (
+            SELECT 1 FROM teacher_subjects ts JOIN subjects s ON s.ID = ts.SubjectID
+            WHERE ts.TeacherID = t.ID AND s.Name = ?)`)
+		args = append(args, search.Subject)
+	}
+	if search.NamePrefix != "" {
+		//the prefix is matched literally, its % and _ are escaped
+		prefix := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search.NamePrefix) + "%"
+		conditions = append(conditions, `(t.Name LIKE ? ESCAPE '\' OR t.Surname LIKE ? ESCAPE '\' OR
+            (t.Name || ' ' || t.Surname) LIKE ? ESCAPE '\')`)
+		args = append(args, prefix, prefix, prefix)
+	}
+	if !search.FreeFrom.IsZero() {
+		slot := `EXISTS (
+            SELECT 1 FROM availabilities a
+            WHERE a.TeacherID = t.ID AND a.Booked = 0 AND julianday(a.StartsAt) >= julianday(?)`
+		args = append(args, search.FreeFrom.UTC())
+		if !search.FreeTo.IsZero() {
+			slot += ` AND julianday(a.StartsAt, '+' || a.DurationMinutes || ' minutes') <= julianday(?)`
+			args = append(args, search.FreeTo.UTC())
+		}
+		if search.Subject != "" {
+			slot += ` AND (a.Subject = '' OR a.Subject = ? COLLATE NOCASE)`
+			args = append(args, search.Subject)
+		}
+		conditions = append(conditions, slot+")")
+	}
+
+	query := "SELECT t.ID, t.Name, t.Surname, COALESCE(t.Username, ''), t.TimeZone, t.Email FROM teachers t"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	rows, err := db.Query(query+" ORDER BY t.Surname, t.Name, t.ID", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teachers []Teacher
+	for rows.Next() {
+		var teacher Teacher
+		err := rows.Scan(&teacher.ID, &teacher.Name, &teacher.Surname, &teacher.Username, &teacher.TimeZone, &teacher.Email)
+		if err != nil {
+			return nil, err
+		}
+		teachers = append(teachers, teacher)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	subjects, err := getSubjectsByTeacher(db)
+	if err != nil {
+		return nil, err
+	}
+	for i := range teachers {
+		teachers[i].Subjects = subjects[teachers[i].ID]
+	}
+	return teachers, nil
+}
+
+// Calendar feeds
+
+// getCalendarFeed returns the calendar feed of the student or the teacher of the given feed, and saves the
+// given feed when they have none yet. Two concurrent calls for the same owner return the same feed.
+func getCalendarFeed(db *sql.DB, feed CalendarFeed) (CalendarFeed, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return CalendarFeed{}, err
+	}
+	defer tx.Rollback()
+
+	if err := checkCalendarFeedOwner(tx, feed); err != nil {
+		return CalendarFeed{}, err
+	}
+	studentUsername, teacherID := calendarFeedOwner(feed)
+	_, err = tx.Exec(`
+		INSERT INTO calendar_feeds (Token, StudentUsername, TeacherID, CreatedAt) VALUES (?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`, feed.Token, studentUsername, teacherID, feed.CreatedAt.UTC())
+	if err != nil {
+		return CalendarFeed{}, err
+	}
+	saved, err := queryCalendarFeed(tx, "WHERE StudentUsername = ? OR TeacherID = ?", studentUsername, teacherID)
+	if err != nil {
+		return CalendarFeed{}, err
+	}
+	return saved, tx.Commit()
+}
+
+// replaceCalendarFeed saves the calendar feed in place of the one of its owner.
+func replaceCalendarFeed(db *sql.DB, feed CalendarFeed) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkCalendarFeedOwner(tx, feed); err != nil {
+		return err
+	}
+	studentUsername, teacherID := calendarFeedOwner(feed)
+	if _, err := tx.Exec("DELETE FROM calendar_feeds WHERE StudentUsername = ? OR TeacherID = ?", studentUsername, teacherID); err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO calendar_feeds (Token, StudentUsername, TeacherID, CreatedAt) VALUES (?, ?, ?, ?)",
+		feed.Token, studentUsername, teacherID, feed.CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// getCalendarFeedByToken returns the calendar feed with the token.
+func getCalendarFeedByToken(db *sql.DB, token string) (CalendarFeed, error) {
+	feed, err := queryCalendarFeed(db, "WHERE Token = ?", token)
+	if err == sql.ErrNoRows {
+		return CalendarFeed{}, ErrCalendarFeedNotFound
+	}
+	return feed, err
+}
+
+// queryCalendarFeed reads the calendar feed selected by the where clause.
+func queryCalendarFeed(db dbExecutor, where string, args ...any) (CalendarFeed, error) {
+	var feed CalendarFeed
+	row := db.QueryRow("SELECT Token, COALESCE(StudentUsername, ''), COALESCE(TeacherID, 0), CreatedAt FROM calendar_feeds "+where, args...)
+	err := row.Scan(&feed.Token, &feed.StudentUsername, &feed.TeacherID, &feed.CreatedAt)
+	return feed, err
+}
+
+// checkCalendarFeedOwner checks that the student or the teacher of the feed exists.
+func checkCalendarFeedOwner(db dbExecutor, feed CalendarFeed) error {
+	if feed.StudentUsername != "" {
+		exists, err := isStudentExists(db, feed.StudentUsername)
+		if err == nil && !exists {
+			err = &ErrStudentNotFound{StudentID: feed.StudentUsername}
+		}
+		return err
+	}
+	exists, err := isTeacherExists(db, feed.TeacherID)
+	if err == nil && !exists {
+		err = &ErrTeacherNotFound{TeacherID: feed.TeacherID}
+	}
+	return err
+}
+
+// calendarFeedOwner returns the owner columns of a feed, the one that isn't used being NULL.
+func calendarFeedOwner(feed CalendarFeed) (any, any) {
+	if feed.StudentUsername != "" {
+		return feed.StudentUsername, nil
+	}
+	return nil, feed.TeacherID
+}
+
+// Scheduler
+
+// getJobRun retrieves the last run of a job of the scheduler, a zero JobRun if it never ran.
+func getJobRun(db *sql.DB, name string) (JobRun, error) {
+	run := JobRun{Name: name}
+	err := db.QueryRow("SELECT LastRunAt, LastError FROM job_runs WHERE Name = ?", name).Scan(&run.LastRunAt, &run.LastError)
+	if err == sql.ErrNoRows {
+		return run, nil
+	}
+	return run, err
+}
+
+// saveJobRun saves the last run of a job, in place of the previous one.
+func saveJobRun(db *sql.DB, run JobRun) error {
+	_, err := db.Exec(`
+        INSERT INTO job_runs (Name, LastRunAt, LastError) VALUES (?, ?, ?)
+        ON CONFLICT (Name) DO UPDATE SET LastRunAt = excluded.LastRunAt, LastError = excluded.LastError
+    `, run.Name, run.LastRunAt.UTC(), run.LastError)
+	return err
+}
+
+// claimLessonReminder records the reminder of a booking, and returns false if it was already recorded.
+// The insert is atomic, so a reminder is claimed only once even by two servers at the same time.
+func claimLessonReminder(db *sql.DB, bookingID int, reminder string, sentAt time.Time) (bool, error) {
+	result, err := db.Exec(`
+        INSERT INTO lesson_reminders (BookingID, Reminder, SentAt) VALUES (?, ?, ?)
+        ON CONFLICT (BookingID, Reminder) DO NOTHING
+    `, bookingID, reminder, sentAt.UTC())
+	if err != nil {
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	return inserted > 0, err
+}
+
+// Administrators
+
+// getAllAdmins retrieves the administrator accounts, without their passwords.
+func getAllAdmins(db *sql.DB) ([]Admin, error) {
+	rows, err := db.Query("SELECT Username, CreatedBy, CreatedAt FROM admins ORDER BY Username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var admins []Admin
+	for rows.Next() {
+		var admin Admin
+		if err := rows.Scan(&admin.Username, &admin.CreatedBy, &admin.CreatedAt); err != nil {
+			return nil, err
+		}
+		admins = append(admins, admin)
+	}
+	return admins, rows.Err()
+}
+
+// getAdminByUsername retrieves an administrator with the hashed password.
+func getAdminByUsername(db *sql.DB, username string) (Admin, error) {
+	var admin Admin
+	err := db.QueryRow("SELECT Username, Password, CreatedBy, CreatedAt FROM admins WHERE Username = ?", username).
+		Scan(&admin.Username, &admin.Password, &admin.CreatedBy, &admin.CreatedAt)
+	if err == sql.ErrNoRows {
+		return Admin{}, ErrAdminNotFound
+	}
+	return admin, err
+}
+
+// insertAdmin inserts an administrator, with the password hashed.
+func insertAdmin(db *sql.DB, admin Admin) error {
+	if admin.Password == "" {
+		return ErrAdminPasswordRequired
+	}
+	hashedPassword, err := hashPassword(admin.Password)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT INTO admins (Username, Password, CreatedBy, CreatedAt) VALUES (?, ?, ?, ?)",
+		admin.Username, hashedPassword, admin.CreatedBy, admin.CreatedAt.UTC())
+	if isUniqueViolation(err) {
+		return ErrUsernameTaken
+	}
+	return err
+}
+
+// Password resets
+
+// insertPasswordReset saves a password reset of a student.
+func insertPasswordReset(db *sql.DB, reset PasswordReset) error {
+	exists, err := isStudentExists(db, reset.StudentUsername)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return &ErrStudentNotFound{StudentID: reset.StudentUsername}
+	}
+	_, err = db.Exec(`
+        INSERT INTO password_resets (TokenHash, StudentUsername, CreatedAt, ExpiresAt) VALUES (?, ?, ?, ?)
+    `, reset.TokenHash, reset.StudentUsername, reset.CreatedAt.UTC(), reset.ExpiresAt.UTC())
+	return err
+}
+
+// resetPassword replaces the password of the student of a reset still valid at the given time, and marks
+// every reset of the student as used, inside a single transaction.
+func resetPassword(db *sql.DB, tokenHash, password string, at time.Time) (string, error) {
+	if err := validatePassword(password); err != nil {
+		return "", err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var username string
+	err = tx.QueryRow(`
+        SELECT StudentUsername FROM password_resets
+        WHERE TokenHash = ? AND UsedAt IS NULL AND julianday(ExpiresAt) > julianday(?)
+    `, tokenHash, at.UTC()).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", ErrPasswordResetInvalid
+	} else if err != nil {
+		return "", err
+	}
+
+	if err := updateStudentPassword(tx, username, password); err != nil {
+		return "", err
+	}
+	_, err = tx.Exec("UPDATE password_resets SET UsedAt = ? WHERE StudentUsername = ? AND UsedAt IS NULL", at.UTC(), username)
+	if err != nil {
+		return "", err
+	}
+
+	return username, tx.Commit()
+}
+
+// Login failures
+
+// insertLoginFailure records a refused login.
+func insertLoginFailure(db *sql.DB, failure LoginFailure) error {
+	_, err := db.Exec("INSERT INTO login_failures (Username, Role, IP, Reason, AttemptedAt) VALUES (?, ?, ?, ?, ?)",
+		failure.Username, failure.Role, failure.IP, failure.Reason, failure.AttemptedAt.UTC())
+	return err
+}
+
+// getLoginFailures retrieves the latest refused logins first, at most limit of them,
+// only the ones of the username unless it is empty.
+func getLoginFailures(db *sql.DB, username string, limit int) ([]LoginFailure, error) {
+	rows, err := db.Query(`
+        SELECT ID, Username, Role, IP, Reason, AttemptedAt FROM login_failures
+        WHERE ? = '' OR Username = ?
+        ORDER BY ID DESC LIMIT ?
+    `, username, username, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []LoginFailure
+	for rows.Next() {
+		var failure LoginFailure
+		if err := rows.Scan(&failure.ID, &failure.Username, &failure.Role, &failure.IP, &failure.Reason, &failure.AttemptedAt); err != nil {
+			return nil, err
+		}
+		failures = append(failures, failure)
+	}
+	return failures, rows.Err()
+}
+
+// Utilities methods
+
+// isTeacherExists checks if a teacher with the given ID exists in the database.
+func isTeacherExists(db dbExecutor, teacherID int) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM teachers WHERE ID = ?)", teacherID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// isStudentExists checks if a student with the given username exists in the database.
+func isStudentExists(db dbExecutor, studentUsername string) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM students WHERE Username = ?)", studentUsername).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// isAvailabilityRelatedToTeacher checks if an availability with the given ID is related to the specified teacher.
+func isAvailabilityRelatedToTeacher(db dbExecutor, availabilityID int, teacherID int) (bool, error) {
 	var exists bool
 	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM availabilities WHERE ID =? AND TeacherID =?)", availabilityID, teacherID).Scan(&exists)
 	if err != nil {
@@ -560,6 +2032,14 @@ func isAvailabilityRelatedToTeacher(db *sql.DB, availabilityID int, teacherID in
 	return exists, nil
 }
 
+// timeOrNil returns the time of a nullable column, nil when it is NULL.
+func timeOrNil(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
 // hashPassword hashes the given password using bcrypt.
 func hashPassword(password string) (string, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"server/models"
+)
+
+// defaultLessonDurations are the durations, in minutes, allowed to the teachers without a policy
+var defaultLessonDurations = []int{60}
+
+// minDurationGranularity is the smallest step, in minutes, of the durations and of the starting times.
+// It is also the granularity of the teachers without a policy.
+const minDurationGranularity = 15
+
+// maxLessonDuration is the longest lesson a policy can allow, in minutes
+const maxLessonDuration = 8 * 60
+
+// durationPolicies is returned by GET /api/teacher/:id/durations, shared with the users of the API
+type durationPolicies = models.DurationPolicies
+
+// Getters
+
+// getTeacherDurationPolicies retrieves the lesson durations allowed by a teacher, default and per subject.
+func (api *apiServer) getTeacherDurationPolicies(c *gin.Context) {
+	teacherID, errID := strconv.Atoi(c.Param("id"))
+	if errID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teacher ID"})
+		return
+	}
+	policies, err := api.store.TeacherDurationPolicies(teacherID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No teachers associated with ID %d", teacherID)})
+		return
+	}
+
+	response := durationPolicies{Default: resolveDurationPolicy(policies, teacherID, ""), Subjects: []DurationPolicy{}}
+	for _, policy := range policies {
+		if policy.Subject != "" {
+			response.Subjects = append(response.Subjects, policy)
+		}
+	}
+	c.IndentedJSON(http.StatusOK, response)
+}
+
+// Creators
+
+// saveTeacherDurationPolicy sets the lesson durations allowed by a teacher, for a subject or,
+// when the subject is empty, for all the subjects without their own policy.
+func (api *apiServer) saveTeacherDurationPolicy(c *gin.Context) {
+	teacherID, errID := strconv.Atoi(c.Param("id"))
+	if errID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teacher ID"})
+		return
+	}
+
+	var policy DurationPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return
+	}
+	policy.TeacherID = teacherID
+	policy.Subject = normalizeSubject(policy.Subject)
+	if policy.GranularityMinutes == 0 {
+		policy.GranularityMinutes = minDurationGranularity
+	}
+	var v validator
+	v.check("", validateDurationPolicy(&policy))
+	if policy.Subject != "" {
+		v.check("subject", api.validateTeacherSubject(teacherID, policy.Subject))
+	}
+	if err := v.err(); err != nil {
+		invalidRequest(c, err)
+		return
+	}
+
+	err := api.store.SaveDurationPolicy(policy)
+	if _, ok := err.(*ErrTeacherNotFound); ok {
+		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No teachers associated with ID %d", teacherID)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving the duration policy"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, policy)
+}
+
+// Deleters
+
+// deleteTeacherDurationPolicy removes the policy of a teacher for the subject in the query string,
+// or their default policy when no subject is given. The defaults apply again afterwards.
+func (api *apiServer) deleteTeacherDurationPolicy(c *gin.Context) {
+	teacherID, errID := strconv.Atoi(c.Param("id"))
+	if errID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teacher ID"})
+		return
+	}
+
+	err := api.store.DeleteDurationPolicy(teacherID, normalizeSubject(c.Query("subject")))
+	if err == ErrDurationPolicyNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting the duration policy"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Duration policy deleted successfully"})
+}
+
+// Utils
+
+// durationPolicyFor returns the policy applying to the availabilities of a teacher for a subject.
+func (api *apiServer) durationPolicyFor(teacherID int, subject string) (DurationPolicy, error) {
+	policies, err := api.store.TeacherDurationPolicies(teacherID)
+	if err != nil {
+		return DurationPolicy{}, err
+	}
+	return resolveDurationPolicy(policies, teacherID, subject), nil
+}
+
+// resolveDurationPolicy picks the policy of the subject, then the default policy of the teacher,
+// then the application defaults.
+func resolveDurationPolicy(policies []DurationPolicy, teacherID int, subject string) DurationPolicy {
+	subject = normalizeSubject(subject)
+	var teacherDefault *DurationPolicy
+	for i, policy := range policies {
+		if subject != "" && policy.Subject == subject {
+			return policy
+		}
+		if policy.Subject == "" {
+			teacherDefault = &policies[i]
+		}
+	}
+	if teacherDefault != nil {
+		return *teacherDefault
+	}
+	return DurationPolicy{TeacherID: teacherID, DurationsMinutes: defaultLessonDurations, GranularityMinutes: minDurationGranularity}
+}
+
+// validateDurationPolicy checks the durations and the granularity of a policy and sorts the durations.
+func validateDurationPolicy(policy *DurationPolicy) error {
+	var v validator
+	if len(policy.DurationsMinutes) == 0 {
+		v.add("durations_minutes", "At least one duration is required")
+	}
+	if policy.GranularityMinutes <= 0 || policy.GranularityMinutes%minDurationGranularity != 0 {
+		v.add("granularity_minutes", fmt.Sprintf("The granularity need to be a multiple of %d minutes", minDurationGranularity))
+	}
+
+	seen := map[int]bool{}
+	var durations []int
+	for _, duration := range policy.DurationsMinutes {
+		if duration <= 0 || duration > maxLessonDuration || duration%minDurationGranularity != 0 {
+			v.add("durations_minutes", fmt.Sprintf("The durations need to be multiples of %d minutes, up to %d minutes", minDurationGranularity, maxLessonDuration))
+			break
+		}
+		if !seen[duration] {
+			seen[duration] = true
+			durations = append(durations, duration)
+		}
+	}
+	if err := v.err(); err != nil {
+		return err
+	}
+	sort.Ints(durations)
+	policy.DurationsMinutes = durations
+	return nil
+}
+
+// checkDuration checks that the lesson between starting and ending times lasts one of the durations
+// allowed by the policy and starts on a multiple of its granularity.
+func checkDuration(policy DurationPolicy, startingTime, endingTime time.Time) error {
+	duration := endingTime.Sub(startingTime)
+	allowed := false
+	for _, minutes := range policy.DurationsMinutes {
+		if duration == time.Duration(minutes)*time.Minute {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("The duration of the lesson need to be one of %s minutes", formatDurations(policy.DurationsMinutes))
+	}
+
+	startMinute := startingTime.Hour()*60 + startingTime.Minute()
+	if startingTime.Second() != 0 || startMinute%policy.GranularityMinutes != 0 {
+		return fmt.Errorf("The lessons need to start on a multiple of %d minutes", policy.GranularityMinutes)
+	}
+	return nil
+}
+
+// formatDurations lists durations in minutes as "30, 60, 90".
+func formatDurations(durations []int) string {
+	var formatted []string
+	for _, minutes := range durations {
+		formatted = append(formatted, strconv.Itoa(minutes))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// isSubjectAllowed checks if a lesson of the subject can be booked in the availability.
+func isSubjectAllowed(availability Availability, subject string) bool {
+	return availability.Subject == "" || strings.EqualFold(strings.TrimSpace(availability.Subject), strings.TrimSpace(subject))
+}
+
+// normalizeSubject is the form of the subjects used to look up the policies.
+func normalizeSubject(subject string) string {
+	return strings.ToLower(strings.TrimSpace(subject))
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportTypeBookings is the type of export of the bookings, the other types are the ones of the imports
+const exportTypeBookings = "bookings"
+
+// formats of the exports: a JSON document, or a csv file with a header row for a single type
+const (
+	exportFormatJSON = "json"
+	exportFormatCSV  = "csv"
+)
+
+// exportColumns are the columns of each type of csv export. The passwords are never exported.
+var exportColumns = map[string][]string{
+	importTypeTeachers:       {"id", "name", "surname", "username", "time_zone", "email", "subjects"},
+	importTypeStudents:       {"username", "name", "surname", "date_of_birth", "time_zone", "email"},
+	importTypeAvailabilities: {"id", "teacher_id", "starts_at", "duration_minutes", "subject", "booked", "rule_id"},
+	exportTypeBookings: {"id", "student_username", "teacher_id", "availability_id", "subject", "starts_at", "duration_minutes",
+		"status", "cancelled_by", "cancellation_reason", "cancelled_at"},
+}
+
+// exportData dumps the teachers, the students, the availabilities and the bookings, without the passwords.
+// With ?type= only the rows of that type are exported, and ?format=csv returns them as a csv file with a
+// header row. The times are in UTC.
+func (api *apiServer) exportData(c *gin.Context) {
+	kind := c.Query("type")
+	format := c.DefaultQuery("format", exportFormatJSON)
+	if _, exists := exportColumns[kind]; kind != "" && !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "The type need to be teachers, students, availabilities or bookings"})
+		return
+	}
+	if format != exportFormatJSON && format != exportFormatCSV {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "The format need to be json or csv"})
+		return
+	}
+	if format == exportFormatCSV && kind == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "A csv export needs the type: teachers, students, availabilities or bookings"})
+		return
+	}
+
+	export, err := api.store.ExportData()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error exporting the data"})
+		return
+	}
+
+	filename := "gotutor-" + export.ExportedAt.Format("20060102-150405")
+	if kind != "" {
+		filename += "-" + kind
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, format))
+	if format == exportFormatCSV {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		writer := csv.NewWriter(c.Writer)
+		writer.Write(exportColumns[kind])
+		writer.WriteAll(exportRows(export, kind))
+		return
+	}
+	c.IndentedJSON(http.StatusOK, exportSection(export, kind))
+}
+
+// Utils
+
+// exportSection returns the rows of the type, or the whole export when the type is empty.
+// The empty lists are kept as lists in JSON.
+func exportSection(export DataExport, kind string) any {
+	if export.Teachers == nil {
+		export.Teachers = []Teacher{}
+	}
+	if export.Students == nil {
+		export.Students = []Student{}
+	}
+	if export.Availabilities == nil {
+		export.Availabilities = []ExportedAvailability{}
+	}
+	if export.Bookings == nil {
+		export.Bookings = []LessonReservation{}
+	}
+	switch kind {
+	case importTypeTeachers:
+		return export.Teachers
+	case importTypeStudents:
+		return export.Students
+	case importTypeAvailabilities:
+		return export.Availabilities
+	case exportTypeBookings:
+		return export.Bookings
+	default:
+		return export
+	}
+}
+
+// exportRows returns the rows of the type as csv records, in the order of exportColumns.
+func exportRows(export DataExport, kind string) [][]string {
+	var rows [][]string
+	switch kind {
+	case importTypeTeachers:
+		for _, t := range export.Teachers {
+			rows = append(rows, []string{strconv.Itoa(t.ID), t.Name, t.Surname, t.Username, t.TimeZone, t.Email, strings.Join(t.Subjects, ";")})
+		}
+	case importTypeStudents:
+		for _, s := range export.Students {
+			rows = append(rows, []string{s.Username, s.Name, s.Surname, s.DateOfBirth.Format("2006-01-02"), s.TimeZone, s.Email})
+		}
+	case importTypeAvailabilities:
+		for _, a := range export.Availabilities {
+			rows = append(rows, []string{strconv.Itoa(a.ID), strconv.Itoa(a.TeacherID), exportTime(&a.StartsAt),
+				strconv.Itoa(a.DurationMinutes), a.Subject, strconv.FormatBool(a.Booked), strconv.Itoa(a.RuleID)})
+		}
+	case exportTypeBookings:
+		for _, b := range export.Bookings {
+			rows = append(rows, []string{strconv.Itoa(b.ID), b.StudentUsername, strconv.Itoa(b.TeacherID), strconv.Itoa(b.AvailabilityID),
+				b.Subject, exportTime(&b.StartsAt), strconv.Itoa(b.DurationMinutes), b.Status, b.CancelledBy, b.CancellationReason,
+				exportTime(b.CancelledAt)})
+		}
+	}
+	return rows
+}
+
+// exportTime formats a time of a csv export in UTC, empty when there is none.
+func exportTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExportDoesNotWaitForTheWriters(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	api := newTestAPIOn(t, store, loginPolicy{})
+	api.addTeacher("Lovelace")
+
+	//a write in progress, holding the write lock until it is committed
+	tx, err := store.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := insertTeacher(tx, Teacher{Name: "Teacher", Surname: "Hopper"}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	response := api.do(http.MethodGet, "/api/export", api.admin, nil)
+	api.expect(response, http.StatusOK)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the export waited %s for the write lock", elapsed)
+	}
+	var export DataExport
+	api.decode(response, &export)
+	if len(export.Teachers) != 1 || export.Teachers[0].Surname != "Lovelace" {
+		t.Fatalf("got the teachers %+v, want only the committed one", export.Teachers)
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"server/models"
+)
+
+// maxImportSize is the largest file, in bytes, accepted by POST /api/import
+const maxImportSize = 10 << 20
+
+// types of rows that can be imported
+const (
+	importTypeTeachers       = "teachers"
+	importTypeStudents       = "students"
+	importTypeAvailabilities = "availabilities"
+)
+
+// formats of the imported files: csv with a header row, or one JSON object per line
+const (
+	importFormatCSV   = models.ImportFormatCSV
+	importFormatJSONL = models.ImportFormatJSONL
+)
+
+// importColumns are the columns of each type of import, also the keys of the JSON objects
+var importColumns = map[string][]string{
+	importTypeTeachers:       {"name", "surname", "username", "password", "time_zone", "email", "subjects"},
+	importTypeStudents:       {"name", "surname", "date_of_birth", "username", "password", "time_zone", "email"},
+	importTypeAvailabilities: {"teacher_id", "teacher_username", "starts_at", "duration_minutes", "subject"},
+}
+
+// the report of an import, shared with the users of the API
+type (
+	ImportReport   = models.ImportReport
+	ImportRowError = models.ImportRowError
+)
+
+// importRecord is a row of an imported file, by column
+type importRecord struct {
+	Line   int
+	Fields map[string]string
+}
+
+// importRecords imports teachers, students or availabilities from a csv or jsonl file, all of them or none.
+// The type and the format are given as ?type= and ?format=, the format can also come from the Content-Type.
+// With ?dry_run=true the rows are only checked.
+func (api *apiServer) importRecords(c *gin.Context) {
+	kind := c.Query("type")
+	columns, exists := importColumns[kind]
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "The type need to be teachers, students or availabilities"})
+		return
+	}
+	format := importFormat(c)
+	if format != importFormatCSV && format != importFormatJSONL {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "The format need to be csv or jsonl"})
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "dry_run need to be true or false"})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	report := ImportReport{Type: kind, DryRun: dryRun, Errors: []ImportRowError{}}
+	records, err := parseImportRecords(format, body, columns, &report)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": fmt.Sprintf("The file can't be larger than %d MB", maxImportSize>>20)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	//the rows that couldn't be read are only in the errors
+	rowLines := map[int]bool{}
+	for _, record := range records {
+		rowLines[record.Line] = true
+	}
+	for _, rowError := range report.Errors {
+		rowLines[rowError.Line] = true
+	}
+	report.Rows = len(rowLines)
+	if report.Rows == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "The file has no rows"})
+		return
+	}
+
+	//the rows with errors are left out, and the others only checked by the store:
+	//it still finds the duplicated usernames and the overlapping availabilities among them
+	var lines []int
+	var storeErrors map[int]error
+	switch kind {
+	case importTypeTeachers:
+		var teachers []Teacher
+		for _, record := range records {
+			if teacher, ok := teacherFromRecord(record, &report); ok {
+				teachers = append(teachers, teacher)
+				lines = append(lines, record.Line)
+			}
+		}
+		storeErrors, err = api.store.ImportTeachers(teachers, dryRun || len(report.Errors) > 0)
+	case importTypeStudents:
+		var students []Student
+		for _, record := range records {
+			if student, ok := studentFromRecord(record, &report); ok {
+				students = append(students, student)
+				lines = append(lines, record.Line)
+			}
+		}
+		storeErrors, err = api.store.ImportStudents(students, dryRun || len(report.Errors) > 0)
+	case importTypeAvailabilities:
+		var availabilities []ImportedAvailability
+		for _, record := range records {
+			if availability, ok := api.availabilityFromRecord(record, &report); ok {
+				availabilities = append(availabilities, availability)
+				lines = append(lines, record.Line)
+			}
+		}
+		storeErrors, err = api.store.ImportAvailabilities(availabilities, dryRun || len(report.Errors) > 0)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error importing the rows"})
+		return
+	}
+	for i, err := range storeErrors {
+		report.Errors = append(report.Errors, ImportRowError{Line: lines[i], Field: importErrorField(err), Message: err.Error()})
+	}
+
+	if len(report.Errors) > 0 {
+		sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Line < report.Errors[j].Line })
+		report.Message = fmt.Sprintf("%d of the %d rows can't be imported, nothing was saved", countRows(report.Errors), report.Rows)
+		c.IndentedJSON(http.StatusUnprocessableEntity, report)
+		return
+	}
+	if dryRun {
+		report.Message = fmt.Sprintf("All the %d rows can be imported", report.Rows)
+	} else {
+		report.Imported = report.Rows
+		report.Message = fmt.Sprintf("%d rows imported", report.Rows)
+	}
+	c.IndentedJSON(http.StatusOK, report)
+}
+
+// Rows
+
+// teacherFromRecord reads a teacher from a row, adding its errors to the report.
+func teacherFromRecord(record importRecord, report *ImportReport) (Teacher, bool) {
+	teacher := Teacher{
+		Name:     record.Fields["name"],
+		Surname:  record.Fields["surname"],
+		Username: record.Fields["username"],
+		Password: record.Fields["password"],
+		TimeZone: record.Fields["time_zone"],
+		Email:    record.Fields["email"],
+	}
+	//the subjects of a teacher are separated by semicolons, like "Maths;Physics"
+	for _, subject := range strings.Split(record.Fields["subjects"], ";") {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			teacher.Subjects = append(teacher.Subjects, subject)
+		}
+	}
+	if err := validateTeacher(teacher); err != nil {
+		return teacher, addImportErrors(report, record, err)
+	}
+	teacher.Subjects, _ = normalizeSubjects(teacher.Subjects)
+	return teacher, true
+}
+
+// studentFromRecord reads a student from a row, adding its errors to the report.
+// The date of birth is a date like 2001-02-03.
+func studentFromRecord(record importRecord, report *ImportReport) (Student, bool) {
+	student := Student{
+		Name:     record.Fields["name"],
+		Surname:  record.Fields["surname"],
+		Username: record.Fields["username"],
+		Password: record.Fields["password"],
+		TimeZone: record.Fields["time_zone"],
+		Email:    record.Fields["email"],
+	}
+	dateOfBirth, errDate := time.Parse("2006-01-02", record.Fields["date_of_birth"])
+	student.DateOfBirth = dateOfBirth
+	var v validator
+	v.check("", validateStudent(student))
+	if errDate != nil && record.Fields["date_of_birth"] != "" {
+		//a date that can't be read is reported as such rather than as missing
+		v.fields = slices.DeleteFunc(v.fields, func(field FieldError) bool { return field.Field == "date_of_birth" })
+		v.add("date_of_birth", "The date of birth need to be in the YYYY-MM-DD format")
+	}
+	if err := v.err(); err != nil {
+		return student, addImportErrors(report, record, err)
+	}
+	return student, true
+}
+
+// availabilityFromRecord reads an availability from a row, adding its errors to the report. The teacher is
+// given by ID or by username, and the start either as an instant like 2030-01-02T10:00:00Z or as a day and
+// a time like 2030-01-02 10:00 on the clock of the teacher. The duration needs to be allowed by the teacher.
+func (api *apiServer) availabilityFromRecord(record importRecord, report *ImportReport) (ImportedAvailability, bool) {
+	var availability ImportedAvailability
+	if username := record.Fields["teacher_username"]; username != "" {
+		teacher, err := api.store.TeacherByUsername(username)
+		if err != nil {
+			return availability, addImportError(report, record, "teacher_username", fmt.Sprintf("No Teacher with username: %s", username))
+		}
+		availability.TeacherID = teacher.ID
+	} else if id := record.Fields["teacher_id"]; id != "" {
+		teacherID, err := strconv.Atoi(id)
+		if err != nil {
+			return availability, addImportError(report, record, "teacher_id", "Invalid teacher ID")
+		}
+		if isPresent, _ := api.store.TeacherExists(teacherID); !isPresent {
+			return availability, addImportError(report, record, "teacher_id", fmt.Sprintf("No teachers associated with ID %d", teacherID))
+		}
+		availability.TeacherID = teacherID
+	} else {
+		return availability, addImportError(report, record, "teacher_id", "The teacher ID or username is required")
+	}
+
+	loc := api.teacherLocation(availability.TeacherID)
+	ok := true
+	startsAt, err := time.Parse(time.RFC3339, record.Fields["starts_at"])
+	if err != nil {
+		startsAt, err = time.ParseInLocation("2006-01-02 15:04", record.Fields["starts_at"], loc)
+	}
+	if err != nil {
+		ok = addImportError(report, record, "starts_at", "The starting time need to be like 2030-01-02T10:00:00Z or 2030-01-02 10:00")
+	}
+	duration, err := strconv.Atoi(record.Fields["duration_minutes"])
+	if err != nil || duration <= 0 {
+		ok = addImportError(report, record, "duration_minutes", "The duration need to be a number of minutes")
+	}
+	if !ok {
+		return availability, false
+	}
+	availability.StartsAt = startsAt
+	availability.DurationMinutes = duration
+	availability.Subject = normalizeSubject(record.Fields["subject"])
+
+	//the same checks as for an availability added by the teacher
+	policy, err := api.durationPolicyFor(availability.TeacherID, availability.Subject)
+	if err != nil {
+		return availability, addImportError(report, record, "", "Error retrieving the lesson durations")
+	}
+	if err := api.validateAvailability(availability.TeacherID, availability.Availability, policy, time.Now()); err != nil {
+		return availability, addImportErrors(report, record, err)
+	}
+	return availability, true
+}
+
+// Files
+
+// parseImportRecords reads the rows of the file in the format. A row that can't be read is added to the report
+// and left out, a file that can't be read at all is an error.
+func parseImportRecords(format string, body io.Reader, columns []string, report *ImportReport) ([]importRecord, error) {
+	if format == importFormatCSV {
+		return parseImportCSV(body, columns, report)
+	}
+	return parseImportJSONL(body, columns, report)
+}
+
+// parseImportCSV reads a csv file whose first row names the columns, in any order.
+func parseImportCSV(body io.Reader, columns []string, report *ImportReport) ([]importRecord, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, csvError(err)
+	}
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !slices.Contains(columns, header[i]) {
+			return nil, fmt.Errorf("Unknown column %q: the columns are %s", name, strings.Join(columns, ", "))
+		}
+	}
+
+	var records []importRecord
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, csvError(err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(fields) != len(header) {
+			addImportError(report, importRecord{Line: line}, "", fmt.Sprintf("The row has %d fields instead of %d", len(fields), len(header)))
+			continue
+		}
+		record := importRecord{Line: line, Fields: map[string]string{}}
+		for i, name := range header {
+			record.Fields[name] = strings.TrimSpace(fields[i])
+		}
+		records = append(records, record)
+	}
+}
+
+// parseImportJSONL reads a file with a JSON object on each line. The empty lines are skipped.
+func parseImportJSONL(body io.Reader, columns []string, report *ImportReport) ([]importRecord, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxImportSize)
+	var records []importRecord
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var object map[string]any
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			addImportError(report, importRecord{Line: line}, "", "The line isn't a JSON object")
+			continue
+		}
+
+		//the errors of a field don't stop the checks of the others
+		record := importRecord{Line: line, Fields: map[string]string{}}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !slices.Contains(columns, name) {
+				addImportError(report, record, name, fmt.Sprintf("Unknown field %q: the fields are %s", name, strings.Join(columns, ", ")))
+				continue
+			}
+			switch value := object[name].(type) {
+			case string:
+				record.Fields[name] = strings.TrimSpace(value)
+			case json.Number:
+				record.Fields[name] = value.String()
+			case nil:
+			default:
+				addImportError(report, record, name, "The value need to be a string or a number")
+			}
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// Utils
+
+// importFormat is the format of the imported file, from ?format= or from the Content-Type.
+func importFormat(c *gin.Context) string {
+	if format := c.Query("format"); format != "" {
+		return strings.ToLower(format)
+	}
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return importFormatCSV
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return importFormatJSONL
+	}
+	return ""
+}
+
+// addImportError adds an error of the row to the report and returns false, so that the
+// row can be marked as not ok in the same statement.
+func addImportError(report *ImportReport, record importRecord, field, message string) bool {
+	report.Errors = append(report.Errors, ImportRowError{Line: record.Line, Field: field, Message: message})
+	return false
+}
+
+// addImportErrors adds every error of a *ValidationError to the report and returns false.
+func addImportErrors(report *ImportReport, record importRecord, err error) bool {
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		return addImportError(report, record, "", err.Error())
+	}
+	for _, field := range invalid.Fields {
+		addImportError(report, record, field.Field, field.Message)
+	}
+	return false
+}
+
+// importErrorField is the column an error of the store is about, if any.
+func importErrorField(err error) string {
+	var teacherErr *ErrTeacherNotFound
+	switch {
+	case errors.Is(err, ErrOverlappingAvailabilities):
+		return "starts_at"
+	case errors.As(err, &teacherErr):
+		return "teacher_id"
+	case errors.Is(err, ErrUsernameTaken):
+		return "username"
+	case errors.Is(err, ErrTeacherPasswordRequired), errors.Is(err, ErrPasswordRequired), errors.Is(err, ErrPasswordTooLong),
+		errors.Is(err, ErrPasswordTooShort), errors.Is(err, ErrPasswordTooWeak):
+		return "password"
+	}
+	return ""
+}
+
+// countRows counts the rows with at least an error.
+func countRows(rowErrors []ImportRowError) int {
+	lines := map[int]bool{}
+	for _, rowError := range rowErrors {
+		lines[rowError.Line] = true
+	}
+	return len(lines)
+}
+
+// csvError describes an error of the csv reader with the line it was found on.
+func csvError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Errorf("The file isn't a valid csv file: line %d: %v", parseErr.Line, parseErr.Err)
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// importCSV posts the csv file as the administrator to import the rows of the type.
+func (a *testAPI) importCSV(kind, file string) *httptest.ResponseRecorder {
+	a.t.Helper()
+	request := httptest.NewRequest(http.MethodPost, "/api/import?type="+kind+"&format=csv", strings.NewReader(file))
+	request.Header.Set("Content-Type", "text/csv")
+	request.Header.Set("Authorization", "Bearer "+a.admin)
+	recorder := httptest.NewRecorder()
+	a.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestImportReportsTakenUsernamesAndSavesNothing(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testImportTakenUsernames(t, newTestAPI(t))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		testImportTakenUsernames(t, newTestAPIOn(t, newTestSQLiteStore(t), loginPolicy{}))
+	})
+}
+
+// testImportTakenUsernames imports students whose usernames are taken, by a saved student or by a row
+// before them in the file: the rows are reported on their username and none of the students is saved.
+func testImportTakenUsernames(t *testing.T, api *testAPI) {
+	api.addStudent("alice")
+	file := "name,surname,date_of_birth,username,password,time_zone\n" +
+		"Bob,Smith,2001-02-03,bob,passw0rd1,UTC\n" +
+		"Alice,Again,2001-02-03,alice,passw0rd1,UTC\n" +
+		"Carol,Jones,2001-02-03,carol,passw0rd1,UTC\n" +
+		"Carol,Twice,2001-02-03,carol,passw0rd1,UTC\n"
+
+	response := api.importCSV(importTypeStudents, file)
+	api.expect(response, http.StatusUnprocessableEntity)
+	var report ImportReport
+	api.decode(response, &report)
+	if len(report.Errors) != 2 || report.Imported != 0 {
+		t.Fatalf("got the report %+v", report)
+	}
+	for i, line := range []int{3, 5} {
+		if rowError := report.Errors[i]; rowError.Line != line || rowError.Field != "username" {
+			t.Errorf("got the error %+v, want the username of line %d", rowError, line)
+		}
+	}
+
+	response = api.do(http.MethodGet, "/api/student/allstudents", api.admin, nil)
+	api.expect(response, http.StatusOK)
+	var students []Student
+	api.decode(response, &students)
+	if len(students) != 1 {
+		t.Fatalf("got the students %+v, want only alice", students)
+	}
+}
+
+func TestImportedTeacherAccountNeedsAPassword(t *testing.T) {
+	api := newTestAPIOn(t, newTestSQLiteStore(t), loginPolicy{})
+	file := "name,surname,username,password,time_zone\n" +
+		"Ada,Lovelace,ada,,UTC\n"
+
+	response := api.importCSV(importTypeTeachers, file)
+	api.expect(response, http.StatusUnprocessableEntity)
+	var report ImportReport
+	api.decode(response, &report)
+	if len(report.Errors) != 1 || report.Errors[0].Field != "password" {
+		t.Fatalf("got the report %+v", report)
+	}
+}
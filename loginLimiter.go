@@ -0,0 +1,157 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// reasons of the refused logins
+const (
+	loginFailureInvalidCredentials = "invalid_credentials"
+	loginFailureAccountLocked      = "account_locked"
+	loginFailureTooManyAttempts    = "too_many_attempts"
+)
+
+// defaults of the login limits, unless GOTUTOR_LOGIN_IP_LIMIT, GOTUTOR_LOGIN_MAX_FAILURES and
+// GOTUTOR_LOGIN_LOCKOUT say otherwise
+const (
+	defaultLoginIPLimit     = 20
+	defaultLoginMaxFailures = 5
+	defaultLoginLockout     = 15 * time.Minute
+)
+
+// loginIPWindow is the window the login attempts of an address are counted in
+const loginIPWindow = time.Minute
+
+// loginPolicy limits the logins. Every address can try IPLimit times a minute, and an account is locked
+// for Lockout after MaxFailures failed logins, each within Lockout of the previous one.
+// A zero limit turns its check off.
+type loginPolicy struct {
+	IPLimit     int
+	MaxFailures int
+	Lockout     time.Duration
+}
+
+// newLoginPolicyFromEnv reads the login limits from the environment.
+func newLoginPolicyFromEnv() loginPolicy {
+	return loginPolicy{
+		IPLimit:     intFromEnv("GOTUTOR_LOGIN_IP_LIMIT", defaultLoginIPLimit),
+		MaxFailures: intFromEnv("GOTUTOR_LOGIN_MAX_FAILURES", defaultLoginMaxFailures),
+		Lockout:     durationFromEnv("GOTUTOR_LOGIN_LOCKOUT", defaultLoginLockout),
+	}
+}
+
+// loginAccount identifies the account of a login by the username given, whether it exists or not,
+// so that a lockout doesn't tell which accounts exist
+type loginAccount struct {
+	Role     string
+	Username string
+}
+
+// loginCounter counts the attempts of an address or the failures of an account.
+type loginCounter struct {
+	count int
+	// since is when the window of an address started, or when the last failure of an account happened
+	since time.Time
+	// blockedUntil is when the address or the account can log in again
+	blockedUntil time.Time
+	// recorded is set once a login refused during the block is recorded, so that a flood of them is recorded once
+	recorded bool
+}
+
+// loginLimiter keeps the counters of the logins in memory: a restart of the API lifts the blocks.
+type loginLimiter struct {
+	policy loginPolicy
+
+	mu        sync.Mutex
+	ips       map[string]*loginCounter
+	accounts  map[loginAccount]*loginCounter
+	lastSweep time.Time
+}
+
+// newLoginLimiter returns a limiter without any login counted.
+func newLoginLimiter(policy loginPolicy) *loginLimiter {
+	return &loginLimiter{policy: policy, ips: map[string]*loginCounter{}, accounts: map[loginAccount]*loginCounter{}}
+}
+
+// allow counts a login attempt of the address for the account. When the address or the account is blocked,
+// it returns the reason and how long until the next attempt, and record is true for the first attempt refused
+// during the block.
+func (l *loginLimiter) allow(ip string, account loginAccount, now time.Time) (reason string, retryAfter time.Duration, record bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	if l.policy.IPLimit > 0 {
+		counter := l.ips[ip]
+		if counter == nil || !now.Before(counter.since.Add(loginIPWindow)) {
+			counter = &loginCounter{since: now}
+			l.ips[ip] = counter
+		}
+		counter.count++
+		if counter.count > l.policy.IPLimit {
+			counter.blockedUntil = counter.since.Add(loginIPWindow)
+			return loginFailureTooManyAttempts, counter.blockedUntil.Sub(now), counter.refuse()
+		}
+	}
+	if counter := l.accounts[account]; counter != nil && now.Before(counter.blockedUntil) {
+		return loginFailureAccountLocked, counter.blockedUntil.Sub(now), counter.refuse()
+	}
+	return "", 0, false
+}
+
+// failed counts a failed login of the account, locking it after too many of them.
+func (l *loginLimiter) failed(account loginAccount, now time.Time) {
+	if l.policy.MaxFailures <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	counter := l.accounts[account]
+	if counter == nil || !now.Before(counter.since.Add(l.policy.Lockout)) {
+		//the failures further apart than the lockout don't add up
+		counter = &loginCounter{}
+		l.accounts[account] = counter
+	}
+	counter.count++
+	counter.since = now
+	if counter.count >= l.policy.MaxFailures {
+		counter.count = 0
+		counter.blockedUntil = now.Add(l.policy.Lockout)
+		counter.recorded = false
+	}
+}
+
+// succeeded forgets the failures of the account.
+func (l *loginLimiter) succeeded(account loginAccount) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.accounts, account)
+}
+
+// sweep drops the counters that no longer block or count anything, at most once per loginIPWindow,
+// so that the addresses and the usernames tried don't pile up. The caller holds the lock.
+func (l *loginLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < loginIPWindow {
+		return
+	}
+	l.lastSweep = now
+	for ip, counter := range l.ips {
+		if !now.Before(counter.since.Add(loginIPWindow)) {
+			delete(l.ips, ip)
+		}
+	}
+	for account, counter := range l.accounts {
+		if !now.Before(counter.since.Add(l.policy.Lockout)) && !now.Before(counter.blockedUntil) {
+			delete(l.accounts, account)
+		}
+	}
+}
+
+// refuse marks the counter as refusing a login and returns true the first time during the block.
+func (counter *loginCounter) refuse() bool {
+	first := !counter.recorded
+	counter.recorded = true
+	return first
+}
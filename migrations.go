@@ -0,0 +1,733 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// migration is a numbered step of the database schema.
+// Up applies the step and Down reverts it; both run inside a transaction
+// together with the update of the schema_migrations table.
+type migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+	Down    func(tx *sql.Tx) error
+}
+
+// migrationStatus tells whether a migration has been applied and when.
+type migrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// migrations lists every schema step in order. New steps are appended at the end
+// and existing ones are never changed once released.
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "create students, teachers, availabilities and bookings",
+		Up: sqlSteps(
+			`CREATE TABLE IF NOT EXISTS students (
+				Name TEXT NOT NULL,
+				Surname TEXT NOT NULL,
+				DateOfBirth DATE NOT NULL,
+				Username TEXT NOT NULL UNIQUE,
+				Password TEXT NOT NULL,
+				PRIMARY KEY (Username)
+			)`,
+			`CREATE TABLE IF NOT EXISTS teachers (
+				ID INTEGER PRIMARY KEY AUTOINCREMENT,
+				Name TEXT NOT NULL,
+				Surname TEXT NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS availabilities (
+				ID INTEGER PRIMARY KEY AUTOINCREMENT,
+				TeacherID INTEGER NOT NULL,
+				Day DATE NOT NULL,
+				StartingTime DATE NOT NULL,
+				EndingTime DATE NOT NULL,
+				Booked BOOLEAN NOT NULL,
+				FOREIGN KEY (TeacherID) REFERENCES teachers(ID)
+			)`,
+			`CREATE TABLE IF NOT EXISTS bookings (
+				ID INTEGER PRIMARY KEY AUTOINCREMENT,
+				StudentUsername TEXT NOT NULL,
+				TeacherID INTEGER NOT NULL,
+				AvailabilityID INTEGER NOT NULL,
+				Subject TEXT NOT NULL,
+				FOREIGN KEY (StudentUsername) REFERENCES students(Username),
+				FOREIGN KEY (TeacherID) REFERENCES teachers(ID),
+				FOREIGN KEY (AvailabilityID) REFERENCES availabilities(ID)
+			)`,
+		),
+		Down: sqlSteps(
+			`DROP TABLE IF EXISTS bookings`,
+			`DROP TABLE IF EXISTS availabilities`,
+			`DROP TABLE IF EXISTS teachers`,
+			`DROP TABLE IF EXISTS students`,
+		),
+	},
+	{
+		Version: 2,
+		Name:    "add teacher credentials",
+		Up: sqlSteps(
+			`ALTER TABLE teachers ADD COLUMN Username TEXT`,
+			`ALTER TABLE teachers ADD COLUMN Password TEXT`,
+			`CREATE UNIQUE INDEX teachers_username ON teachers(Username)`,
+		),
+		Down: sqlSteps(
+			`DROP INDEX teachers_username`,
+			`ALTER TABLE teachers DROP COLUMN Password`,
+			`ALTER TABLE teachers DROP COLUMN Username`,
+		),
+	},
+	{
+		Version: 3,
+		Name:    "add recurring availability rules",
+		Up: sqlSteps(
+			`CREATE TABLE availability_rules (
+				ID INTEGER PRIMARY KEY AUTOINCREMENT,
+				TeacherID INTEGER NOT NULL,
+				Weekdays TEXT NOT NULL,
+				StartingTime TEXT NOT NULL,
+				EndingTime TEXT NOT NULL,
+				StartDate DATE NOT NULL,
+				EndDate DATE NOT NULL,
+				ExceptDates TEXT NOT NULL,
+				Cancelled BOOLEAN NOT NULL,
+				FOREIGN KEY (TeacherID) REFERENCES teachers(ID)
+			)`,
+			`ALTER TABLE availabilities ADD COLUMN RuleID INTEGER REFERENCES availability_rules(ID)`,
+		),
+		Down: sqlSteps(
+			`ALTER TABLE availabilities DROP COLUMN RuleID`,
+			`DROP TABLE availability_rules`,
+		),
+	},
+	{
+		Version: 4,
+		Name:    "add lesson duration policies",
+		Up: sqlSteps(
+			`CREATE TABLE duration_policies (
+				TeacherID INTEGER NOT NULL,
+				Subject TEXT NOT NULL,
+				Durations TEXT NOT NULL,
+				Granularity INTEGER NOT NULL,
+				PRIMARY KEY (TeacherID, Subject),
+				FOREIGN KEY (TeacherID) REFERENCES teachers(ID)
+			)`,
+			`ALTER TABLE availabilities ADD COLUMN Subject TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE availability_rules ADD COLUMN Duration INTEGER NOT NULL DEFAULT 60`,
+			`ALTER TABLE availability_rules ADD COLUMN Subject TEXT NOT NULL DEFAULT ''`,
+		),
+		Down: sqlSteps(
+			`ALTER TABLE availability_rules DROP COLUMN Subject`,
+			`ALTER TABLE availability_rules DROP COLUMN Duration`,
+			`ALTER TABLE availabilities DROP COLUMN Subject`,
+			`DROP TABLE duration_policies`,
+		),
+	},
+	{
+		Version: 5,
+		Name:    "store availabilities as UTC start and duration, add time zones",
+		Up: func(tx *sql.Tx) error {
+			err := sqlSteps(
+				`ALTER TABLE students ADD COLUMN TimeZone TEXT NOT NULL DEFAULT 'UTC'`,
+				`ALTER TABLE teachers ADD COLUMN TimeZone TEXT NOT NULL DEFAULT 'UTC'`,
+				`ALTER TABLE availability_rules ADD COLUMN TimeZone TEXT NOT NULL DEFAULT 'UTC'`,
+			)(tx)
+			if err != nil {
+				return err
+			}
+			return convertAvailabilitiesToUTC(tx)
+		},
+		Down: func(tx *sql.Tx) error {
+			if err := convertAvailabilitiesToDayAndTimes(tx); err != nil {
+				return err
+			}
+			return sqlSteps(
+				`ALTER TABLE availability_rules DROP COLUMN TimeZone`,
+				`ALTER TABLE teachers DROP COLUMN TimeZone`,
+				`ALTER TABLE students DROP COLUMN TimeZone`,
+			)(tx)
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add booking status and cancellation details",
+		Up: sqlSteps(
+			`ALTER TABLE bookings ADD COLUMN Status TEXT NOT NULL DEFAULT 'booked'`,
+			// the bookings keep the time of their lesson, so that the cancelled ones still show it
+			// after the availability has been deleted
+			`ALTER TABLE bookings ADD COLUMN StartsAt DATETIME`,
+			`ALTER TABLE bookings ADD COLUMN DurationMinutes INTEGER NOT NULL DEFAULT 0`,
+			`UPDATE bookings SET
+				StartsAt = (SELECT a.StartsAt FROM availabilities a WHERE a.ID = bookings.AvailabilityID),
+				DurationMinutes = COALESCE((SELECT a.DurationMinutes FROM availabilities a WHERE a.ID = bookings.AvailabilityID), 0)`,
+			`ALTER TABLE bookings ADD COLUMN CancelledBy TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE bookings ADD COLUMN CancellationReason TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE bookings ADD COLUMN CancelledAt DATETIME`,
+			`CREATE INDEX bookings_student_status ON bookings(StudentUsername, Status)`,
+		),
+		Down: sqlSteps(
+			// before this version a cancelled booking was deleted
+			`DELETE FROM bookings WHERE Status IN ('cancelled_by_student', 'cancelled_by_teacher')`,
+			`DROP INDEX bookings_student_status`,
+			`ALTER TABLE bookings DROP COLUMN CancelledAt`,
+			`ALTER TABLE bookings DROP COLUMN CancellationReason`,
+			`ALTER TABLE bookings DROP COLUMN CancelledBy`,
+			`ALTER TABLE bookings DROP COLUMN DurationMinutes`,
+			`ALTER TABLE bookings DROP COLUMN StartsAt`,
+			`ALTER TABLE bookings DROP COLUMN Status`,
+		),
+	},
+	{
+		Version: 7,
+		Name:    "add waitlist",
+		Up: sqlSteps(
+			`CREATE TABLE waitlist (
+				ID INTEGER PRIMARY KEY AUTOINCREMENT,
+				StudentUsername TEXT NOT NULL,
+				TeacherID INTEGER NOT NULL,
+				AvailabilityID INTEGER,
+				WeekStart DATETIME,
+				WeekEnd DATETIME,
+				Subject TEXT NOT NULL,
+				Status TEXT NOT NULL,
+				BookingID INTEGER,
+				CreatedAt DATETIME NOT NULL,
+				FOREIGN KEY (StudentUsername) REFERENCES students(Username),
+				FOREIGN KEY (TeacherID) REFERENCES teachers(ID),
+				FOREIGN KEY (AvailabilityID) REFERENCES availabilities(ID),
+				FOREIGN KEY (BookingID) REFERENCES bookings(ID)
+			)`,
+			`CREATE INDEX waitlist_teacher_status ON waitlist(TeacherID, Status)`,
+		),
+		Down: sqlSteps(
+			`DROP TABLE waitlist`,
+		),
+	},
+	{
+		Version: 8,
+		Name:    "add web sessions",
+		Up: sqlSteps(
+			// Token is the SHA-256 hash of the session cookie
+			`CREATE TABLE web_sessions (
+				Token TEXT PRIMARY KEY,
+				Username TEXT NOT NULL,
+				Role TEXT NOT NULL,
+				TeacherID INTEGER NOT NULL DEFAULT 0,
+				APIToken TEXT NOT NULL,
+				APITokenExpiresAt DATETIME NOT NULL,
+				TimeZone TEXT NOT NULL DEFAULT '',
+				ExpiresAt DATETIME NOT NULL
+			)`,
+			`CREATE INDEX web_sessions_expires_at ON web_sessions(ExpiresAt)`,
+		),
+		Down: sqlSteps(
+			`DROP TABLE web_sessions`,
+		),
+	},
+	{
+		Version: 9,
+		Name:    "add CSRF tokens to web sessions",
+		Up: sqlSteps(
+			// the sessions saved before get a token when they are next used
+			`ALTER TABLE web_sessions ADD COLUMN CSRFToken TEXT NOT NULL DEFAULT ''`,
+		),
+		Down: sqlSteps(
+			`ALTER TABLE web_sessions DROP COLUMN CSRFToken`,
+		),
+	},
+	{
+		Version: 10,
+		Name:    "add calendar feeds",
+		Up: sqlSteps(
+			// a feed belongs either to a student or to a teacher
+			`CREATE TABLE calendar_feeds (
+				Token TEXT PRIMARY KEY,
+				StudentUsername TEXT UNIQUE,
+				TeacherID INTEGER UNIQUE,
+				CreatedAt DATETIME NOT NULL,
+				FOREIGN KEY (StudentUsername) REFERENCES students(Username),
+				FOREIGN KEY (TeacherID) REFERENCES teachers(ID)
+			)`,
+			// the feeds of the teachers count the changes of the availabilities and cancel the deleted ones
+			`ALTER TABLE availabilities ADD COLUMN Sequence INTEGER NOT NULL DEFAULT 0`,
+			`CREATE TABLE deleted_availabilities (
+				ID INTEGER PRIMARY KEY,
+				TeacherID INTEGER NOT NULL,
+				StartsAt TIMESTAMP NOT NULL,
+				DurationMinutes INTEGER NOT NULL,
+				Subject TEXT NOT NULL,
+				Sequence INTEGER NOT NULL,
+				DeletedAt TIMESTAMP NOT NULL,
+				FOREIGN KEY (TeacherID) REFERENCES teachers(ID)
+			)`,
+			`CREATE INDEX deleted_availabilities_teacher ON deleted_availabilities(TeacherID)`,
+		),
+		Down: sqlSteps(
+			`DROP TABLE deleted_availabilities`,
+			`ALTER TABLE availabilities DROP COLUMN Sequence`,
+			`DROP TABLE calendar_feeds`,
+		),
+	},
+	{
+		Version: 11,
+		Name:    "add email addresses",
+		Up: sqlSteps(
+			`ALTER TABLE students ADD COLUMN Email TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE teachers ADD COLUMN Email TEXT NOT NULL DEFAULT ''`,
+		),
+		Down: sqlSteps(
+			`ALTER TABLE teachers DROP COLUMN Email`,
+			`ALTER TABLE students DROP COLUMN Email`,
+		),
+	},
+	{
+		Version: 12,
+		Name:    "add scheduler state",
+		Up: sqlSteps(
+			`CREATE TABLE job_runs (
+				Name TEXT PRIMARY KEY,
+				LastRunAt DATETIME NOT NULL,
+				LastError TEXT NOT NULL DEFAULT ''
+			)`,
+			// a reminder is recorded once per booking, so that it is never sent twice
+			`CREATE TABLE lesson_reminders (
+				BookingID INTEGER NOT NULL,
+				Reminder TEXT NOT NULL,
+				SentAt DATETIME NOT NULL,
+				PRIMARY KEY (BookingID, Reminder),
+				FOREIGN KEY (BookingID) REFERENCES bookings(ID)
+			)`,
+		),
+		Down: sqlSteps(
+			`DROP TABLE lesson_reminders`,
+			`DROP TABLE job_runs`,
+		),
+	},
+	{
+		Version: 13,
+		Name:    "add teacher subjects",
+		Up: sqlSteps(
+			`CREATE TABLE subjects (
+				ID INTEGER PRIMARY KEY AUTOINCREMENT,
+				Name TEXT NOT NULL UNIQUE COLLATE NOCASE
+			)`,
+			`CREATE TABLE teacher_subjects (
+				TeacherID INTEGER NOT NULL,
+				SubjectID INTEGER NOT NULL,
+				PRIMARY KEY (TeacherID, SubjectID),
+				FOREIGN KEY (TeacherID) REFERENCES teachers(ID),
+				FOREIGN KEY (SubjectID) REFERENCES subjects(ID)
+			)`,
+			`CREATE INDEX teacher_subjects_subject ON teacher_subjects(SubjectID)`,
+		),
+		Down: sqlSteps(
+			`DROP TABLE teacher_subjects`,
+			`DROP TABLE subjects`,
+		),
+	},
+	{
+		Version: 14,
+		Name:    "add admin accounts",
+		Up: sqlSteps(
+			`CREATE TABLE admins (
+				Username TEXT PRIMARY KEY,
+				Password TEXT NOT NULL,
+				CreatedBy TEXT NOT NULL,
+				CreatedAt TIMESTAMP NOT NULL
+			)`,
+		),
+		Down: sqlSteps(`DROP TABLE admins`),
+	},
+	{
+		Version: 15,
+		Name:    "add student password change times",
+		Up:      sqlSteps(`ALTER TABLE students ADD COLUMN PasswordChangedAt TIMESTAMP`),
+		Down:    sqlSteps(`ALTER TABLE students DROP COLUMN PasswordChangedAt`),
+	},
+	{
+		Version: 16,
+		Name:    "add password resets",
+		Up: sqlSteps(
+			`CREATE TABLE password_resets (
+				TokenHash TEXT PRIMARY KEY,
+				StudentUsername TEXT NOT NULL,
+				CreatedAt TIMESTAMP NOT NULL,
+				ExpiresAt TIMESTAMP NOT NULL,
+				UsedAt TIMESTAMP,
+				FOREIGN KEY (StudentUsername) REFERENCES students(Username)
+			)`,
+			`CREATE INDEX password_resets_student ON password_resets(StudentUsername)`,
+		),
+		Down: sqlSteps(`DROP TABLE password_resets`),
+	},
+	{
+		Version: 17,
+		Name:    "add login failures",
+		Up: sqlSteps(
+			`CREATE TABLE login_failures (
+				ID INTEGER PRIMARY KEY AUTOINCREMENT,
+				Username TEXT NOT NULL,
+				Role TEXT NOT NULL,
+				IP TEXT NOT NULL,
+				Reason TEXT NOT NULL,
+				AttemptedAt TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX login_failures_username ON login_failures(Username)`,
+		),
+		Down: sqlSteps(`DROP TABLE login_failures`),
+	},
+}
+
+// sqlSteps returns a migration function executing the given statements in order.
+func sqlSteps(statements ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// availabilityRow is a row of the availabilities table while it is being rebuilt by a migration.
+type availabilityRow struct {
+	ID, TeacherID int
+	Start, End    time.Time
+	Booked        bool
+	RuleID        sql.NullInt64
+	Subject       string
+}
+
+// convertAvailabilitiesToUTC rebuilds the availabilities table replacing the Day, StartingTime and
+// EndingTime columns with the UTC instant the lesson starts and its duration.
+// The stored times carry their offset, so they are converted to the same instant in UTC.
+func convertAvailabilitiesToUTC(tx *sql.Tx) error {
+	rows, err := readAvailabilityRows(tx, "SELECT ID, TeacherID, StartingTime, EndingTime, Booked, RuleID, Subject FROM availabilities")
+	if err != nil {
+		return err
+	}
+
+	err = sqlSteps(
+		`CREATE TABLE availabilities_utc (
+			ID INTEGER PRIMARY KEY AUTOINCREMENT,
+			TeacherID INTEGER NOT NULL,
+			StartsAt DATETIME NOT NULL,
+			DurationMinutes INTEGER NOT NULL,
+			Booked BOOLEAN NOT NULL,
+			RuleID INTEGER REFERENCES availability_rules(ID),
+			Subject TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY (TeacherID) REFERENCES teachers(ID)
+		)`,
+	)(tx)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		_, err := tx.Exec(`
+			INSERT INTO availabilities_utc (ID, TeacherID, StartsAt, DurationMinutes, Booked, RuleID, Subject)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, row.ID, row.TeacherID, row.Start.UTC(), int(row.End.Sub(row.Start).Minutes()), row.Booked, row.RuleID, row.Subject)
+		if err != nil {
+			return err
+		}
+	}
+
+	return sqlSteps(
+		`DROP TABLE availabilities`,
+		`ALTER TABLE availabilities_utc RENAME TO availabilities`,
+		`CREATE INDEX availabilities_teacher_start ON availabilities(TeacherID, StartsAt)`,
+	)(tx)
+}
+
+// convertAvailabilitiesToDayAndTimes reverts convertAvailabilitiesToUTC, the times are kept in UTC.
+func convertAvailabilitiesToDayAndTimes(tx *sql.Tx) error {
+	rows, err := readAvailabilityRows(tx, `
+		SELECT ID, TeacherID, StartsAt, datetime(StartsAt, '+' || DurationMinutes || ' minutes'), Booked, RuleID, Subject
+		FROM availabilities
+	`)
+	if err != nil {
+		return err
+	}
+
+	err = sqlSteps(
+		`CREATE TABLE availabilities_local (
+			ID INTEGER PRIMARY KEY AUTOINCREMENT,
+			TeacherID INTEGER NOT NULL,
+			Day DATE NOT NULL,
+			StartingTime DATE NOT NULL,
+			EndingTime DATE NOT NULL,
+			Booked BOOLEAN NOT NULL,
+			RuleID INTEGER REFERENCES availability_rules(ID),
+			Subject TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY (TeacherID) REFERENCES teachers(ID)
+		)`,
+	)(tx)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		_, err := tx.Exec(`
+			INSERT INTO availabilities_local (ID, TeacherID, Day, StartingTime, EndingTime, Booked, RuleID, Subject)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, row.ID, row.TeacherID, dateOnly(row.Start), row.Start.UTC(), row.End.UTC(), row.Booked, row.RuleID, row.Subject)
+		if err != nil {
+			return err
+		}
+	}
+
+	return sqlSteps(
+		`DROP TABLE availabilities`,
+		`ALTER TABLE availabilities_local RENAME TO availabilities`,
+	)(tx)
+}
+
+// readAvailabilityRows reads all the availabilities returned by the query, which selects
+// the ID, the teacher, the start, the end, the booked flag, the rule and the subject.
+func readAvailabilityRows(tx *sql.Tx, query string) ([]availabilityRow, error) {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var availabilities []availabilityRow
+	for rows.Next() {
+		var row availabilityRow
+		var start, end any
+		if err := rows.Scan(&row.ID, &row.TeacherID, &start, &end, &row.Booked, &row.RuleID, &row.Subject); err != nil {
+			return nil, err
+		}
+		if row.Start, err = parseStoredTime(start); err != nil {
+			return nil, err
+		}
+		if row.End, err = parseStoredTime(end); err != nil {
+			return nil, err
+		}
+		availabilities = append(availabilities, row)
+	}
+	return availabilities, rows.Err()
+}
+
+// parseStoredTime reads a time as returned by the SQLite driver: already parsed for the DATE columns,
+// as text for the results of the SQLite date functions.
+func parseStoredTime(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		for _, layout := range sqlite3.SQLiteTimestampFormats {
+			if t, err := time.ParseInLocation(layout, v, time.UTC); err == nil {
+				return t, nil
+			}
+		}
+	case []byte:
+		return parseStoredTime(string(v))
+	}
+	return time.Time{}, fmt.Errorf("Unexpected stored time %v", value)
+}
+
+// createMigrationsTable creates the table keeping track of the applied migrations.
+func createMigrationsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			Version INTEGER PRIMARY KEY,
+			Name TEXT NOT NULL,
+			AppliedAt DATE NOT NULL
+		)
+	`)
+	return err
+}
+
+// getAppliedMigrations returns the time at which each applied migration was run, by version.
+func getAppliedMigrations(db *sql.DB) (map[int]time.Time, error) {
+	if err := createMigrationsTable(db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT Version, AppliedAt FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// getSchemaVersion returns the version of the last applied migration, 0 if none.
+func getSchemaVersion(db *sql.DB) (int, error) {
+	applied, err := getAppliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// latestSchemaVersion is the version the code expects the database to be at.
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// migrateUp applies all the pending migrations and returns the ones that were run.
+func migrateUp(db *sql.DB) ([]migration, error) {
+	applied, err := getAppliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var run []migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := runMigration(db, m.Version, m.Up, func(tx *sql.Tx) error {
+			_, err := tx.Exec("INSERT INTO schema_migrations (Version, Name, AppliedAt) VALUES (?, ?, ?)", m.Version, m.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return run, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		run = append(run, m)
+	}
+
+	return run, nil
+}
+
+// migrateDown reverts the last applied migration and returns it, nil if there was nothing to revert.
+func migrateDown(db *sql.DB) (*migration, error) {
+	version, err := getSchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return nil, nil
+	}
+
+	for i := range migrations {
+		m := migrations[i]
+		if m.Version != version {
+			continue
+		}
+		err := runMigration(db, m.Version, m.Down, func(tx *sql.Tx) error {
+			_, err := tx.Exec("DELETE FROM schema_migrations WHERE Version = ?", m.Version)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		return &m, nil
+	}
+
+	return nil, fmt.Errorf("Unknown migration version %d", version)
+}
+
+// runMigration runs a migration step and its bookkeeping in the same transaction.
+func runMigration(db *sql.DB, version int, step, record func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := step(tx); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// getMigrationsStatus returns the status of every known migration.
+func getMigrationsStatus(db *sql.DB) ([]migrationStatus, error) {
+	applied, err := getAppliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []migrationStatus
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		statuses = append(statuses, migrationStatus{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: appliedAt})
+	}
+	return statuses, nil
+}
+
+// migrateCommand runs the "-m migrate" mode: up, down or status.
+func migrateCommand(args []string) {
+	if len(args) != 1 || (args[0] != "up" && args[0] != "down" && args[0] != "status") {
+		fmt.Println("Usage: server.exe -m migrate up|down|status")
+		os.Exit(2)
+	}
+
+	db, err := openDatabase(databasePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		run, err := migrateUp(db)
+		for _, m := range run {
+			fmt.Printf("Applied migration %d: %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(run) == 0 {
+			fmt.Println("The database is already up to date")
+		}
+	case "down":
+		m, err := migrateDown(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if m == nil {
+			fmt.Println("There are no migrations to revert")
+		} else {
+			fmt.Printf("Reverted migration %d: %s\n", m.Version, m.Name)
+		}
+	case "status":
+		statuses, err := getMigrationsStatus(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, status := range statuses {
+			if status.Applied {
+				fmt.Printf("%4d  applied %s  %s\n", status.Version, status.AppliedAt.Format("2006-01-02 15:04"), status.Name)
+			} else {
+				fmt.Printf("%4d  pending                   %s\n", status.Version, status.Name)
+			}
+		}
+	}
+}
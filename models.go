@@ -2,56 +2,56 @@ package main
 
 import (
 	"time"
+
+	"server/models"
 )
 
 type Page struct {
-	Title string `json:"title"`
-	Body  string `json:"body"`
-}
-
-type Student struct {
-	Name        string    `json:"name" sqlite:"not null"`
-	Surname     string    `json:"surname" sqlite:"not null"`
-	DateOfBirth time.Time `json:"date_of_birth" sqlite:"not null"`
-	Username    string    `json:"username" sqlite:"primary key"`
-	Password    string    `json:"password" sqlite:"not null"`
-}
-
-type Teacher struct {
-	ID      int    `json:"id" sqlite:"primary key"`
-	Name    string `json:"name" sqlite:"not null"`
-	Surname string `json:"surname" sqlite:"not null"`
-}
-
-type Availability struct {
-	ID           int       `json:"id" sqlite:"primary key"`
-	Day          time.Time `json:"day" sqlite:"not null"`
-	StartingTime time.Time `json:"starting_time" sqlite:"not null"`
-	EndingTime   time.Time `json:"ending_time" sqlite:"not null"`
-	Booked       bool      `json:"booked" sqlite:"not null"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	CSRFToken string `json:"-"`
 }
 
-type LessonReservation struct {
-	ID              int    `json:"id" sqlite:"primary key"`
-	StudentUsername string `json:"student_id" sqlite:"not null"`
-	TeacherID       int    `json:"teacher_id" sqlite:"not null"`
-	AvailabilityID  int    `json:"availability_id" sqlite:"not null"`
-	Subject         string `json:"subject" sqlite:"not null"`
-}
+// the records of the application, shared with the users of the API
+type (
+	Student                   = models.Student
+	Teacher                   = models.Teacher
+	Admin                     = models.Admin
+	Subject                   = models.Subject
+	TeacherSearch             = models.TeacherSearch
+	Availability              = models.Availability
+	ImportedAvailability      = models.ImportedAvailability
+	DataExport                = models.DataExport
+	ExportedAvailability      = models.ExportedAvailability
+	AvailabilityRule          = models.AvailabilityRule
+	DurationPolicy            = models.DurationPolicy
+	AvailabilityRuleExpansion = models.AvailabilityRuleExpansion
+	LessonReservation         = models.LessonReservation
+	BookingCancellation       = models.BookingCancellation
+	LessonBooked              = models.LessonBooked
+	WaitlistEntry             = models.WaitlistEntry
+	CalendarFeed              = models.CalendarFeed
+	PasswordReset             = models.PasswordReset
+	LoginFailure              = models.LoginFailure
+	JobRun                    = models.JobRun
+	TeacherLesson             = models.TeacherLesson
+)
 
-type LessonBooked struct {
-	ID             int       `json:"id" sqlite:"primary key"`
-	Day            string    `json:"day" sqlite:"not null"`
-	StartingTime   time.Time `json:"starting_time" sqlite:"not null"`
-	EndingTime     time.Time `json:"ending_time" sqlite:"not null"`
-	TeacherName    string    `json:"teacher_name" sqlite:"not null"`
-	TeacherSurname string    `json:"teacher_surname" sqlite:"not null"`
-	Subject        string    `json:"subject" sqlite:"not null"`
-}
+// statuses of a booking: it starts as booked and is then either cancelled, completed or a no-show.
+// Cancelled bookings free their availability, the others keep it.
+const (
+	bookingBooked             = "booked"
+	bookingCancelledByStudent = "cancelled_by_student"
+	bookingCancelledByTeacher = "cancelled_by_teacher"
+	bookingCompleted          = "completed"
+	bookingNoShow             = "no_show"
+)
 
-var errorMessage struct {
-	Message string `json:"message"`
-}
+// statuses of a waitlist entry: it waits until a freed availability is booked for the student
+const (
+	waitlistWaiting  = "waiting"
+	waitlistAssigned = "assigned"
+)
 
 type Cookie struct {
 	Name       string
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"fmt"
+)
+
+// ErrTeacherNotFound is returned when no teacher has the ID, the username or the full name.
+type ErrTeacherNotFound struct {
+	TeacherID int
+	Username  string
+	// Name and Surname are set when the teacher was looked up by their full name
+	Name    string
+	Surname string
+}
+
+// ErrStudentNotFound is returned when no student has the username.
+type ErrStudentNotFound struct {
+	StudentID string
+}
+
+func (e *ErrTeacherNotFound) Error() string {
+	if e.Username != "" {
+		return fmt.Sprintf("No Teacher with username: %s", e.Username)
+	}
+	if e.Name != "" || e.Surname != "" {
+		return fmt.Sprintf("No Teacher named %s %s", e.Name, e.Surname)
+	}
+	return fmt.Sprintf("No Teacher with id: %d", e.TeacherID)
+}
+
+func (e *ErrStudentNotFound) Error() string {
+	return fmt.Sprintf("No Student with username: %s", e.StudentID)
+}
@@ -0,0 +1,257 @@
+// Package models holds the data the API exchanges with the web server and the CLI: the records it
+// saves and the bodies of its requests and responses.
+package models
+
+import (
+	"time"
+)
+
+type Student struct {
+	Name        string    `json:"name" sqlite:"not null"`
+	Surname     string    `json:"surname" sqlite:"not null"`
+	DateOfBirth time.Time `json:"date_of_birth" sqlite:"not null"`
+	Username    string    `json:"username" sqlite:"primary key"`
+	Password    string    `json:"password,omitempty" sqlite:"not null"`
+	// TimeZone is the IANA name of the zone the student sees the lessons in, UTC when not set
+	TimeZone string `json:"time_zone" sqlite:"not null"`
+	// Email is where the notifications are sent, none when empty
+	Email string `json:"email,omitempty" sqlite:"not null"`
+	// PasswordChangedAt is when the password was set, at the registration or later: the tokens issued before don't work
+	PasswordChangedAt time.Time `json:"-"`
+}
+
+type Teacher struct {
+	ID       int    `json:"id" sqlite:"primary key"`
+	Name     string `json:"name" sqlite:"not null"`
+	Surname  string `json:"surname" sqlite:"not null"`
+	Username string `json:"username,omitempty" sqlite:"unique"`
+	Password string `json:"password,omitempty"`
+	// TimeZone is the IANA name of the zone the teacher works in, UTC when not set
+	TimeZone string `json:"time_zone" sqlite:"not null"`
+	// Email is where the notifications are sent, none when empty
+	Email string `json:"email,omitempty" sqlite:"not null"`
+	// Subjects are the names of the subjects the teacher teaches, in alphabetical order. A teacher
+	// without subjects can be booked for any subject.
+	Subjects []string `json:"subjects,omitempty"`
+}
+
+// Admin is an administrator account stored with the other users. The administrator of GOTUTOR_ADMIN_USERNAME
+// and GOTUTOR_ADMIN_PASSWORD is not stored: it creates the first of these accounts.
+type Admin struct {
+	Username string `json:"username" sqlite:"primary key"`
+	Password string `json:"password,omitempty" sqlite:"not null"`
+	// CreatedBy is the administrator who created the account
+	CreatedBy string    `json:"created_by" sqlite:"not null"`
+	CreatedAt time.Time `json:"created_at" sqlite:"not null"`
+}
+
+// Subject is a subject taught by the teachers. The names are unique regardless of the case.
+type Subject struct {
+	ID   int    `json:"id" sqlite:"primary key"`
+	Name string `json:"name" sqlite:"unique"`
+}
+
+// TeacherSearch filters the teachers: each field that is set has to match.
+type TeacherSearch struct {
+	// Subject is a subject the teacher teaches, ignoring the case
+	Subject string
+	// NamePrefix is the start of the name, of the surname or of the full name, ignoring the case
+	NamePrefix string
+	// FreeFrom, when set, requires a free availability starting from it and, when FreeTo is set too,
+	// ending by FreeTo. With Subject the availability needs to be open to that subject.
+	FreeFrom time.Time
+	FreeTo   time.Time
+}
+
+// Availability is a lesson slot of a teacher. StartsAt is stored in UTC and
+// the API returns it in the time zone of the user asking for it.
+type Availability struct {
+	ID              int       `json:"id" sqlite:"primary key"`
+	StartsAt        time.Time `json:"starts_at" sqlite:"not null"`
+	DurationMinutes int       `json:"duration_minutes" sqlite:"not null"`
+	Booked          bool      `json:"booked" sqlite:"not null"`
+	RuleID          int       `json:"rule_id,omitempty"`
+	// Subject restricts the availability to the lessons of a subject, empty for any subject
+	Subject string `json:"subject,omitempty" sqlite:"not null"`
+	// Sequence counts the changes of the availability, booked, freed or deleted, for the calendar apps
+	Sequence int `json:"sequence" sqlite:"not null"`
+}
+
+// EndsAt returns the instant the lesson ends.
+func (a Availability) EndsAt() time.Time {
+	return a.StartsAt.Add(time.Duration(a.DurationMinutes) * time.Minute)
+}
+
+// ImportedAvailability is an availability of a bulk import, together with the teacher it belongs to.
+type ImportedAvailability struct {
+	TeacherID int
+	Availability
+}
+
+// DataExport is a copy of the data of the application, taken at ExportedAt.
+// The passwords are never exported and the times are in UTC.
+type DataExport struct {
+	ExportedAt     time.Time              `json:"exported_at"`
+	Teachers       []Teacher              `json:"teachers"`
+	Students       []Student              `json:"students"`
+	Availabilities []ExportedAvailability `json:"availabilities"`
+	Bookings       []LessonReservation    `json:"bookings"`
+}
+
+// ExportedAvailability is an availability of an export, together with the teacher it belongs to.
+type ExportedAvailability struct {
+	TeacherID int `json:"teacher_id"`
+	Availability
+}
+
+// AvailabilityRule is a weekly recurrence of availabilities of a teacher, for example
+// every Tuesday and Thursday from 15:00 to 18:00 between two dates, except some holidays.
+// The rule is expanded into availabilities lasting DurationMinutes each.
+type AvailabilityRule struct {
+	ID           int         `json:"id" sqlite:"primary key"`
+	TeacherID    int         `json:"teacher_id" sqlite:"not null"`
+	Weekdays     []string    `json:"weekdays" sqlite:"not null"`
+	StartingTime string      `json:"starting_time" sqlite:"not null"`
+	EndingTime   string      `json:"ending_time" sqlite:"not null"`
+	StartDate    time.Time   `json:"start_date" sqlite:"not null"`
+	EndDate      time.Time   `json:"end_date" sqlite:"not null"`
+	ExceptDates  []time.Time `json:"except_dates"`
+	Cancelled    bool        `json:"cancelled" sqlite:"not null"`
+	// DurationMinutes is the length of each generated availability, one hour when not set
+	DurationMinutes int    `json:"duration_minutes" sqlite:"not null"`
+	Subject         string `json:"subject,omitempty" sqlite:"not null"`
+	// TimeZone is the zone of the starting and ending times, the one of the teacher when not set
+	TimeZone string `json:"time_zone" sqlite:"not null"`
+}
+
+// DurationPolicy lists the lesson durations, in minutes, a teacher allows for their availabilities.
+// The policy with an empty Subject is the default of the teacher, the others only apply to the
+// availabilities of their subject. Availabilities need to start on a multiple of GranularityMinutes.
+type DurationPolicy struct {
+	TeacherID          int    `json:"teacher_id" sqlite:"primary key"`
+	Subject            string `json:"subject" sqlite:"primary key"`
+	DurationsMinutes   []int  `json:"durations_minutes" sqlite:"not null"`
+	GranularityMinutes int    `json:"granularity_minutes" sqlite:"not null"`
+}
+
+// AvailabilityRuleExpansion lists the availabilities generated by a rule and the ones
+// skipped because they overlap an existing availability of the teacher
+type AvailabilityRuleExpansion struct {
+	Rule      AvailabilityRule `json:"rule"`
+	Slots     []Availability   `json:"slots"`
+	Conflicts []Availability   `json:"conflicts"`
+}
+
+type LessonReservation struct {
+	ID              int    `json:"id" sqlite:"primary key"`
+	StudentUsername string `json:"student_id" sqlite:"not null"`
+	TeacherID       int    `json:"teacher_id" sqlite:"not null"`
+	AvailabilityID  int    `json:"availability_id" sqlite:"not null"`
+	Subject         string `json:"subject" sqlite:"not null"`
+	// the fields below are set by the store, the ones sent when creating a booking are ignored
+	StartsAt        time.Time `json:"starts_at" sqlite:"not null"`
+	DurationMinutes int       `json:"duration_minutes" sqlite:"not null"`
+	Status          string    `json:"status" sqlite:"not null"`
+	BookingCancellation
+}
+
+// EndsAt returns the instant the lesson ends.
+func (l LessonReservation) EndsAt() time.Time {
+	return l.StartsAt.Add(time.Duration(l.DurationMinutes) * time.Minute)
+}
+
+// BookingCancellation records who cancelled a booking, when and why.
+// CancelledBy is the username of the student, the teacher or the administrator.
+type BookingCancellation struct {
+	CancelledBy        string     `json:"cancelled_by,omitempty" sqlite:"not null"`
+	CancellationReason string     `json:"cancellation_reason,omitempty" sqlite:"not null"`
+	CancelledAt        *time.Time `json:"cancelled_at,omitempty"`
+}
+
+type LessonBooked struct {
+	ID              int       `json:"id" sqlite:"primary key"`
+	StartsAt        time.Time `json:"starts_at" sqlite:"not null"`
+	DurationMinutes int       `json:"duration_minutes" sqlite:"not null"`
+	TeacherName     string    `json:"teacher_name" sqlite:"not null"`
+	TeacherSurname  string    `json:"teacher_surname" sqlite:"not null"`
+	Subject         string    `json:"subject" sqlite:"not null"`
+	Status          string    `json:"status" sqlite:"not null"`
+	BookingCancellation
+}
+
+// EndsAt returns the instant the lesson ends.
+func (l LessonBooked) EndsAt() time.Time {
+	return l.StartsAt.Add(time.Duration(l.DurationMinutes) * time.Minute)
+}
+
+// WaitlistEntry is a student waiting for a lesson with a teacher whose availabilities are booked.
+// The entry waits either for a specific availability or, when AvailabilityID is 0, for any
+// availability of the teacher starting between WeekStart and WeekEnd.
+// When a booking is cancelled the freed availability is booked for the first entry that can take it.
+type WaitlistEntry struct {
+	ID              int        `json:"id" sqlite:"primary key"`
+	StudentUsername string     `json:"student_username" sqlite:"not null"`
+	TeacherID       int        `json:"teacher_id" sqlite:"not null"`
+	AvailabilityID  int        `json:"availability_id,omitempty"`
+	WeekStart       *time.Time `json:"week_start,omitempty"`
+	WeekEnd         *time.Time `json:"week_end,omitempty"`
+	Subject         string     `json:"subject" sqlite:"not null"`
+	Status          string     `json:"status" sqlite:"not null"`
+	// BookingID is the booking made for the student once the entry is assigned
+	BookingID int       `json:"booking_id,omitempty"`
+	CreatedAt time.Time `json:"created_at" sqlite:"not null"`
+	// filled when the entries are read: the teacher and when the awaited availability starts
+	TeacherName    string     `json:"teacher_name,omitempty"`
+	TeacherSurname string     `json:"teacher_surname,omitempty"`
+	StartsAt       *time.Time `json:"starts_at,omitempty"`
+}
+
+// CalendarFeed is the secret token giving access to the calendar of a student or, when TeacherID is set,
+// of a teacher. Calendar apps subscribe to the URL of the token, which can't send any credentials.
+type CalendarFeed struct {
+	Token           string    `json:"-" sqlite:"primary key"`
+	StudentUsername string    `json:"student_username,omitempty" sqlite:"unique"`
+	TeacherID       int       `json:"teacher_id,omitempty" sqlite:"unique"`
+	CreatedAt       time.Time `json:"created_at" sqlite:"not null"`
+}
+
+// PasswordReset is a request of a student to reset their password. The token of the reset link is not saved,
+// only its SHA-256 hash: the link works once, until ExpiresAt.
+type PasswordReset struct {
+	TokenHash       string     `json:"-" sqlite:"primary key"`
+	StudentUsername string     `json:"student_username" sqlite:"not null"`
+	CreatedAt       time.Time  `json:"created_at" sqlite:"not null"`
+	ExpiresAt       time.Time  `json:"expires_at" sqlite:"not null"`
+	UsedAt          *time.Time `json:"used_at,omitempty"`
+}
+
+// LoginFailure is a refused login, kept for the administrators to review. Username is the one given,
+// whether the account exists or not.
+type LoginFailure struct {
+	ID       int    `json:"id" sqlite:"primary key"`
+	Username string `json:"username" sqlite:"not null"`
+	Role     string `json:"role" sqlite:"not null"`
+	IP       string `json:"ip" sqlite:"not null"`
+	// Reason is why the login was refused, one of the reasons of the login limits
+	Reason      string    `json:"reason" sqlite:"not null"`
+	AttemptedAt time.Time `json:"attempted_at" sqlite:"not null"`
+}
+
+// JobRun is the last run of a job of the scheduler.
+type JobRun struct {
+	Name      string    `json:"name" sqlite:"primary key"`
+	LastRunAt time.Time `json:"last_run_at" sqlite:"not null"`
+	// LastError is the error of the last run, empty when it succeeded
+	LastError string `json:"last_error,omitempty" sqlite:"not null"`
+}
+
+// TeacherLesson is a booked availability of a teacher together with the student who booked it
+type TeacherLesson struct {
+	Availability
+	BookingID       int    `json:"booking_id"`
+	StudentUsername string `json:"student_username"`
+	StudentName     string `json:"student_name"`
+	StudentSurname  string `json:"student_surname"`
+	Subject         string `json:"subject"`
+	Status          string `json:"status"`
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginRequest is the body of POST /api/auth/login. Role defaults to student.
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// LoginResponse is returned by POST /api/auth/login
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	TeacherID int       `json:"teacher_id,omitempty"`
+	TimeZone  string    `json:"time_zone"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// DurationPolicies is returned by GET /api/teacher/:id/durations
+type DurationPolicies struct {
+	// Default applies to the availabilities without a subject or with a subject without its own policy
+	Default  DurationPolicy   `json:"default"`
+	Subjects []DurationPolicy `json:"subjects"`
+}
+
+// CalendarFeedResponse is returned by the calendar endpoints of the students and the teachers
+type CalendarFeedResponse struct {
+	// URL is the address calendar apps subscribe to, anyone knowing it can read the calendar
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TeacherSubjectsRequest is the body of PUT /api/teacher/:id/subjects, replacing the subjects of the teacher
+type TeacherSubjectsRequest struct {
+	Subjects []string `json:"subjects"`
+}
+
+// ForgotPasswordRequest is the body of POST /api/auth/forgot-password
+type ForgotPasswordRequest struct {
+	Username string `json:"username"`
+}
+
+// ResetPasswordRequest is the body of POST /api/auth/reset-password, with the token of the reset link
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// StudentProfileRequest is the body of PATCH /api/student/:username/profile: only the fields given are changed
+type StudentProfileRequest struct {
+	Name        *string    `json:"name"`
+	Surname     *string    `json:"surname"`
+	DateOfBirth *time.Time `json:"date_of_birth"`
+	TimeZone    *string    `json:"time_zone"`
+	Email       *string    `json:"email"`
+}
+
+// StudentPasswordRequest is the body of PUT /api/student/:username/password
+type StudentPasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+// StudentPasswordResponse answers a password change. The tokens issued before stop working, so the student
+// who changed their own password gets a new one.
+type StudentPasswordResponse struct {
+	Message   string    `json:"message"`
+	Token     string    `json:"token,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// DeleteStudentRequest is the body of DELETE /api/student/:username
+type DeleteStudentRequest struct {
+	Password string `json:"password"`
+}
+
+// CancelBookingRequest is the optional body of DELETE /api/bookings/:id
+type CancelBookingRequest struct {
+	Reason string `json:"reason"`
+}
+
+// BookingStatusRequest is the body of PUT /api/bookings/:id/status
+type BookingStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// WaitlistRequest is the body of POST /api/student/:username/waitlist. It asks either for a specific
+// availability or, with Week, for any availability of the teacher in the week of the given date.
+type WaitlistRequest struct {
+	TeacherID      int `json:"teacher_id"`
+	AvailabilityID int `json:"availability_id"`
+	// Week is a date in the YYYY-MM-DD format, in the time zone of the student
+	Week    string `json:"week"`
+	Subject string `json:"subject"`
+}
+
+// FieldError is the reason a field of a request is invalid. Field is the name of the field in the JSON body,
+// empty when the error is about the request as a whole.
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// formats of the files of POST /api/import: csv with a header row, or one JSON object per line
+const (
+	ImportFormatCSV   = "csv"
+	ImportFormatJSONL = "jsonl"
+)
+
+// ImportReport is the response of POST /api/import. When a row has errors nothing is saved,
+// and Errors lists all of them so that the file can be fixed in one go.
+type ImportReport struct {
+	Type    string `json:"type"`
+	DryRun  bool   `json:"dry_run"`
+	Message string `json:"message"`
+	Rows    int    `json:"rows"`
+	// Imported is the number of rows saved, 0 with errors or a dry run
+	Imported int              `json:"imported"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+// ImportRowError is the reason a row can't be imported.
+type ImportRowError struct {
+	// Line is the line of the row in the file, the header of a csv file being line 1
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// kinds of the emails about a lesson, each rendered from its subject and body templates
+const (
+	emailBookingConfirmed = "booking_confirmed"
+	emailBookingCancelled = "booking_cancelled"
+	emailLessonReminder   = "lesson_reminder"
+)
+
+// emailPasswordReset is the kind of the email with the link resetting a password, rendered from a passwordResetEmail
+const emailPasswordReset = "password_reset"
+
+// lessonEmail is the data of the templates of the emails about a lesson, for one of its two recipients.
+type lessonEmail struct {
+	RecipientName string
+	// ToTeacher is set for the email sent to the teacher of the lesson
+	ToTeacher   bool
+	StudentName string
+	TeacherName string
+	Subject     string
+	// StartsAt is in the time zone of the recipient
+	StartsAt        time.Time
+	DurationMinutes int
+	// CancelledBy and Reason are set for the cancelled lessons
+	CancelledBy string
+	Reason      string
+	// Before is how long before the lesson a reminder is sent, like "24 hours"
+	Before string
+}
+
+// passwordResetEmail is the data of the templates of the password reset email.
+type passwordResetEmail struct {
+	RecipientName string
+	URL           string
+	// ValidFor is how long the link works, like "1 hour"
+	ValidFor string
+}
+
+// emailTemplates defines a "<kind>.subject" and a "<kind>.body" template for each kind of email
+var emailTemplates = template.Must(template.New("emails").Parse(`
+{{- define "when" -}}
+{{.StartsAt.Format "Monday 2 January 2006, 15:04"}} ({{.StartsAt.Format "MST"}}), {{.DurationMinutes}} minutes
+{{- end}}
+
+{{- define "with" -}}
+{{if .ToTeacher}}{{.StudentName}}{{else}}{{.TeacherName}}{{end}}
+{{- end}}
+
+{{- define "booking_confirmed.subject" -}}
+Lesson booked: {{.Subject}} with {{template "with" .}}
+{{- end}}
+
+{{- define "booking_confirmed.body" -}}
+Hello {{.RecipientName}},
+
+{{if .ToTeacher}}{{.StudentName}} booked a {{.Subject}} lesson with you.{{else}}your {{.Subject}} lesson with {{.TeacherName}} is booked.{{end}}
+
+When: {{template "when" .}}
+
+See you soon,
+GoTutor
+{{end}}
+
+{{- define "booking_cancelled.subject" -}}
+Lesson cancelled: {{.Subject}} with {{template "with" .}}
+{{- end}}
+
+{{- define "booking_cancelled.body" -}}
+Hello {{.RecipientName}},
+
+the {{.Subject}} lesson with {{template "with" .}} has been cancelled by {{.CancelledBy}}.
+{{- if .Reason}}
+
+Reason: {{.Reason}}
+{{- end}}
+
+It was planned on {{template "when" .}}.
+
+GoTutor
+{{end}}
+
+{{- define "lesson_reminder.subject" -}}
+Reminder: {{.Subject}} lesson with {{template "with" .}} in {{.Before}}
+{{- end}}
+
+{{- define "lesson_reminder.body" -}}
+Hello {{.RecipientName}},
+
+your {{.Subject}} lesson with {{template "with" .}} starts in {{.Before}}.
+
+When: {{template "when" .}}
+
+GoTutor
+{{end}}
+
+{{- define "password_reset.subject" -}}
+Reset your GoTutor password
+{{- end}}
+
+{{- define "password_reset.body" -}}
+Hello {{.RecipientName}},
+
+someone asked to reset the password of your GoTutor account. To choose a new one, open this link
+within {{.ValidFor}}:
+
+{{.URL}}
+
+The link works only once. If you didn't ask for it, ignore this email: your password doesn't change.
+
+GoTutor
+{{end}}
+`))
+
+// renderEmail renders the email of the kind for a recipient, from the data its templates expect.
+func renderEmail(kind, to string, data any) (Email, error) {
+	var subject, body strings.Builder
+	if err := emailTemplates.ExecuteTemplate(&subject, kind+".subject", data); err != nil {
+		return Email{}, err
+	}
+	if err := emailTemplates.ExecuteTemplate(&body, kind+".body", data); err != nil {
+		return Email{}, err
+	}
+	return Email{To: to, Subject: subject.String(), Body: body.String()}, nil
+}
+
+// lessonEmails renders the emails of the kind about a booking, for its student and its teacher.
+// The recipients without an email address are left out, and each one gets the times in their own zone.
+// before is only used by the reminders.
+func lessonEmails(store Store, kind string, booking LessonReservation, before string) ([]Email, error) {
+	student, err := store.StudentByUsername(booking.StudentUsername)
+	if err != nil {
+		return nil, err
+	}
+	return studentLessonEmails(store, kind, booking, student, before)
+}
+
+// studentLessonEmails renders the emails of the kind about a booking of the given student, like lessonEmails.
+func studentLessonEmails(store Store, kind string, booking LessonReservation, student Student, before string) ([]Email, error) {
+	teacher, err := store.TeacherByID(booking.TeacherID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := lessonEmail{
+		StudentName:     student.Name + " " + student.Surname,
+		TeacherName:     teacher.Name + " " + teacher.Surname,
+		Subject:         booking.Subject,
+		DurationMinutes: booking.DurationMinutes,
+		Reason:          booking.CancellationReason,
+		Before:          before,
+	}
+	switch {
+	case booking.Status == bookingCancelledByStudent:
+		data.CancelledBy = data.StudentName
+	case booking.Status == bookingCancelledByTeacher && booking.CancelledBy == teacher.Username:
+		data.CancelledBy = data.TeacherName
+	case booking.Status == bookingCancelledByTeacher:
+		//the administrator cancels on behalf of the school
+		data.CancelledBy = "the school"
+	}
+
+	var emails []Email
+	if student.Email != "" {
+		studentData := data
+		studentData.RecipientName = student.Name
+		if booking.Status == bookingCancelledByStudent {
+			studentData.CancelledBy = "you"
+		}
+		studentData.StartsAt = booking.StartsAt.In(loadLocation(student.TimeZone))
+		email, err := renderEmail(kind, student.Email, studentData)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	if teacher.Email != "" {
+		teacherData := data
+		teacherData.RecipientName, teacherData.ToTeacher = teacher.Name, true
+		if data.CancelledBy == data.TeacherName {
+			teacherData.CancelledBy = "you"
+		}
+		teacherData.StartsAt = booking.StartsAt.In(loadLocation(teacher.TimeZone))
+		email, err := renderEmail(kind, teacher.Email, teacherData)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+// notifyBooking sends the emails of the kind about the booking to its student and its teacher.
+// It is run in its own goroutine, so that the response doesn't wait for the mail server: the errors are logged.
+func (api *apiServer) notifyBooking(kind string, bookingID int) {
+	booking, err := api.store.BookingByID(strconv.Itoa(bookingID))
+	if err != nil {
+		log.Printf("Error reading booking %d to notify: %v", bookingID, err)
+		return
+	}
+	emails, err := lessonEmails(api.store, kind, booking, "")
+	if err != nil {
+		log.Printf("Error rendering the %s emails of booking %d: %v", kind, bookingID, err)
+		return
+	}
+	for _, email := range emails {
+		if err := api.notifier.Send(email); err != nil {
+			log.Printf("Error sending the %s email of booking %d to %s: %v", kind, bookingID, email.To, err)
+		}
+	}
+}
+
+// notifyDeletedStudentLessons tells the teachers that the lessons of a student who deleted their account are cancelled.
+// The student is no longer in the store and gets no email.
+func (api *apiServer) notifyDeletedStudentLessons(student Student, lessons []LessonReservation) {
+	student.Email = ""
+	for _, booking := range lessons {
+		emails, err := studentLessonEmails(api.store, emailBookingCancelled, booking, student, "")
+		if err != nil {
+			log.Printf("Error rendering the %s emails of booking %d: %v", emailBookingCancelled, booking.ID, err)
+			continue
+		}
+		for _, email := range emails {
+			if err := api.notifier.Send(email); err != nil {
+				log.Printf("Error sending the %s email of booking %d to %s: %v", emailBookingCancelled, booking.ID, email.To, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notifier sends the emails of the application.
+// The SMTP notifier delivers them, the file and log ones only write them down, for local testing.
+type Notifier interface {
+	Send(email Email) error
+}
+
+// Email is a plain text email to a single recipient.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// newNotifierFromEnv returns the notifier chosen with GOTUTOR_NOTIFIER:
+//   - log (the default) prints the emails in the log of the server
+//   - file appends them to GOTUTOR_NOTIFIER_FILE, emails.log when not set
+//   - smtp sends them through GOTUTOR_SMTP_ADDR (host:port) from GOTUTOR_SMTP_FROM, logging in with
+//     GOTUTOR_SMTP_USERNAME and GOTUTOR_SMTP_PASSWORD when they are set
+func newNotifierFromEnv() Notifier {
+	switch kind := os.Getenv("GOTUTOR_NOTIFIER"); kind {
+	case "", "log":
+		return &writerNotifier{w: log.Writer()}
+	case "file":
+		path := os.Getenv("GOTUTOR_NOTIFIER_FILE")
+		if path == "" {
+			path = "emails.log"
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return &writerNotifier{w: file}
+	case "smtp":
+		notifier, err := newSMTPNotifier(os.Getenv("GOTUTOR_SMTP_ADDR"), os.Getenv("GOTUTOR_SMTP_FROM"),
+			os.Getenv("GOTUTOR_SMTP_USERNAME"), os.Getenv("GOTUTOR_SMTP_PASSWORD"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return notifier
+	default:
+		log.Fatalf("Unknown GOTUTOR_NOTIFIER %q: use log, file or smtp", kind)
+		return nil
+	}
+}
+
+// writerNotifier writes the emails to a file or to the log instead of sending them.
+type writerNotifier struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (n *writerNotifier) Send(email Email) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	_, err := fmt.Fprintf(n.w, "----- email %s\nTo: %s\nSubject: %s\n\n%s\n", time.Now().UTC().Format(time.RFC3339), email.To, email.Subject, email.Body)
+	return err
+}
+
+// smtpNotifier sends the emails through an SMTP server, with STARTTLS when the server offers it.
+type smtpNotifier struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// newSMTPNotifier returns a notifier sending the emails through the server at addr, like smtp.example.com:587.
+// Without a username the server is used without logging in.
+func newSMTPNotifier(addr, from, username, password string) (*smtpNotifier, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid GOTUTOR_SMTP_ADDR %q: use host:port", addr)
+	}
+	if err := validateEmail(from); err != nil || from == "" {
+		return nil, fmt.Errorf("Invalid GOTUTOR_SMTP_FROM %q: an email address is required", from)
+	}
+	notifier := &smtpNotifier{addr: addr, from: from}
+	if username != "" {
+		notifier.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return notifier, nil
+}
+
+func (n *smtpNotifier) Send(email Email) error {
+	if err := validateEmail(email.To); err != nil || email.To == "" {
+		return fmt.Errorf("Invalid recipient %q", email.To)
+	}
+	//the subject contains text given by the users, it can't add headers
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(email.Subject)
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", n.from)
+	fmt.Fprintf(&message, "To: %s\r\n", email.To)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(strings.ReplaceAll(email.Body, "\r\n", "\n"), "\n", "\r\n"))
+
+	return smtp.SendMail(n.addr, n.auth, n.from, []string{email.To}, []byte(message.String()))
+}
+
+// validateEmail checks that the email address is a plain address like name@example.com.
+// An empty address is valid: the user gets no emails.
+func validateEmail(email string) error {
+	if email == "" {
+		return nil
+	}
+	if len(email) > maxEmailLength {
+		return fmt.Errorf("The email address can't be longer than %d characters", maxEmailLength)
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return errors.New("Invalid email address")
+	}
+	return nil
+}
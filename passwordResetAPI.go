@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"server/models"
+)
+
+// the bodies of the forgotten password and of the reset, shared with the users of the API
+type (
+	forgotPasswordRequest = models.ForgotPasswordRequest
+	resetPasswordRequest  = models.ResetPasswordRequest
+)
+
+// forgotPasswordMessage is the answer to every forgotten password, so that it doesn't tell which accounts exist
+const forgotPasswordMessage = "If the account exists and has an email address, a reset link has been sent to it"
+
+// Handlers
+
+// forgotPassword sends a password reset link to the email address of a student. The answer is the same
+// whether the student exists or not, and the link works once, for the time set with GOTUTOR_PASSWORD_RESET_TTL.
+// The requests are limited like the logins, on their own counters: every request counts as a failure of the
+// account, so that a mailbox can't be flooded with links, and a reset forgets them.
+func (api *apiServer) forgotPassword(c *gin.Context) {
+	var request forgotPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return
+	}
+	request.Username = strings.TrimSpace(request.Username)
+	if request.Username == "" {
+		invalidRequest(c, invalidField("username", errors.New("The username is required")))
+		return
+	}
+	//counted whether the student exists or not, so that the limit doesn't tell
+	account := loginAccount{Role: roleStudent, Username: request.Username}
+	now := time.Now()
+	if reason, retryAfter, _ := api.resets.allow(c.ClientIP(), account, now); reason != "" {
+		tooManyAttempts(c, "Too many password reset requests", retryAfter)
+		return
+	}
+	api.resets.failed(account, now)
+
+	student, err := api.store.StudentByUsername(request.Username)
+	if err != nil || student.Email == "" {
+		//nothing to send, but the answer doesn't say so
+		c.JSON(http.StatusAccepted, gin.H{"message": forgotPasswordMessage})
+		return
+	}
+
+	token := newPasswordResetToken()
+	now = now.UTC()
+	reset := PasswordReset{TokenHash: hashPasswordResetToken(token), StudentUsername: student.Username, CreatedAt: now, ExpiresAt: now.Add(api.auth.resetTTL)}
+	if err := api.store.InsertPasswordReset(reset); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving the password reset"})
+		return
+	}
+	go api.sendPasswordReset(student, token)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": forgotPasswordMessage})
+}
+
+// resetPassword sets the new password of the student of a reset link. The password follows the same rules
+// as the one given at the registration.
+func (api *apiServer) resetPassword(c *gin.Context) {
+	var request resetPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return
+	}
+	var v validator
+	if request.Token == "" {
+		v.add("token", "The token of the reset link is required")
+	}
+	v.check("password", validatePassword(request.Password))
+	if err := v.err(); err != nil {
+		invalidRequest(c, err)
+		return
+	}
+
+	username, err := api.store.ResetPassword(hashPasswordResetToken(request.Token), request.Password, time.Now())
+	if err == ErrPasswordResetInvalid {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error resetting the password"})
+		return
+	}
+	api.resets.succeeded(loginAccount{Role: roleStudent, Username: username})
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully", "username": username})
+}
+
+// Utils
+
+// sendPasswordReset emails the reset link to the student.
+// It is run in its own goroutine, so that the response doesn't wait for the mail server: the errors are logged.
+func (api *apiServer) sendPasswordReset(student Student, token string) {
+	data := passwordResetEmail{
+		RecipientName: student.Name,
+		URL:           api.auth.webURL + "/resetPassword?token=" + url.QueryEscape(token),
+		ValidFor:      formatTimeLeft(api.auth.resetTTL),
+	}
+	email, err := renderEmail(emailPasswordReset, student.Email, data)
+	if err != nil {
+		log.Printf("Error rendering the %s email of %s: %v", emailPasswordReset, student.Username, err)
+		return
+	}
+	if err := api.notifier.Send(email); err != nil {
+		log.Printf("Error sending the %s email to %s: %v", emailPasswordReset, email.To, err)
+	}
+}
+
+// newPasswordResetToken returns a random token for a password reset link.
+func newPasswordResetToken() string {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		log.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// hashPasswordResetToken returns the SHA-256 hash of a reset token, the only part of it that is saved.
+// The tokens are random, so a fast hash is enough: a stolen hash can't be turned back into a link.
+func hashPasswordResetToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
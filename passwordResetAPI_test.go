@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPasswordResetRequestsAreLimitedPerAccount(t *testing.T) {
+	api := newTestAPIWithLogins(t, loginPolicy{MaxFailures: 3, Lockout: time.Hour})
+	for i := 0; i < 3; i++ {
+		api.expect(api.do(http.MethodPost, "/api/auth/forgot-password", "", forgotPasswordRequest{Username: "alice"}), http.StatusAccepted)
+	}
+	//the account is locked whether it exists or not
+	response := api.do(http.MethodPost, "/api/auth/forgot-password", "", forgotPasswordRequest{Username: "alice"})
+	api.expect(response, http.StatusTooManyRequests)
+	if response.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+	api.expect(api.do(http.MethodPost, "/api/auth/forgot-password", "", forgotPasswordRequest{Username: "bob"}), http.StatusAccepted)
+	//the logins of the account aren't locked by the reset requests
+	api.addStudent("alice")
+}
+
+func TestPasswordResetRequestsAreLimitedPerAddress(t *testing.T) {
+	api := newTestAPIWithLogins(t, loginPolicy{IPLimit: 3})
+	for _, username := range []string{"alice", "bob", "carol"} {
+		api.expect(api.do(http.MethodPost, "/api/auth/forgot-password", "", forgotPasswordRequest{Username: username}), http.StatusAccepted)
+	}
+	api.expect(api.do(http.MethodPost, "/api/auth/forgot-password", "", forgotPasswordRequest{Username: "dave"}), http.StatusTooManyRequests)
+}
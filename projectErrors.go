@@ -1,18 +1,77 @@
 package main
 
-import "fmt"
-
-type ErrTeacherNotFound struct {
-	TeacherID int
-}
-type ErrStudentNotFound struct {
-	StudentID string
-}
-
-func (e *ErrTeacherNotFound) Error() string {
-	return fmt.Sprintf("No Teacher with id: %d", e.TeacherID)
-}
-
-func (e *ErrStudentNotFound) Error() string {
-	return fmt.Sprintf("No Student with username: %s", e.StudentID)
-}
+import (
+	"errors"
+	"fmt"
+
+	"server/models"
+)
+
+// ErrAvailabilityAlreadyBooked is returned when a booking targets a slot that is already taken.
+var ErrAvailabilityAlreadyBooked = errors.New("Availability already booked")
+
+// ErrOverlappingAvailabilities is returned when a new availability overlaps another one of the same teacher.
+var ErrOverlappingAvailabilities = errors.New("Overlapping availabilities")
+
+// ErrAvailabilityRuleNotFound is returned when a recurrence rule doesn't exist or belongs to another teacher.
+var ErrAvailabilityRuleNotFound = errors.New("Availability rule not found")
+
+// ErrBookingNotFound is returned when a booking doesn't exist.
+var ErrBookingNotFound = errors.New("Booking not found")
+
+// ErrBookingClosed is returned when a booking that is no longer booked is cancelled or completed.
+var ErrBookingClosed = errors.New("Booking already cancelled or completed")
+
+// ErrAlreadyOnWaitlist is returned when a student joins the waitlist for the same lesson twice.
+var ErrAlreadyOnWaitlist = errors.New("Already on the waitlist for this lesson")
+
+// ErrAvailabilityNotBooked is returned when a student joins the waitlist for a free availability.
+var ErrAvailabilityNotBooked = errors.New("The availability is free: book it instead")
+
+// ErrWaitlistEntryNotFound is returned when a waitlist entry doesn't exist, belongs to another student or has been assigned.
+var ErrWaitlistEntryNotFound = errors.New("Waitlist entry not found")
+
+// ErrAvailabilityNotFound is returned when an availability doesn't exist or belongs to another teacher.
+var ErrAvailabilityNotFound = errors.New("Availability not found")
+
+// ErrDurationPolicyNotFound is returned when a teacher has no duration policy for the subject.
+var ErrDurationPolicyNotFound = errors.New("Duration policy not found")
+
+// ErrUsernameTaken is returned when an account is saved with the username of another account of the same kind.
+var ErrUsernameTaken = errors.New("Username already exists")
+
+// ErrTeacherPasswordRequired is returned when a teacher account is saved with a username but no password.
+var ErrTeacherPasswordRequired = errors.New("A password is required for the teacher account")
+
+// ErrSubjectNotTaught is returned when a lesson is booked for a subject its teacher doesn't teach.
+var ErrSubjectNotTaught = errors.New("The teacher doesn't teach this subject")
+
+// ErrAdminNotFound is returned when no administrator account has the username.
+var ErrAdminNotFound = errors.New("Administrator not found")
+
+// ErrAdminPasswordRequired is returned when an administrator account is saved without a password.
+var ErrAdminPasswordRequired = errors.New("A password is required for the administrator account")
+
+// ErrPasswordRequired is returned when a student account is saved without a password.
+var ErrPasswordRequired = errors.New("The password can't be empty")
+
+// ErrPasswordTooLong is returned when a password is longer than bcrypt can hash.
+var ErrPasswordTooLong = fmt.Errorf("The password can't be longer than %d bytes", maxPasswordLength)
+
+// ErrPasswordTooShort is returned when a new password has fewer than minPasswordLength characters.
+var ErrPasswordTooShort = fmt.Errorf("The password needs at least %d characters", minPasswordLength)
+
+// ErrPasswordTooWeak is returned when a new password doesn't mix letters and digits.
+var ErrPasswordTooWeak = errors.New("The password needs at least a letter and a digit")
+
+// ErrPasswordResetInvalid is returned when a reset link doesn't exist, was already used or expired.
+var ErrPasswordResetInvalid = errors.New("The reset link is invalid or has expired")
+
+// ErrCalendarFeedNotFound is returned when no calendar feed has the token.
+var ErrCalendarFeedNotFound = errors.New("Calendar feed not found")
+
+// the errors of the records that don't exist, shared with the users of the API
+type (
+	ErrTeacherNotFound = models.ErrTeacherNotFound
+	ErrStudentNotFound = models.ErrStudentNotFound
+)
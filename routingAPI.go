@@ -1,42 +1,124 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func routingAPI() {
+// apiServer holds the dependencies shared by the API handlers.
+type apiServer struct {
+	store        Store
+	auth         *authConfig
+	cancellation cancellationPolicy
+	notifier     Notifier
+	logins       *loginLimiter
+	// resets limits the password reset requests, with the policy of the logins
+	resets *loginLimiter
+}
+
+// shutdownTimeout is how long a server waits for the requests in progress when it shuts down
+const shutdownTimeout = 10 * time.Second
+
+// routingAPI serves the API until ctx is done.
+func routingAPI(ctx context.Context, store Store, notifier Notifier) {
 	fmt.Println("API server is running on port 8080")
 
+	router := newRouter(store, newAuthConfigFromEnv(), newCancellationPolicyFromEnv(), notifier)
+
+	// Run the server on port 8080
+	serveUntilDone(ctx, &http.Server{Addr: "localhost:8080", Handler: router})
+}
+
+// newRouter builds the gin router of the API, with every handler using the given store.
+// Apart from login, registration and the password resets, every route needs a bearer token issued by /api/auth/login.
+func newRouter(store Store, auth *authConfig, cancellation cancellationPolicy, notifier Notifier) *gin.Engine {
+	api := &apiServer{store: store, auth: auth, cancellation: cancellation, notifier: notifier, logins: newLoginLimiter(auth.logins), resets: newLoginLimiter(auth.logins)}
+
 	router := gin.Default() // Using gin.Default() to set up the default middleware
+	// the address of the client is only taken from X-Forwarded-For when the web server sends it
+	if err := router.SetTrustedProxies(auth.trustedProxies); err != nil {
+		log.Fatalf("Invalid GOTUTOR_TRUSTED_PROXIES: %v", err)
+	}
 
-	api := router.Group("/api")
+	apiGroup := router.Group("/api")
+	apiGroup.POST("/auth/login", api.login)
+	apiGroup.POST("/auth/forgot-password", api.forgotPassword)
+	apiGroup.POST("/auth/reset-password", api.resetPassword)
+	apiGroup.POST("/student/addstudent", api.createNewStudent)
+	// calendar apps can't send a token: the secret of the feed is in the URL
+	apiGroup.GET("/calendar/:file", api.getCalendar)
 
-	teachersGroup := api.Group("/teachers")
-	teachersGroup.GET("", getTeachers)
-	teachersGroup.GET("/:name/:surname", getTeacherIDByNameAndSurname)
-	teachersGroup.POST("/addteacher", createNewTeacher)
+	authorized := apiGroup.Group("", api.authenticate)
 
-	teacherGroup := api.Group("/teacher")
-	teacherGroup.GET("/:id/availability", getTeacherAvailability)
-	teacherGroup.GET("/:id/bookings", getTeacherBookings)
-	teacherGroup.POST("/:id/availability", createTeacherAvailability)
+	teachersGroup := authorized.Group("/teachers")
+	teachersGroup.GET("", api.getTeachers)
+	teachersGroup.GET("/search", api.searchTeachers)
+	teachersGroup.GET("/:name/:surname", api.getTeacherIDByNameAndSurname)
+	teachersGroup.POST("/addteacher", requireRoles(roleAdmin, roleTeacher), api.createNewTeacher)
 
-	studentGroup := api.Group("/student")
-	studentGroup.POST("/addstudent", createNewStudent)
-	studentGroup.GET("/allstudents", getStudents)
-	studentGroup.GET("/:username/profile", getProfileStudent)
-	studentGroup.GET("/:username/bookings", getStudentBookings)
-	studentGroup.POST("/:username/bookings", createStudentBooking)
-	studentGroup.POST("/bookings/:id", deleteStudentBooking)
+	authorized.GET("/subjects", api.getSubjects)
 
-	// Run the server on port 8080
-	router.Run("localhost:8080")
+	teacherGroup := authorized.Group("/teacher")
+	teacherGroup.GET("/:id/availability", api.getTeacherAvailability)
+	teacherGroup.GET("/:id/bookings", requireTeacherSelf, api.getTeacherBookings)
+	teacherGroup.POST("/:id/availability", requireTeacherSelf, api.createTeacherAvailability)
+	teacherGroup.DELETE("/:id/availability/:availabilityID", requireTeacherSelf, api.deleteTeacherAvailability)
+	teacherGroup.GET("/:id/rules", requireTeacherSelf, api.getTeacherAvailabilityRules)
+	teacherGroup.POST("/:id/rules", requireTeacherSelf, api.createTeacherAvailabilityRule)
+	teacherGroup.POST("/:id/rules/preview", requireTeacherSelf, api.previewTeacherAvailabilityRule)
+	teacherGroup.DELETE("/:id/rules/:ruleID", requireTeacherSelf, api.cancelTeacherAvailabilityRule)
+	teacherGroup.GET("/:id/durations", api.getTeacherDurationPolicies)
+	teacherGroup.PUT("/:id/durations", requireTeacherSelf, api.saveTeacherDurationPolicy)
+	teacherGroup.DELETE("/:id/durations", requireTeacherSelf, api.deleteTeacherDurationPolicy)
+	teacherGroup.PUT("/:id/timezone", requireTeacherSelf, api.updateTeacherTimeZone)
+	teacherGroup.GET("/:id/subjects", api.getTeacherSubjects)
+	teacherGroup.PUT("/:id/subjects", requireTeacherSelf, api.updateTeacherSubjects)
+	teacherGroup.GET("/:id/waitlist", requireTeacherSelf, api.getTeacherWaitlist)
+	teacherGroup.GET("/:id/calendar", requireTeacherSelf, api.getTeacherCalendarFeed)
+	teacherGroup.POST("/:id/calendar", requireTeacherSelf, api.resetTeacherCalendarFeed)
+
+	studentGroup := authorized.Group("/student")
+	studentGroup.GET("/allstudents", requireRoles(roleAdmin), api.getStudents)
+	studentGroup.GET("/:username/profile", requireStudentSelf, api.getProfileStudent)
+	studentGroup.PATCH("/:username/profile", requireStudentSelf, api.updateStudentProfile)
+	studentGroup.PUT("/:username/password", requireStudentSelf, api.changeStudentPassword)
+	studentGroup.DELETE("/:username", requireStudentSelf, api.deleteStudentAccount)
+	studentGroup.PUT("/:username/timezone", requireStudentSelf, api.updateStudentTimeZone)
+	studentGroup.GET("/:username/bookings", requireStudentSelf, api.getStudentBookings)
+	studentGroup.POST("/:username/bookings", requireStudentSelf, api.createStudentBooking)
+	studentGroup.GET("/:username/waitlist", requireStudentSelf, api.getStudentWaitlist)
+	studentGroup.POST("/:username/waitlist", requireStudentSelf, api.joinStudentWaitlist)
+	studentGroup.DELETE("/:username/waitlist/:entryID", requireStudentSelf, api.leaveStudentWaitlist)
+	studentGroup.GET("/:username/calendar", requireStudentSelf, api.getStudentCalendarFeed)
+	studentGroup.POST("/:username/calendar", requireStudentSelf, api.resetStudentCalendarFeed)
+	// the owner of the booking is checked by the handler; kept for the clients of the old endpoint
+	studentGroup.POST("/bookings/:id", api.cancelBooking)
+
+	// the student and the teacher of the booking are checked by the handlers
+	bookingsGroup := authorized.Group("/bookings")
+	bookingsGroup.DELETE("/:id", api.cancelBooking)
+	bookingsGroup.PUT("/:id/status", api.updateBookingStatus)
+
+	adminsGroup := authorized.Group("/admins", requireRoles(roleAdmin))
+	adminsGroup.GET("", api.getAdmins)
+	adminsGroup.POST("", api.createNewAdmin)
+	adminsGroup.GET("/login-failures", api.getLoginFailures)
+
+	authorized.POST("/import", requireRoles(roleAdmin), api.importRecords)
+	authorized.GET("/export", requireRoles(roleAdmin), api.exportData)
+
+	return router
 }
 
-func server() {
+// server serves the web pages until ctx is done.
+func server(ctx context.Context, sessions SessionStore) {
+	webSessions = sessions
+	webAPI = newAPIClientFromEnv()
 	fmt.Println("Web server is running on port 5050")
 	http.HandleFunc("/", rootHandler)
 	http.HandleFunc("/login", loginHandler)
@@ -44,13 +126,65 @@ func server() {
 	http.HandleFunc("/registration", registrationHandler)
 	http.HandleFunc("/userregistration", userRegistrationHandler)
 	http.HandleFunc("/welcome", welcomeHandler)
+	http.HandleFunc("/forgotPassword", forgotPasswordHandler)
+	http.HandleFunc("/resetPassword", resetPasswordHandler)
 	http.HandleFunc("/profile", profileHandler)
+	http.HandleFunc("/resetCalendar", resetCalendarHandler)
+	http.HandleFunc("/updateProfile", updateProfileHandler)
+	http.HandleFunc("/changePassword", changePasswordHandler)
+	http.HandleFunc("/deleteAccount", deleteAccountHandler)
 	http.HandleFunc("/bookings", bookingsHandler)
 	http.HandleFunc("/deleteBooking", deleteBookingHandler)
 	http.HandleFunc("/booklesson", bookLessonHandler)
 	http.HandleFunc("/availability", availabilityHandler)
 	http.HandleFunc("/bookedLesson", bookedLessonHandler)
+	http.HandleFunc("/joinWaitlist", joinWaitlistHandler)
+	http.HandleFunc("/leaveWaitlist", leaveWaitlistHandler)
+	http.HandleFunc("/teacher/login", teacherLoginHandler)
+	http.HandleFunc("/teacher/portal", teacherPortalHandler)
+	http.HandleFunc("/teacher/addAvailability", teacherAddAvailabilityHandler)
+	http.HandleFunc("/teacher/deleteAvailability", teacherDeleteAvailabilityHandler)
+	http.HandleFunc("/teacher/cancelBooking", teacherCancelBookingHandler)
+	http.HandleFunc("/teacher/resetCalendar", teacherResetCalendarHandler)
+	http.HandleFunc("/teacher/subjects", teacherSubjectsHandler)
+	http.HandleFunc("/admin", adminHandler)
+	http.HandleFunc("/admin/login", adminLoginHandler)
+	http.HandleFunc("/admin/teachers", adminTeachersHandler)
+	http.HandleFunc("/admin/addTeacher", adminAddTeacherHandler)
+	http.HandleFunc("/admin/students", adminStudentsHandler)
+	http.HandleFunc("/admin/addStudent", adminAddStudentHandler)
+	http.HandleFunc("/admin/deleteStudent", adminDeleteStudentHandler)
+	http.HandleFunc("/admin/availabilities", adminAvailabilitiesHandler)
+	http.HandleFunc("/admin/addAvailability", adminAddAvailabilityHandler)
+	http.HandleFunc("/admin/deleteAvailability", adminDeleteAvailabilityHandler)
+	http.HandleFunc("/admin/bookings", adminBookingsHandler)
+	http.HandleFunc("/admin/cancelBooking", adminCancelBookingHandler)
+	http.HandleFunc("/admin/bookingStatus", adminBookingStatusHandler)
+	http.HandleFunc("/admin/admins", adminAdminsHandler)
+	http.HandleFunc("/admin/addAdmin", adminAddAdminHandler)
+	http.HandleFunc("/admin/loginFailures", adminLoginFailuresHandler)
 
 	// Run the server on port 5050
-	http.ListenAndServe("localhost:5050", nil)
+	// every form posted needs the CSRF token of the session
+	serveUntilDone(ctx, &http.Server{Addr: "localhost:5050", Handler: csrfProtect(http.DefaultServeMux)})
+}
+
+// serveUntilDone runs the server until ctx is done, then shuts it down gracefully:
+// it stops accepting connections and waits for the requests in progress, up to shutdownTimeout.
+func serveUntilDone(ctx context.Context, srv *http.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down the server on %s: %v", srv.Addr, err)
+		}
+	}()
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
 }
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the accounts of the test APIs
+const (
+	testAdminUsername = "admin"
+	testAdminPassword = "admin-passw0rd"
+	testPassword      = "passw0rd1"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	os.Exit(m.Run())
+}
+
+// testAPI is the API on a test store, called without a network.
+type testAPI struct {
+	t      *testing.T
+	store  Store
+	router http.Handler
+	// admin is the token of the administrator
+	admin string
+}
+
+// newTestAPI returns an API on an empty memory store, with the administrator logged in.
+// The login limits are off, the tests that need them set their own.
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	return newTestAPIWithLogins(t, loginPolicy{})
+}
+
+// newTestAPIWithLogins returns an API on an empty memory store limiting the logins with the policy.
+func newTestAPIWithLogins(t *testing.T, logins loginPolicy) *testAPI {
+	t.Helper()
+	return newTestAPIOn(t, newMemoryStore(), logins)
+}
+
+// newTestAPIOn returns an API on the empty store, with the administrator logged in, limiting the logins with the policy.
+func newTestAPIOn(t *testing.T, store Store, logins loginPolicy) *testAPI {
+	t.Helper()
+	auth := &authConfig{
+		secret:         []byte("test secret"),
+		admin:          Credentials{Username: testAdminUsername, Password: testAdminPassword},
+		resetTTL:       time.Hour,
+		webURL:         defaultWebURL,
+		logins:         logins,
+		trustedProxies: defaultTrustedProxies,
+	}
+	api := &testAPI{t: t, store: store}
+	api.router = newRouter(api.store, auth, cancellationPolicy{StudentCutoff: 24 * time.Hour}, &writerNotifier{w: io.Discard})
+	api.admin = api.login(testAdminUsername, testAdminPassword, roleAdmin)
+	return api
+}
+
+// newTestSQLiteStore returns a store on a new database file, with all the migrations applied.
+func newTestSQLiteStore(t *testing.T) *sqliteStore {
+	t.Helper()
+	store, err := newSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if _, err := migrateUp(store.db); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// testOnStores runs the test on an API on each store.
+func testOnStores(t *testing.T, test func(t *testing.T, api *testAPI)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newTestAPI(t))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newTestAPIOn(t, newTestSQLiteStore(t), loginPolicy{}))
+	})
+}
+
+// do sends a request with the token, if any, and the body encoded as JSON unless it is nil.
+func (a *testAPI) do(method, path, token string, body any) *httptest.ResponseRecorder {
+	a.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	request := httptest.NewRequest(method, path, reader)
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	a.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// expect checks the status of the response.
+func (a *testAPI) expect(response *httptest.ResponseRecorder, status int) {
+	a.t.Helper()
+	if response.Code != status {
+		a.t.Fatalf("got status %d, want %d: %s", response.Code, status, response.Body.String())
+	}
+}
+
+// decode decodes the JSON body of the response into out.
+func (a *testAPI) decode(response *httptest.ResponseRecorder, out any) {
+	a.t.Helper()
+	if err := json.Unmarshal(response.Body.Bytes(), out); err != nil {
+		a.t.Fatalf("invalid response %q: %v", response.Body.String(), err)
+	}
+}
+
+// login returns the token of the account.
+func (a *testAPI) login(username, password, role string) string {
+	a.t.Helper()
+	response := a.do(http.MethodPost, "/api/auth/login", "", loginRequest{Username: username, Password: password, Role: role})
+	a.expect(response, http.StatusOK)
+	var login loginResponse
+	a.decode(response, &login)
+	return login.Token
+}
+
+// addStudent registers a student with testPassword and returns their token.
+func (a *testAPI) addStudent(username string) string {
+	a.t.Helper()
+	student := Student{Name: "Student", Surname: username, DateOfBirth: time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC), Username: username, Password: testPassword}
+	a.expect(a.do(http.MethodPost, "/api/student/addstudent", "", student), http.StatusCreated)
+	return a.login(username, testPassword, roleStudent)
+}
+
+// addTeacher creates a teacher without an account and returns their ID.
+func (a *testAPI) addTeacher(surname string) int {
+	a.t.Helper()
+	a.expect(a.do(http.MethodPost, "/api/teachers/addteacher", a.admin, Teacher{Name: "Teacher", Surname: surname}), http.StatusCreated)
+	id, err := a.store.TeacherIDByFullName("Teacher", surname)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return id
+}
+
+// addAvailability creates an hour long availability of the teacher and returns its ID.
+func (a *testAPI) addAvailability(teacherID int, startsAt time.Time) int {
+	a.t.Helper()
+	availability := Availability{StartsAt: startsAt, DurationMinutes: 60}
+	a.expect(a.do(http.MethodPost, fmt.Sprintf("/api/teacher/%d/availability", teacherID), a.admin, availability), http.StatusCreated)
+	availabilities, err := a.store.TeacherAvailabilities(teacherID)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	for _, saved := range availabilities {
+		if saved.StartsAt.Equal(startsAt) {
+			return saved.ID
+		}
+	}
+	a.t.Fatalf("availability at %s not saved", startsAt)
+	return 0
+}
+
+// nextHour returns the start of an hour the days after now, in UTC.
+func nextHour(days int) time.Time {
+	return time.Now().UTC().Truncate(time.Hour).Add(time.Duration(days) * 24 * time.Hour)
+}
+
+func TestStudentRegistersAndReadsOwnProfile(t *testing.T) {
+	api := newTestAPI(t)
+	token := api.addStudent("alice")
+	api.addStudent("bob")
+
+	response := api.do(http.MethodGet, "/api/student/alice/profile", token, nil)
+	api.expect(response, http.StatusOK)
+	var profile Student
+	api.decode(response, &profile)
+	if profile.Username != "alice" || profile.Password != "" {
+		t.Fatalf("got profile %+v", profile)
+	}
+
+	api.expect(api.do(http.MethodGet, "/api/student/bob/profile", token, nil), http.StatusForbidden)
+	api.expect(api.do(http.MethodGet, "/api/student/alice/profile", "", nil), http.StatusUnauthorized)
+}
+
+func TestInvalidStudentListsEveryField(t *testing.T) {
+	api := newTestAPI(t)
+	response := api.do(http.MethodPost, "/api/student/addstudent", "", Student{Surname: "Smith", Username: "a!", Password: "short"})
+	api.expect(response, http.StatusUnprocessableEntity)
+
+	var body struct {
+		Errors []FieldError `json:"errors"`
+	}
+	api.decode(response, &body)
+	fields := map[string]bool{}
+	for _, fieldErr := range body.Errors {
+		fields[fieldErr.Field] = true
+	}
+	for _, field := range []string{"name", "date_of_birth", "username", "password"} {
+		if !fields[field] {
+			t.Errorf("no error for %s in %+v", field, body.Errors)
+		}
+	}
+	if _, err := api.store.StudentByUsername("a!"); err == nil {
+		t.Error("the invalid student was saved")
+	}
+}
+
+func TestInvalidTeacherIDIsRefused(t *testing.T) {
+	api := newTestAPI(t)
+	token := api.addStudent("alice")
+
+	api.expect(api.do(http.MethodGet, "/api/teacher/abc/availability", token, nil), http.StatusBadRequest)
+	//the API is still serving
+	api.expect(api.do(http.MethodGet, "/api/teachers", token, nil), http.StatusOK)
+}
+
+func TestOverlappingAvailabilityIsRefused(t *testing.T) {
+	api := newTestAPI(t)
+	teacherID := api.addTeacher("Lovelace")
+	startsAt := nextHour(3)
+	api.addAvailability(teacherID, startsAt)
+
+	overlapping := Availability{StartsAt: startsAt, DurationMinutes: 60}
+	response := api.do(http.MethodPost, fmt.Sprintf("/api/teacher/%d/availability", teacherID), api.admin, overlapping)
+	api.expect(response, http.StatusUnprocessableEntity)
+	var body struct {
+		Errors []FieldError `json:"errors"`
+	}
+	api.decode(response, &body)
+	if len(body.Errors) != 1 || body.Errors[0].Field != "starts_at" {
+		t.Fatalf("got errors %+v", body.Errors)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// names of the jobs of the scheduler, also the keys of their saved runs
+const (
+	jobLessonReminders  = "lesson_reminders"
+	jobCompleteBookings = "complete_bookings"
+	jobPurgeSessions    = "purge_sessions"
+)
+
+// lessonReminders are the reminders sent before each booked lesson, the closest to the lesson first.
+// A lesson gets the reminder of the closest window it is in: when the server was down during the whole
+// 24h window, only the 1h reminder is sent.
+var lessonReminders = []struct {
+	name   string
+	before time.Duration
+}{
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+}
+
+// bookingCompletionDelay is how long after its end a lesson still booked is marked as completed,
+// leaving the teacher the time to report a no-show
+const bookingCompletionDelay = 24 * time.Hour
+
+// lessonRemindersJob emails the students and the teachers before their booked lessons.
+// A reminder is recorded in the store before it is sent, so that a restart of the server never sends it
+// twice; a reminder whose email fails is logged and not sent again.
+func lessonRemindersJob(store Store, notifier Notifier) scheduledJob {
+	return scheduledJob{name: jobLessonReminders, run: func(ctx context.Context, now time.Time) error {
+		bookings, err := store.BookingsStartingBetween(now, now.Add(lessonReminders[len(lessonReminders)-1].before))
+		if err != nil {
+			return err
+		}
+		for _, booking := range bookings {
+			if ctx.Err() != nil {
+				//the server is shutting down, the next run sends the rest
+				return nil
+			}
+			timeLeft := booking.StartsAt.Sub(now)
+			var reminder string
+			for _, r := range lessonReminders {
+				if timeLeft <= r.before {
+					reminder = r.name
+					break
+				}
+			}
+			claimed, err := store.ClaimLessonReminder(booking.ID, reminder, now)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				continue
+			}
+
+			emails, err := lessonEmails(store, emailLessonReminder, booking, formatTimeLeft(timeLeft))
+			if err != nil {
+				log.Printf("Error rendering the %s reminder of booking %d: %v", reminder, booking.ID, err)
+				continue
+			}
+			for _, email := range emails {
+				if err := notifier.Send(email); err != nil {
+					log.Printf("Error sending the %s reminder of booking %d to %s: %v", reminder, booking.ID, email.To, err)
+				}
+			}
+		}
+		return nil
+	}}
+}
+
+// completeBookingsJob marks as completed the lessons still booked a day after they ended.
+func completeBookingsJob(store Store) scheduledJob {
+	return scheduledJob{name: jobCompleteBookings, run: func(ctx context.Context, now time.Time) error {
+		completed, err := store.CompleteBookingsEndedBefore(now.Add(-bookingCompletionDelay))
+		if completed > 0 {
+			log.Printf("Marked %d past bookings as completed", completed)
+		}
+		return err
+	}}
+}
+
+// purgeSessionsJob removes the expired web sessions, so that the ones nobody comes back to don't pile up.
+func purgeSessionsJob(sessions SessionStore) scheduledJob {
+	return scheduledJob{name: jobPurgeSessions, run: func(ctx context.Context, now time.Time) error {
+		_, err := sessions.DeleteExpiredSessions(now)
+		return err
+	}}
+}
+
+// formatTimeLeft formats the time left before a lesson for a reminder, in hours or, under an hour, in minutes.
+func formatTimeLeft(timeLeft time.Duration) string {
+	if timeLeft >= time.Hour {
+		hours := int(timeLeft.Round(time.Hour).Hours())
+		if hours == 1 {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", hours)
+	}
+	minutes := max(int(timeLeft.Round(time.Minute).Minutes()), 1)
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// defaultSchedulerInterval is how often the jobs of the scheduler run, set with GOTUTOR_SCHEDULER_INTERVAL
+const defaultSchedulerInterval = time.Minute
+
+// scheduledJob is a job run by the scheduler at every interval. run gets the time of the run and
+// a context done when the server shuts down, so that a long run can stop early.
+type scheduledJob struct {
+	name string
+	run  func(ctx context.Context, now time.Time) error
+}
+
+// scheduler runs periodic jobs in the background of a server, each one in its own goroutine,
+// until the context given to start is done.
+type scheduler struct {
+	interval time.Duration
+	jobs     []scheduledJob
+	// runs saves when the jobs last ran, nil when the state is not kept
+	runs SchedulerStore
+	wg   sync.WaitGroup
+}
+
+// newScheduler returns a scheduler running the jobs at every interval. With runs the last run of
+// each job is saved, and after a restart a job waits for the rest of its interval before running again.
+func newScheduler(interval time.Duration, runs SchedulerStore, jobs ...scheduledJob) *scheduler {
+	if interval <= 0 {
+		log.Fatal("The interval of the scheduler needs to be positive")
+	}
+	return &scheduler{interval: interval, jobs: jobs, runs: runs}
+}
+
+// schedulerIntervalFromEnv reads the interval of the scheduler from GOTUTOR_SCHEDULER_INTERVAL.
+func schedulerIntervalFromEnv() time.Duration {
+	return durationFromEnv("GOTUTOR_SCHEDULER_INTERVAL", defaultSchedulerInterval)
+}
+
+// start runs the jobs in the background until ctx is done.
+func (s *scheduler) start(ctx context.Context) {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+}
+
+// wait returns once every job has stopped. The runs in progress when ctx is done are finished first.
+func (s *scheduler) wait() {
+	s.wg.Wait()
+}
+
+// loop runs the job at every interval until ctx is done. The first run is right away, unless
+// the job ran less than an interval ago before a restart.
+func (s *scheduler) loop(ctx context.Context, job scheduledJob) {
+	defer s.wg.Done()
+
+	var delay time.Duration
+	if s.runs != nil {
+		lastRun, err := s.runs.JobRun(job.name)
+		if err != nil {
+			log.Printf("Error reading the last run of the %s job: %v", job.name, err)
+		} else if !lastRun.LastRunAt.IsZero() {
+			delay = max(s.interval-time.Since(lastRun.LastRunAt), 0)
+		}
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-timer.C:
+			s.runJob(ctx, job, now)
+			timer.Reset(s.interval)
+		}
+	}
+}
+
+// runJob runs the job once, logging its error, and saves the run.
+func (s *scheduler) runJob(ctx context.Context, job scheduledJob, now time.Time) {
+	run := JobRun{Name: job.name, LastRunAt: now}
+	if err := job.run(ctx, now); err != nil {
+		log.Printf("Error running the %s job: %v", job.name, err)
+		run.LastError = err.Error()
+	}
+	if s.runs != nil {
+		if err := s.runs.SaveJobRun(run); err != nil {
+			log.Printf("Error saving the run of the %s job: %v", job.name, err)
+		}
+	}
+}
@@ -3,24 +3,26 @@ package main
 import "C"
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"html/template"
-	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	_ "github.com/astaxie/session/providers/memory"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
-	"golang.org/x/crypto/bcrypt"
+
+	"server/apiclient"
 )
 
 func rootHandler(w http.ResponseWriter, r *http.Request) {
@@ -33,7 +35,7 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
 
 func loginHandler(w http.ResponseWriter, r *http.Request) {
 	title := "Login page"
-	p := &Page{Title: title}
+	p := &Page{Title: title, CSRFToken: formCSRFToken(w, r)}
 
 	t, _ := template.ParseFiles("login.html")
 	t.Execute(w, p)
@@ -53,16 +55,20 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	sessionToken := c.Value
 
-	// remove the users session from the session map
-	delete(sessions_new, sessionToken)
+	// remove the users session from the session store
+	if err := webSessions.DeleteSession(sessionToken); err != nil {
+		log.Println("Error deleting the session:", err)
+	}
 
 	// We need to let the client know that the cookie is expired
 	// In the response, we set the session token to an empty
 	// value and set its expiry as the current time
 	http.SetCookie(w, &http.Cookie{
-		Name:    "session_token",
-		Value:   "",
-		Expires: time.Now(),
+		Name:     "session_token",
+		Value:    "",
+		Expires:  time.Now(),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
 	})
 	// Redirect to the welcome page after logout
 	http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -70,7 +76,7 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 
 func registrationHandler(w http.ResponseWriter, r *http.Request) {
 	title := "Registration page"
-	p := &Page{Title: title}
+	p := &Page{Title: title, CSRFToken: formCSRFToken(w, r)}
 	ctxMsg := r.Context().Value("Message")
 	if ctxMsg != nil {
 		if msg, ok := ctxMsg.(string); ok {
@@ -98,48 +104,82 @@ func userRegistrationHandler(w http.ResponseWriter, r *http.Request) {
 	if password != passwordConfirm {
 		reloadRegistrationWithMessage(w, r, "Passwords do not match")
 	} else {
-		_, err := getStudentInfo(username)
-		if err == nil {
-			reloadRegistrationWithMessage(w, r, "Username already exists")
-		} else {
-			//call the Api for registration of a new student
-			date, _ := time.Parse("2006-01-02", dateOfBirth)
-			urlAPI := "http://localhost:8080/api/student/addstudent"
-			neeStudent := Student{
-				Name:        name,
-				Surname:     surname,
-				DateOfBirth: date,
-				Username:    username,
-				Password:    password,
-			}
-			payload, err := json.Marshal(neeStudent)
-			if err != nil {
-				return
-			}
-			resp, err := http.Post(urlAPI, "application/json", bytes.NewBuffer(payload))
-			if err != nil {
-				return
-			}
-			defer resp.Body.Close()
-
-			_, err = io.ReadAll(resp.Body)
-			if err != nil {
-				return
-			}
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-
+		//call the Api for registration of a new student
+		date, _ := time.Parse("2006-01-02", dateOfBirth)
+		neeStudent := Student{
+			Name:        name,
+			Surname:     surname,
+			DateOfBirth: date,
+			Username:    username,
+			Password:    password,
+			TimeZone:    r.FormValue("timezone"),
+			Email:       strings.TrimSpace(r.FormValue("email")),
+		}
+		//an already used username is reported by the API
+		if err := webAPI.CreateStudent(r.Context(), neeStudent); err != nil {
+			reloadRegistrationWithMessage(w, r, apiErrorMessage(err, "The registration couldn't be completed"))
+			return
 		}
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
 	}
 }
 
 func reloadRegistrationWithMessage(w http.ResponseWriter, r *http.Request, s string) {
 	t, _ := template.New("registration.html").Funcs(timeToDate).ParseFiles("registration.html")
-	t.Execute(w, &Page{Title: "Registration page", Body: s})
+	t.Execute(w, &Page{Title: "Registration page", Body: s, CSRFToken: formCSRFToken(w, r)})
 }
 
 func reloadLoginWithMessage(w http.ResponseWriter, r *http.Request, s string) {
 	t, _ := template.New("login.html").Funcs(timeToDate).ParseFiles("login.html")
-	t.Execute(w, &Page{Title: "Login page", Body: s})
+	t.Execute(w, &Page{Title: "Login page", Body: s, CSRFToken: formCSRFToken(w, r)})
+}
+
+// forgotPasswordHandler shows the form asking for a password reset link and, when it is posted, has the API send the link.
+func forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		renderForgotPasswordPage(w, r, "")
+		return
+	}
+	if err := loginAPI(r).ForgotPassword(r.Context(), strings.TrimSpace(r.FormValue("username"))); err != nil {
+		renderForgotPasswordPage(w, r, apiErrorMessage(err, "The reset link couldn't be sent"))
+		return
+	}
+	renderForgotPasswordPage(w, r, forgotPasswordMessage)
+}
+
+// resetPasswordHandler shows the form choosing a new password, opened from a reset link, and sets the password
+// when it is posted.
+func resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	if r.Method != http.MethodPost {
+		renderResetPasswordPage(w, r, token, "")
+		return
+	}
+	password := r.FormValue("psw")
+	if password != r.FormValue("psw-repeat") {
+		renderResetPasswordPage(w, r, token, "Passwords do not match")
+		return
+	}
+	if err := webAPI.ResetPassword(r.Context(), token, password); err != nil {
+		renderResetPasswordPage(w, r, token, apiErrorMessage(err, "The password couldn't be reset"))
+		return
+	}
+	renderLoginPage(w, r, "Your password has been reset: log in with the new one")
+}
+
+func renderForgotPasswordPage(w http.ResponseWriter, r *http.Request, message string) {
+	t, _ := template.ParseFiles("forgotPassword.html")
+	t.Execute(w, &Page{Title: "Forgot your password?", Body: message, CSRFToken: formCSRFToken(w, r)})
+}
+
+func renderResetPasswordPage(w http.ResponseWriter, r *http.Request, token, message string) {
+	//the token is in the URL of the page: it isn't sent to the sites of the stylesheets and the scripts
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	t, _ := template.ParseFiles("resetPassword.html")
+	t.Execute(w, struct {
+		Page
+		Token string
+	}{Page: Page{Title: "Reset your password", Body: message, CSRFToken: formCSRFToken(w, r)}, Token: token})
 }
 
 func welcomeHandler(w http.ResponseWriter, r *http.Request) {
@@ -157,7 +197,7 @@ func welcomeHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return
 	}
-	data := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.Local)
+	data := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
 
 	student := &Student{
 		Name:        r.FormValue("name"),
@@ -165,22 +205,11 @@ func welcomeHandler(w http.ResponseWriter, r *http.Request) {
 		DateOfBirth: data,
 		Username:    r.FormValue("username"),
 		Password:    r.FormValue("psw")}
-	//API call at http://localhost:8080/api/student/addstudent
-	payload, err := json.Marshal(student)
-	if err != nil {
-		return
-	}
-
-	url := "http://localhost:8080/api/student/addstudent"
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
+	webAPI.CreateStudent(r.Context(), *student)
 }
 
 func profileHandler(w http.ResponseWriter, r *http.Request) {
-	userSession, err := checkSession(r)
+	userSession, err := checkStudentSession(w, r)
 	var student Student
 	if err != nil {
 		var creds Credentials
@@ -188,75 +217,202 @@ func profileHandler(w http.ResponseWriter, r *http.Request) {
 		creds.Username = r.FormValue("username")
 		creds.Password = r.FormValue("password")
 
-		student, err = getStudentInfo(creds.Username)
+		//the API checks the credentials and issues the token used for the next calls
+		login, err := loginAPI(r).Login(r.Context(), creds.Username, creds.Password, roleStudent)
 		if err != nil {
-			reloadRegistrationWithMessage(w, r, "Username doesn't found. Please register!")
+			reloadLoginWithMessage(w, r, apiErrorMessage(err, "Invalid username or password"))
 			return
 		}
 
-		err = bcrypt.CompareHashAndPassword([]byte(student.Password), []byte(creds.Password))
+		userSession = createSession(w, Session{username: login.Username, role: roleStudent, token: login.Token, tokenExpiry: login.ExpiresAt, timeZone: login.TimeZone})
+		student, err = apiFor(userSession).StudentProfile(r.Context(), userSession.username)
 		if err != nil {
-			reloadLoginWithMessage(w, r, "Password doesn't match")
+			reloadLoginWithMessage(w, r, "Some error occurred")
 			return
 		}
-
-		//create a new random session token
-		//we use the "github.com/google/uuid" library to generate UUIDs
-		sessionToken := uuid.NewString()
-		expiresAt := time.Now().Add(120 * time.Second)
-
-		// Set the token in the session map, along with the session information
-		sessions_new[sessionToken] = Session{
-			username: creds.Username,
-			expiry:   expiresAt,
-		}
-
-		//the client cookie for "session_token" is set using the the session token that was generated
-		//the expire time is set to 120 seconds
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session_token",
-			Value:    sessionToken,
-			Expires:  expiresAt,
-			HttpOnly: true,
-		})
 	} else {
-		student, err = getStudentInfo(userSession.username)
+		student, err = apiFor(userSession).StudentProfile(r.Context(), userSession.username)
 		if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
 	}
-	renderProfilePage(w, &student)
+	renderProfilePage(w, r, userSession, student, "")
+}
+
+// updateProfileHandler saves the changes the student made to their profile.
+func updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkStudentSession(w, r)
+	if err != nil {
+		renderLoginPage(w, r, "")
+		return
+	}
+	dateOfBirth, err := time.Parse("2006-01-02", r.FormValue("dateofbirth"))
+	if err != nil {
+		renderProfileWithMessage(w, r, userSession, "The date of birth needs to be a valid date")
+		return
+	}
+	name, surname := r.FormValue("name"), r.FormValue("surname")
+	timeZone, email := timeZoneOrUTC(strings.TrimSpace(r.FormValue("timezone"))), strings.TrimSpace(r.FormValue("email"))
+	request := studentProfileRequest{Name: &name, Surname: &surname, DateOfBirth: &dateOfBirth, TimeZone: &timeZone, Email: &email}
+	student, err := apiFor(userSession).UpdateStudentProfile(r.Context(), userSession.username, request)
+	if err != nil {
+		renderProfileWithMessage(w, r, userSession, apiErrorMessage(err, "The profile couldn't be updated"))
+		return
+	}
+	//the times the student enters are read in their new time zone
+	if student.TimeZone != userSession.timeZone {
+		userSession.timeZone = student.TimeZone
+		saveSession(r, userSession)
+	}
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+// changePasswordHandler replaces the password of the student, who confirms the current one.
+func changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkStudentSession(w, r)
+	if err != nil {
+		renderLoginPage(w, r, "")
+		return
+	}
+	newPassword := r.FormValue("new_password")
+	if newPassword != r.FormValue("new_password_repeat") {
+		renderProfileWithMessage(w, r, userSession, "Passwords do not match")
+		return
+	}
+	//the password is checked like at the login, limited per browser
+	changed, err := loginAPI(r).WithToken(userSession.token).ChangeStudentPassword(r.Context(), userSession.username, r.FormValue("old_password"), newPassword)
+	if err != nil {
+		renderProfileWithMessage(w, r, userSession, apiErrorMessage(err, "The password couldn't be changed"))
+		return
+	}
+	//the token of the session was revoked with the old password
+	userSession.token, userSession.tokenExpiry = changed.Token, changed.ExpiresAt
+	saveSession(r, userSession)
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+// deleteAccountHandler deletes the account of the student, who confirms with their password, and logs them out.
+func deleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkStudentSession(w, r)
+	if err != nil {
+		renderLoginPage(w, r, "")
+		return
+	}
+	if err := loginAPI(r).WithToken(userSession.token).DeleteStudent(r.Context(), userSession.username, r.FormValue("password")); err != nil {
+		renderProfileWithMessage(w, r, userSession, apiErrorMessage(err, "The account couldn't be deleted"))
+		return
+	}
+	logoutHandler(w, r)
+}
+
+// renderProfileWithMessage shows the profile of the student with a message, when an action failed.
+func renderProfileWithMessage(w http.ResponseWriter, r *http.Request, userSession Session, message string) {
+	student, err := apiFor(userSession).StudentProfile(r.Context(), userSession.username)
+	if err != nil {
+		http.Error(w, "Error fetching the profile from the API", http.StatusInternalServerError)
+		return
+	}
+	renderProfilePage(w, r, userSession, student, message)
+}
+
+// resetCalendarHandler gives the student a new calendar feed URL, for when the previous one was shared by mistake.
+func resetCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkStudentSession(w, r)
+	if err != nil {
+		renderLoginPage(w, r, "")
+		return
+	}
+	if _, err := apiFor(userSession).ResetStudentCalendarFeed(r.Context(), userSession.username); err != nil {
+		log.Println("Error resetting the calendar feed:", err)
+	}
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+// createSession starts a new session for the user and sets the session cookie.
+func createSession(w http.ResponseWriter, userSession Session) Session {
+	//create a new random session token
+	//we use the "github.com/google/uuid" library to generate UUIDs
+	sessionToken := uuid.NewString()
+	userSession.expiry = slidingExpiry(userSession, time.Now())
+	userSession.csrfToken = newCSRFToken()
+
+	// Save the session under its token
+	if err := webSessions.SaveSession(sessionToken, userSession); err != nil {
+		log.Println("Error saving the session:", err)
+	}
+
+	//the client cookie for "session_token" is set using the the session token that was generated
+	setSessionCookie(w, sessionToken, userSession.expiry)
+	return userSession
+}
+
+// saveSession saves the changes made to the session of the request.
+func saveSession(r *http.Request, userSession Session) {
+	c, err := r.Cookie("session_token")
+	if err != nil {
+		return
+	}
+	if err := webSessions.SaveSession(c.Value, userSession); err != nil {
+		log.Println("Error saving the session:", err)
+	}
+}
+
+// setSessionCookie sets the session cookie, expiring with the session.
+// The browsers don't send it with the forms posted from other sites.
+func setSessionCookie(w http.ResponseWriter, sessionToken string, expiry time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    sessionToken,
+		Expires:  expiry,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
 }
 
 func bookingsHandler(w http.ResponseWriter, r *http.Request) {
-	userSession, err := checkSession(r)
+	userSession, err := checkStudentSession(w, r)
 	if err != nil {
-		renderLoginPage(w, "")
+		renderLoginPage(w, r, "")
 	} else {
-		bookings, err := getBookings(userSession.username)
-		if err != nil {
-			http.Error(w, "Error fetching bookings from the API", http.StatusInternalServerError)
-			return
-		}
+		renderBookingsPage(w, r, userSession, "")
+	}
+}
 
-		t, err := template.New("bookings.html").Funcs(timeToDate).ParseFiles("bookings.html")
-		if err != nil {
-			log.Fatal(err)
-		}
-		err = t.Execute(w, struct {
-			Username string
-			Bookings []LessonBooked
-		}{Username: userSession.username, Bookings: bookings})
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+// renderBookingsPage shows the bookings of the student, with a message when an action failed.
+func renderBookingsPage(w http.ResponseWriter, r *http.Request, userSession Session, message string) {
+	client := apiFor(userSession)
+	bookings, err := client.StudentBookings(r.Context(), userSession.username)
+	if err != nil {
+		http.Error(w, "Error fetching bookings from the API", http.StatusInternalServerError)
+		return
+	}
+	waitlist, err := client.StudentWaitlist(r.Context(), userSession.username)
+	if err != nil {
+		http.Error(w, "Error fetching the waitlist from the API", http.StatusInternalServerError)
+		return
+	}
+
+	t, err := template.New("bookings.html").Funcs(timeToDate).ParseFiles("bookings.html")
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = t.Execute(w, struct {
+		Username  string
+		Message   string
+		Bookings  []LessonBooked
+		Waitlist  []WaitlistEntry
+		CSRFToken string
+	}{Username: userSession.username, Message: message, Bookings: bookings, Waitlist: waitlist, CSRFToken: userSession.csrfToken})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 }
 
-func checkSession(r *http.Request) (Session, error) {
+// checkSession returns the session of the logged in user and extends it, since the user is active.
+func checkSession(w http.ResponseWriter, r *http.Request) (Session, error) {
 	c, err := r.Cookie("session_token")
 	if err != nil {
 		if err == http.ErrNoCookie {
@@ -266,63 +422,132 @@ func checkSession(r *http.Request) (Session, error) {
 	}
 	sessionToken := c.Value
 
-	userSession, exists := sessions_new[sessionToken]
+	userSession, exists, err := webSessions.Session(sessionToken)
+	if err != nil {
+		log.Println("Error reading the session:", err)
+		return Session{}, errors.New("No session")
+	}
 	if !exists {
 		return Session{}, errors.New("Unauthorized: Session not found")
 	}
 
 	if userSession.isExpired() {
-		delete(sessions_new, sessionToken)
+		webSessions.DeleteSession(sessionToken)
 		return Session{}, errors.New("Unauthorized: Session expired")
 	}
 
+	//sliding expiration: the session lives on as long as the user keeps using it
+	userSession.expiry = slidingExpiry(userSession, time.Now())
+	if userSession.csrfToken == "" {
+		userSession.csrfToken = newCSRFToken()
+	}
+	if err := webSessions.SaveSession(sessionToken, userSession); err != nil {
+		log.Println("Error saving the session:", err)
+	}
+	setSessionCookie(w, sessionToken, userSession.expiry)
+	return userSession, nil
+}
+
+// checkStudentSession returns the session of the logged in student.
+func checkStudentSession(w http.ResponseWriter, r *http.Request) (Session, error) {
+	return checkSessionRole(w, r, roleStudent)
+}
+
+// checkSessionRole returns the session of the logged in user if they have the given role.
+func checkSessionRole(w http.ResponseWriter, r *http.Request, role string) (Session, error) {
+	userSession, err := checkSession(w, r)
+	if err != nil {
+		return Session{}, err
+	}
+	if userSession.role != role {
+		return Session{}, errors.New("Unauthorized: wrong role")
+	}
 	return userSession, nil
 }
 
 func deleteBookingHandler(w http.ResponseWriter, r *http.Request) {
-	//retrieve ID of the booking
-	id := r.FormValue("booking_id")
-	urlAPI := "http://localhost:8080/api/student/bookings/" + id
-	payload, err := json.Marshal(id)
+	userSession, err := checkStudentSession(w, r)
 	if err != nil {
+		renderLoginPage(w, r, "")
 		return
 	}
-	resp, err := http.Post(urlAPI, "application/json", bytes.NewBuffer(payload))
+	//retrieve ID of the booking and the reason of the cancellation
+	bookingID, _ := strconv.Atoi(r.FormValue("booking_id"))
+	if err := apiFor(userSession).CancelBooking(r.Context(), bookingID, r.FormValue("reason")); err != nil {
+		renderBookingsPage(w, r, userSession, apiErrorMessage(err, "The booking couldn't be cancelled"))
+		return
+	}
+	http.Redirect(w, r, "/bookings", http.StatusSeeOther)
+}
+
+// joinWaitlistHandler puts the student on the waitlist of a booked availability, or of a week when no
+// availability is selected.
+func joinWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkStudentSession(w, r)
 	if err != nil {
+		renderLoginPage(w, r, "")
+		return
+	}
+	teacherID, _ := strconv.Atoi(r.FormValue("teacherID"))
+	availabilityID, _ := strconv.Atoi(r.FormValue("availability_id"))
+	request := waitlistRequest{
+		TeacherID:      teacherID,
+		AvailabilityID: availabilityID,
+		Week:           r.FormValue("week"),
+		Subject:        r.FormValue("subject"),
+	}
+	if _, err := apiFor(userSession).JoinWaitlist(r.Context(), userSession.username, request); err != nil {
+		renderBookingsPage(w, r, userSession, apiErrorMessage(err, "The waitlist couldn't be joined"))
 		return
 	}
-	defer resp.Body.Close()
+	http.Redirect(w, r, "/bookings", http.StatusSeeOther)
+}
 
-	var username string
-	err = json.NewDecoder(resp.Body).Decode(&username)
+// leaveWaitlistHandler removes a waiting entry of the student from the waitlist.
+func leaveWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkStudentSession(w, r)
 	if err != nil {
+		renderLoginPage(w, r, "")
+		return
+	}
+	entryID, _ := strconv.Atoi(r.FormValue("entry_id"))
+	if err := apiFor(userSession).LeaveWaitlist(r.Context(), userSession.username, entryID); err != nil {
+		renderBookingsPage(w, r, userSession, apiErrorMessage(err, "The waitlist couldn't be left"))
 		return
 	}
-	url := "http://localhost:5050/bookings?username=" + username
-	http.Redirect(w, r, url, http.StatusSeeOther)
+	http.Redirect(w, r, "/bookings", http.StatusSeeOther)
 }
 
 func bookLessonHandler(w http.ResponseWriter, r *http.Request) {
-	userSession, err := checkSession(r)
+	userSession, err := checkStudentSession(w, r)
 	if err != nil {
-		renderLoginPage(w, "")
+		renderLoginPage(w, r, "")
 	} else {
-		//take the list of the teachers using api
-		apiURL := "http://localhost:8080/api/teachers"
-		// Make a GET request to the API endpoint
-		response, err := http.Get(apiURL)
-		if err != nil {
-			http.Error(w, "Error fetching teachers from the API", http.StatusInternalServerError)
-			return
-		}
-		defer response.Body.Close()
+		api := apiFor(userSession)
+		//the filters of the form, the times are in the time zone of the student
+		filter := teacherFilter{Subject: r.FormValue("subject"), Name: strings.TrimSpace(r.FormValue("name")), From: r.FormValue("from"), To: r.FormValue("to")}
+		search, message := filter.search(loadLocation(userSession.timeZone))
 
-		//decode the JSON response into a list of teachers
+		//take the list of the teachers using api, only the ones matching the filters if any
 		var teachers []Teacher
-		err = json.NewDecoder(response.Body).Decode(&teachers)
+		if message == "" && filter.isSet() {
+			teachers, err = api.SearchTeachers(r.Context(), search)
+			if err != nil {
+				message = apiErrorMessage(err, "The teachers couldn't be searched")
+			} else if len(teachers) == 0 {
+				message = "No teachers match the filters"
+			}
+		} else if message == "" {
+			teachers, err = api.ListTeachers(r.Context())
+			if err != nil {
+				http.Error(w, "Error fetching teachers from the API", http.StatusInternalServerError)
+				return
+			}
+		}
+		//the form is still shown without the list of the subjects if the API can't give it
+		subjects, err := api.ListSubjects(r.Context())
 		if err != nil {
-			http.Error(w, "Error fetching teachers from the API", http.StatusInternalServerError)
-			return
+			log.Println("Error fetching the subjects:", err)
 		}
 
 		t, err := template.New("booklesson-teacherList.html").Funcs(timeToDate).ParseFiles("booklesson-teacherList.html")
@@ -330,9 +555,13 @@ func bookLessonHandler(w http.ResponseWriter, r *http.Request) {
 			log.Fatal(err)
 		}
 		err = t.Execute(w, struct {
-			Username string
-			Teachers []Teacher
-		}{Username: userSession.username, Teachers: teachers})
+			Username  string
+			Teachers  []Teacher
+			Subjects  []Subject
+			Filter    teacherFilter
+			Message   string
+			CSRFToken string
+		}{Username: userSession.username, Teachers: teachers, Subjects: subjects, Filter: filter, Message: message, CSRFToken: userSession.csrfToken})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -342,9 +571,10 @@ func bookLessonHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func availabilityHandler(w http.ResponseWriter, r *http.Request) {
-	userSession, err := checkSession(r)
+	userSession, err := checkStudentSession(w, r)
 	if err != nil {
-		renderLoginPage(w, "")
+		renderLoginPage(w, r, "")
+		return
 	}
 	teacherID := r.FormValue("teacher")
 
@@ -352,19 +582,16 @@ func availabilityHandler(w http.ResponseWriter, r *http.Request) {
 	teacherName := r.FormValue("teacherName" + teacherID)
 	teacherSurname := r.FormValue("teacherSurname" + teacherID)
 
-	apiURL := "http://localhost:8080/api/teacher/" + teacherID + "/availability"
-	//make a GET request to the API endpoint
-	response, err := http.Get(apiURL)
+	id, _ := strconv.Atoi(teacherID)
+	availabilities, err := apiFor(userSession).TeacherAvailability(r.Context(), id)
 	if err != nil {
 		http.Error(w, "Error fetching teachers from the API", http.StatusInternalServerError)
 		return
 	}
-	defer response.Body.Close()
-	var availabilities []Availability
-	err = json.NewDecoder(response.Body).Decode(&availabilities)
+	//the subjects of the teacher are suggested, the one of the filter of the previous page first
+	subjects, err := apiFor(userSession).TeacherSubjects(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Error fetching teachers from the API", http.StatusInternalServerError)
-		return
+		log.Println("Error fetching the subjects of the teacher:", err)
 	}
 	t, err := template.New("availabilityTeacher.html").Funcs(timeToDate).ParseFiles("availabilityTeacher.html")
 	if err != nil {
@@ -376,7 +603,11 @@ func availabilityHandler(w http.ResponseWriter, r *http.Request) {
 		TeacherName    string
 		TeacherSurname string
 		Availabilities []Availability
-	}{Username: userSession.username, TeacherID: teacherID, TeacherName: teacherName, TeacherSurname: teacherSurname, Availabilities: availabilities})
+		Subjects       []string
+		Subject        string
+		CSRFToken      string
+	}{Username: userSession.username, TeacherID: teacherID, TeacherName: teacherName, TeacherSurname: teacherSurname, Availabilities: availabilities,
+		Subjects: subjects, Subject: r.FormValue("subject"), CSRFToken: userSession.csrfToken})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -384,61 +615,76 @@ func availabilityHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func bookedLessonHandler(w http.ResponseWriter, r *http.Request) {
-	userSession, err := checkSession(r)
+	userSession, err := checkStudentSession(w, r)
 	if err != nil {
-		renderLoginPage(w, "")
+		renderLoginPage(w, r, "")
 	} else {
 		r.ParseForm()
 		subject := r.FormValue("subject")
 		teacherID, _ := strconv.Atoi(r.Form.Get("teacherID"))
 		availabilityID, _ := strconv.Atoi(r.Form.Get("selectedAvailability"))
-		lesson := &LessonReservation{
+		lesson := LessonReservation{
 			StudentUsername: userSession.username,
 			TeacherID:       teacherID,
 			AvailabilityID:  availabilityID,
 			Subject:         subject,
 		}
 
-		//API call at http://localhost:8080/api/student/addstudent
-		payload, err := json.Marshal(lesson)
-		if err != nil {
-			return
-		}
-		url := "http://localhost:8080/api/student/" + userSession.username + "/bookings"
-		resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
-		if err != nil {
-			return
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusCreated {
-			http.Redirect(w, r, "/booklesson", http.StatusSeeOther)
+		if err := apiFor(userSession).CreateBooking(r.Context(), lesson); err != nil {
+			renderBookingsPage(w, r, userSession, apiErrorMessage(err, "The lesson couldn't be booked"))
 		} else {
 			http.Redirect(w, r, "/bookings", http.StatusSeeOther)
 		}
 	}
 }
 
-func getBookings(username string) ([]LessonBooked, error) {
-	//construct the API endpoint URL
-	apiURL := "http://localhost:8080/api/student/" + username + "/bookings"
-	//make a GET request to the API endpoint
-	response, err := http.Get(apiURL)
-	if err != nil {
-		return nil, err
+// teacherFilter is the filter form of the page booking a lesson, as entered by the student.
+type teacherFilter struct {
+	Subject string
+	Name    string
+	// From and To are datetime-local values, like 2024-05-01T14:00
+	From string
+	To   string
+}
+
+// isSet reports whether the student filtered the teachers.
+func (f teacherFilter) isSet() bool {
+	return f.Subject != "" || f.Name != "" || f.From != "" || f.To != ""
+}
+
+// search returns the search of the filter with the times in loc, or the message to show when they are wrong.
+func (f teacherFilter) search(loc *time.Location) (TeacherSearch, string) {
+	search := TeacherSearch{Subject: f.Subject, NamePrefix: f.Name}
+	var err error
+	if f.From != "" {
+		if search.FreeFrom, err = time.ParseInLocation("2006-01-02T15:04", f.From, loc); err != nil {
+			return search, "Invalid starting time of the free slot"
+		}
 	}
-	defer response.Body.Close()
+	if f.To != "" {
+		if search.FreeTo, err = time.ParseInLocation("2006-01-02T15:04", f.To, loc); err != nil {
+			return search, "Invalid ending time of the free slot"
+		}
+	}
+	return search, ""
+}
 
-	//decode the JSON response into the list of bookings
-	var bookings []LessonBooked
-	err = json.NewDecoder(response.Body).Decode(&bookings)
+// apiFor returns the client calling the API as the user of the session.
+func apiFor(userSession Session) *apiclient.Client {
+	return webAPI.WithToken(userSession.token)
+}
+
+// loginAPI returns the client logging in the user of the request, or asking for their reset link, telling the API
+// the address of the browser so that the attempts are limited per browser.
+func loginAPI(r *http.Request) *apiclient.Client {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		return nil, err
+		ip = r.RemoteAddr
 	}
-
-	return bookings, nil
+	return webAPI.WithClientIP(ip)
 }
 
-func renderProfilePage(w http.ResponseWriter, student *Student) {
+func renderProfilePage(w http.ResponseWriter, r *http.Request, userSession Session, student Student, message string) {
 	//render the profile page
 	t, err := template.New("profile.html").Funcs(timeToDate).ParseFiles("profile.html")
 	if err != nil {
@@ -447,10 +693,20 @@ func renderProfilePage(w http.ResponseWriter, student *Student) {
 		return
 	}
 
-	t.Execute(w, student)
+	//the page is still shown without the calendar link if the API can't give it
+	feed, err := apiFor(userSession).StudentCalendarFeed(r.Context(), userSession.username)
+	if err != nil {
+		log.Println("Error fetching the calendar feed:", err)
+	}
+	t.Execute(w, struct {
+		Student
+		CalendarURL string
+		CSRFToken   string
+		Message     string
+	}{Student: student, CalendarURL: feed.URL, CSRFToken: userSession.csrfToken, Message: message})
 }
 
-func renderLoginPage(w http.ResponseWriter, errorMessage string) {
+func renderLoginPage(w http.ResponseWriter, r *http.Request, errorMessage string) {
 	//render the login page with an error message
 	t, err := template.New("login.html").Funcs(timeToDate).ParseFiles("login.html")
 	if err != nil {
@@ -459,39 +715,59 @@ func renderLoginPage(w http.ResponseWriter, errorMessage string) {
 		return
 	}
 
-	t.Execute(w, &Page{Title: "Login page", Body: errorMessage})
+	t.Execute(w, &Page{Title: "Login page", Body: errorMessage, CSRFToken: formCSRFToken(w, r)})
 }
 
 var timeToDate = template.FuncMap{
+	//the times come from the API already in the time zone of the user
 	"datetoFormat": func(layout string, date time.Time) string {
 		return date.Format(layout)
 	},
-	"stringToFormat": func(date string) string {
-		//transform the string to time.Time
-		splittedDate := strings.Split(date, "-")
-		year, _ := strconv.Atoi(splittedDate[0])
-		month, _ := strconv.Atoi(splittedDate[1])
-		day, _ := strconv.Atoi(strings.Split(splittedDate[2], "T")[0])
-		t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.Local)
-		return t.Format("Monday, 2 January 2006")
-	},
 }
 
 func main() {
 	var wg sync.WaitGroup
-	wg.Add(3)
 	if os.Args[1] == "-m" && len(os.Args) >= 3 {
-		if os.Args[2] == "server" {
-			go func() {
-				defer wg.Done()
+		if os.Args[2] == "migrate" {
+			migrateCommand(os.Args[3:])
+			return
+		} else if os.Args[2] == "backup" {
+			backupCommand(os.Args[3:])
+			return
+		} else if os.Args[2] == "restore" {
+			restoreCommand(os.Args[3:])
+			return
+		} else if os.Args[2] == "server" {
+			var store Store
+			if len(os.Args) >= 4 && os.Args[3] == "-memory" {
+				store = newMemoryStore()
+			} else {
 				initializeDatabase()
-			}()
+				sqliteStore, err := newSQLiteStore(databasePath)
+				if err != nil {
+					log.Fatal(err)
+				}
+				store = sqliteStore
+			}
+			defer store.Close()
 			gin.SetMode(gin.ReleaseMode)
+			//Ctrl+C or SIGTERM stop the server and the scheduler, letting the requests and the jobs in progress finish
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			notifier := newNotifierFromEnv()
+			jobs := newScheduler(schedulerIntervalFromEnv(), store, lessonRemindersJob(store, notifier), completeBookingsJob(store))
+			jobs.start(ctx)
+			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				routingAPI()
+				routingAPI(ctx, store, notifier)
+				jobs.wait()
 			}()
 		} else if os.Args[2] == "cli" {
+			//a subcommand like "teacher list" runs alone, without the menu
+			if len(os.Args) >= 4 && os.Args[3] != "-test" {
+				os.Exit(runCLICommand(os.Args[3:]))
+			}
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
@@ -502,10 +778,21 @@ func main() {
 				}
 			}()
 		} else {
+			sessions, err := newSessionStore(len(os.Args) >= 4 && os.Args[3] == "-memory")
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer sessions.Close()
+			sessionTTL = durationFromEnv("GOTUTOR_SESSION_TTL", defaultSessionTTL)
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			jobs := newScheduler(schedulerIntervalFromEnv(), nil, purgeSessionsJob(sessions))
+			jobs.start(ctx)
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				server()
+				server(ctx, sessions)
+				jobs.wait()
 			}()
 		}
 	}
@@ -4,15 +4,38 @@ import (
 	"time"
 
 	"github.com/astaxie/session"
+
+	"server/apiclient"
 )
 
 var globalSessions *session.Manager
-var sessions_new = map[string]Session{}
 
-//each session contains the username of the user and the time at which it expires
+// webSessions keeps the sessions of the users logged into the web server
+var webSessions SessionStore
+
+// webAPI is the client of the API used by the web server, before a user token is added
+var webAPI *apiclient.Client
+
+// roles of the users that can log into the web server
+const (
+	roleStudent = "student"
+	roleTeacher = "teacher"
+	roleAdmin   = "admin"
+)
+
+//each session contains the username of the user, their role, the API token issued at login
+//with its expiry, the token of its forms and the time at which the session expires
+//teacherID is only set for the sessions of the teachers
+//timeZone is the preference of the user, used to read the dates and times they enter
 type Session struct {
-	username string
-	expiry   time.Time
+	username    string
+	role        string
+	teacherID   int
+	token       string
+	tokenExpiry time.Time
+	csrfToken   string
+	timeZone    string
+	expiry      time.Time
 }
 
 //function to find out if the session has expired
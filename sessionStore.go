@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// defaultSessionTTL is how long a web session stays valid without requests
+const defaultSessionTTL = 30 * time.Minute
+
+// sessionTTL is the lifetime of the web sessions, set with GOTUTOR_SESSION_TTL
+var sessionTTL = defaultSessionTTL
+
+// SessionStore keeps the sessions of the web server, identified by the token of their cookie.
+// The stores never remove the expired sessions by themselves: the web server does it with its
+// purge_sessions job, and any other program using a store needs to call DeleteExpiredSessions.
+type SessionStore interface {
+	// Session returns the session of the token, and false if there is none.
+	// Expired sessions may still be returned until they are purged.
+	Session(token string) (Session, bool, error)
+	// SaveSession creates the session of the token or replaces it.
+	SaveSession(token string, userSession Session) error
+	DeleteSession(token string) error
+	// DeleteExpiredSessions removes the sessions expired before now and returns how many there were.
+	DeleteExpiredSessions(now time.Time) (int, error)
+	Close() error
+}
+
+// newSessionStore returns the in-memory store with inMemory, and the one saved in the database otherwise.
+func newSessionStore(inMemory bool) (SessionStore, error) {
+	if inMemory {
+		return newMemorySessionStore(), nil
+	}
+	initializeDatabase()
+	return newSQLiteSessionStore(databasePath)
+}
+
+// slidingExpiry is the new expiry of a session used now: every request keeps it alive for
+// sessionTTL more, but never past the API token it holds.
+func slidingExpiry(userSession Session, now time.Time) time.Time {
+	expiry := now.Add(sessionTTL)
+	if !userSession.tokenExpiry.IsZero() && userSession.tokenExpiry.Before(expiry) {
+		return userSession.tokenExpiry
+	}
+	return expiry
+}
+
+// hashSessionToken is how the session tokens are kept by the stores, so that reading
+// the store isn't enough to take over the sessions.
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// memorySessionStore is the SessionStore keeping the sessions in memory: they are lost when the
+// web server stops.
+type memorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+// newMemorySessionStore returns an empty in-memory session store.
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{sessions: map[string]Session{}}
+}
+
+func (s *memorySessionStore) Session(token string) (Session, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	userSession, exists := s.sessions[hashSessionToken(token)]
+	return userSession, exists, nil
+}
+
+func (s *memorySessionStore) SaveSession(token string, userSession Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[hashSessionToken(token)] = userSession
+	return nil
+}
+
+func (s *memorySessionStore) DeleteSession(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, hashSessionToken(token))
+	return nil
+}
+
+func (s *memorySessionStore) DeleteExpiredSessions(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := 0
+	for key, userSession := range s.sessions {
+		if userSession.expiry.Before(now) {
+			delete(s.sessions, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *memorySessionStore) Close() error {
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPurgeSessionsJobRemovesTheExpiredSessions(t *testing.T) {
+	store := newMemorySessionStore()
+	defer store.Close()
+	if err := store.SaveSession("expired", Session{username: "alice", expiry: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSession("valid", Session{username: "bob", expiry: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := purgeSessionsJob(store).run(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists, _ := store.Session("expired"); exists {
+		t.Error("the expired session was not purged")
+	}
+	if _, exists, _ := store.Session("valid"); !exists {
+		t.Error("the valid session was purged")
+	}
+}
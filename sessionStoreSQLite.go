@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+// sqliteSessionStore is the SessionStore saving the sessions in the web_sessions table of the
+// SQLite database, so that they survive a restart of the web server.
+// The API tokens of the sessions are encrypted with a key derived from the session token, which is only
+// saved hashed: reading the database is neither enough to take over a session nor to call the API.
+type sqliteSessionStore struct {
+	db *sql.DB
+}
+
+// newSQLiteSessionStore opens the SQLite database in the given file and returns a SessionStore using it.
+func newSQLiteSessionStore(path string) (*sqliteSessionStore, error) {
+	db, err := openDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteSessionStore{db: db}, nil
+}
+
+func (s *sqliteSessionStore) Session(token string) (Session, bool, error) {
+	var userSession Session
+	var sealedAPIToken string
+	row := s.db.QueryRow(`
+		SELECT Username, Role, TeacherID, APIToken, APITokenExpiresAt, CSRFToken, TimeZone, ExpiresAt
+		FROM web_sessions WHERE Token = ?`, hashSessionToken(token))
+	err := row.Scan(&userSession.username, &userSession.role, &userSession.teacherID, &sealedAPIToken,
+		&userSession.tokenExpiry, &userSession.csrfToken, &userSession.timeZone, &userSession.expiry)
+	if err == sql.ErrNoRows {
+		return Session{}, false, nil
+	} else if err != nil {
+		return Session{}, false, err
+	}
+	userSession.token, err = openAPIToken(token, sealedAPIToken)
+	if err != nil {
+		//a token that can't be decrypted is of no use: the user logs in again
+		return Session{}, false, nil
+	}
+	return userSession, true, nil
+}
+
+func (s *sqliteSessionStore) SaveSession(token string, userSession Session) error {
+	sealedAPIToken, err := sealAPIToken(token, userSession.token)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO web_sessions (Token, Username, Role, TeacherID, APIToken, APITokenExpiresAt, CSRFToken, TimeZone, ExpiresAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (Token) DO UPDATE SET Username = excluded.Username, Role = excluded.Role,
+			TeacherID = excluded.TeacherID, APIToken = excluded.APIToken, APITokenExpiresAt = excluded.APITokenExpiresAt,
+			CSRFToken = excluded.CSRFToken, TimeZone = excluded.TimeZone, ExpiresAt = excluded.ExpiresAt`,
+		hashSessionToken(token), userSession.username, userSession.role, userSession.teacherID, sealedAPIToken,
+		userSession.tokenExpiry.UTC(), userSession.csrfToken, userSession.timeZone, userSession.expiry.UTC())
+	return err
+}
+
+func (s *sqliteSessionStore) DeleteSession(token string) error {
+	_, err := s.db.Exec("DELETE FROM web_sessions WHERE Token = ?", hashSessionToken(token))
+	return err
+}
+
+func (s *sqliteSessionStore) DeleteExpiredSessions(now time.Time) (int, error) {
+	result, err := s.db.Exec("DELETE FROM web_sessions WHERE julianday(ExpiresAt) < julianday(?)", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+func (s *sqliteSessionStore) Close() error {
+	return s.db.Close()
+}
+
+// apiTokenCipher returns the AES-GCM cipher of the API token of the session, keyed by the session token.
+func apiTokenCipher(sessionToken string) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, []byte(sessionToken))
+	mac.Write([]byte("gotutor web session API token"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealAPIToken encrypts the API token of the session, with a random nonce in front.
+func sealAPIToken(sessionToken, apiToken string) (string, error) {
+	aead, err := apiTokenCipher(sessionToken)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(apiToken), nil)), nil
+}
+
+// openAPIToken decrypts the API token sealed by sealAPIToken with the same session token.
+func openAPIToken(sessionToken, sealed string) (string, error) {
+	aead, err := apiTokenCipher(sessionToken)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("Sealed API token too short")
+	}
+	apiToken, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(apiToken), nil
+}
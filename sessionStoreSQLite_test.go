@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLiteSessionStoreEncryptsTheAPIToken(t *testing.T) {
+	store, err := newSQLiteSessionStore(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := migrateUp(store.db); err != nil {
+		t.Fatal(err)
+	}
+
+	expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	saved := Session{username: "alice", role: roleStudent, token: "api.token.of.alice", tokenExpiry: expiry, expiry: expiry}
+	if err := store.SaveSession("session-token", saved); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored string
+	if err := store.db.QueryRow("SELECT APIToken FROM web_sessions").Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored, saved.token) {
+		t.Fatalf("the API token is saved in clear: %q", stored)
+	}
+
+	userSession, exists, err := store.Session("session-token")
+	if err != nil || !exists {
+		t.Fatalf("got session %v, %v", exists, err)
+	}
+	if userSession.token != saved.token || userSession.username != "alice" {
+		t.Fatalf("got session %+v", userSession)
+	}
+	//the hash saved as the key of the session doesn't decrypt the token
+	if _, err := openAPIToken(hashSessionToken("session-token"), stored); err == nil {
+		t.Error("the API token was decrypted without the session token")
+	}
+}
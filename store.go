@@ -0,0 +1,190 @@
+package main
+
+import "time"
+
+// Store groups all the data access needed by the API handlers.
+// The handlers receive a Store when the router is built, so they never
+// touch the database directly.
+type Store interface {
+	TeacherStore
+	StudentStore
+	AvailabilityStore
+	AvailabilityRuleStore
+	DurationPolicyStore
+	BookingStore
+	WaitlistStore
+	ImportStore
+	ExportStore
+	CalendarFeedStore
+	SchedulerStore
+	SubjectStore
+	AdminStore
+	PasswordResetStore
+	LoginFailureStore
+	Close() error
+}
+
+// TeacherStore manages the teachers.
+type TeacherStore interface {
+	AllTeachers() ([]Teacher, error)
+	TeacherIDByFullName(name, surname string) (int, error)
+	TeacherExists(teacherID int) (bool, error)
+	// TeacherByID and TeacherByUsername return the teacher with the hashed password. The teachers are
+	// returned with their subjects, and InsertTeacher saves them too.
+	TeacherByID(teacherID int) (Teacher, error)
+	TeacherByUsername(username string) (Teacher, error)
+	InsertTeacher(teacher Teacher) error
+	UpdateTeacherTimeZone(teacherID int, timeZone string) error
+}
+
+// StudentStore manages the students.
+type StudentStore interface {
+	AllStudents() ([]Student, error)
+	StudentByUsername(username string) (Student, error)
+	InsertStudent(student Student) error
+	UpdateStudentTimeZone(username, timeZone string) error
+	// UpdateStudentProfile saves the name, the surname, the date of birth, the time zone and the email of the student
+	UpdateStudentProfile(student Student) error
+	// UpdateStudentPassword replaces the password of the student, hashing the new one
+	UpdateStudentPassword(username, password string) error
+	// DeleteStudent deletes the student with their bookings, their waitlist entries, their calendar feed and their
+	// password resets.
+	// The lessons still booked starting after from are returned, and their availabilities freed.
+	DeleteStudent(username string, from time.Time) ([]LessonReservation, error)
+}
+
+// AvailabilityStore manages the availabilities of the teachers.
+type AvailabilityStore interface {
+	TeacherAvailabilities(teacherID int) ([]Availability, error)
+	// DeletedTeacherAvailabilities returns the availabilities the teacher deleted, with their last sequence
+	DeletedTeacherAvailabilities(teacherID int) ([]Availability, error)
+	TeacherBookedAvailabilities(teacherID int) ([]TeacherLesson, error)
+	InsertAvailability(availability Availability, teacherID int) error
+	DeleteAvailability(teacherID, availabilityID int) error
+}
+
+// AvailabilityRuleStore manages the weekly recurrence rules of the teachers.
+type AvailabilityRuleStore interface {
+	// InsertAvailabilityRule saves the rule and creates its availabilities, skipping the overlapping ones
+	InsertAvailabilityRule(rule AvailabilityRule) (AvailabilityRuleExpansion, error)
+	TeacherAvailabilityRules(teacherID int) ([]AvailabilityRule, error)
+	// CancelAvailabilityRule cancels the rule and deletes its unbooked availabilities starting from the given time
+	CancelAvailabilityRule(teacherID, ruleID int, from time.Time) (int, error)
+}
+
+// DurationPolicyStore manages the lesson durations allowed by the teachers.
+type DurationPolicyStore interface {
+	// TeacherDurationPolicies returns the policies saved by the teacher, without the defaults
+	TeacherDurationPolicies(teacherID int) ([]DurationPolicy, error)
+	// SaveDurationPolicy inserts or replaces the policy of the teacher for its subject
+	SaveDurationPolicy(policy DurationPolicy) error
+	DeleteDurationPolicy(teacherID int, subject string) error
+}
+
+// BookingStore manages the lessons booked by the students.
+type BookingStore interface {
+	BookingByID(id string) (LessonReservation, error)
+	StudentBookings(username string) ([]LessonBooked, error)
+	// InsertBooking books the availability and returns the ID of the booking
+	InsertBooking(booking LessonReservation) (int, error)
+	// CancelBooking sets the cancelled status of a booked lesson, records the cancellation and frees
+	// the availability. It returns ErrBookingClosed if the booking is no longer booked.
+	CancelBooking(id string, status string, cancellation BookingCancellation) error
+	// UpdateBookingStatus marks a booked lesson as completed or as a no-show
+	UpdateBookingStatus(id string, status string) error
+	// BookingsStartingBetween returns the lessons still booked starting from from, included, to to, excluded
+	BookingsStartingBetween(from, to time.Time) ([]LessonReservation, error)
+	// CompleteBookingsEndedBefore marks as completed the lessons still booked that ended before the given time,
+	// and returns how many there were
+	CompleteBookingsEndedBefore(before time.Time) (int, error)
+}
+
+// ImportStore inserts many rows at once, all of them or none.
+// Each row goes through the same checks as its single insert, and the error of every row that
+// fails is returned by its index. Nothing is saved when a row fails, nor with dryRun.
+type ImportStore interface {
+	ImportTeachers(teachers []Teacher, dryRun bool) (map[int]error, error)
+	ImportStudents(students []Student, dryRun bool) (map[int]error, error)
+	ImportAvailabilities(availabilities []ImportedAvailability, dryRun bool) (map[int]error, error)
+}
+
+// ExportStore reads all the data at once, for the exports.
+type ExportStore interface {
+	// ExportData returns a consistent copy of the teachers, the students, the availabilities and
+	// the bookings, without the passwords
+	ExportData() (DataExport, error)
+}
+
+// CalendarFeedStore manages the secret tokens of the calendar feeds of the students and the teachers.
+type CalendarFeedStore interface {
+	// CalendarFeed returns the feed of the student or of the teacher of the given feed, saving the given
+	// one when they have none yet
+	CalendarFeed(feed CalendarFeed) (CalendarFeed, error)
+	// ReplaceCalendarFeed saves the feed in place of the one of its owner, whose token stops working
+	ReplaceCalendarFeed(feed CalendarFeed) error
+	// CalendarFeedByToken returns the feed with the token, ErrCalendarFeedNotFound if there is none
+	CalendarFeedByToken(token string) (CalendarFeed, error)
+}
+
+// WaitlistStore manages the students waiting for a lesson with a booked teacher.
+type WaitlistStore interface {
+	// InsertWaitlistEntry adds the student to the waitlist and returns the entry with its ID
+	InsertWaitlistEntry(entry WaitlistEntry) (WaitlistEntry, error)
+	StudentWaitlist(username string) ([]WaitlistEntry, error)
+	// TeacherWaitlist returns the entries still waiting for a lesson with the teacher, first come first
+	TeacherWaitlist(teacherID int) ([]WaitlistEntry, error)
+	// DeleteWaitlistEntry removes an entry of the student that is still waiting
+	DeleteWaitlistEntry(username string, entryID int) error
+	// AssignFreedAvailability books a free availability for the first entry of the waitlist that can take it
+	// and returns that entry, or nil when no one is waiting for it
+	AssignFreedAvailability(availabilityID int) (*WaitlistEntry, error)
+}
+
+// SchedulerStore keeps the state of the jobs of the scheduler, so that after a restart they go on
+// from where they stopped.
+type SchedulerStore interface {
+	// JobRun returns the last run of the job, a zero JobRun when it never ran
+	JobRun(name string) (JobRun, error)
+	SaveJobRun(run JobRun) error
+	// ClaimLessonReminder records that the reminder of the booking is sent, and returns false when it
+	// already was
+	ClaimLessonReminder(bookingID int, reminder string, sentAt time.Time) (bool, error)
+}
+
+// SubjectStore manages the subjects and the teachers teaching them.
+type SubjectStore interface {
+	AllSubjects() ([]Subject, error)
+	// SetTeacherSubjects replaces the subjects of the teacher, creating the ones that don't exist yet,
+	// and returns their names as saved: an existing subject keeps its spelling
+	SetTeacherSubjects(teacherID int, subjects []string) ([]string, error)
+	// SearchTeachers returns the teachers matching the search, without the passwords, by surname and name
+	SearchTeachers(search TeacherSearch) ([]Teacher, error)
+}
+
+// AdminStore manages the administrator accounts.
+type AdminStore interface {
+	// AllAdmins returns the administrators without their passwords, by username
+	AllAdmins() ([]Admin, error)
+	// AdminByUsername returns the administrator with the hashed password, or ErrAdminNotFound
+	AdminByUsername(username string) (Admin, error)
+	// InsertAdmin saves the administrator, hashing the password
+	InsertAdmin(admin Admin) error
+}
+
+// PasswordResetStore manages the password resets of the students. Only the hashes of their tokens are saved.
+type PasswordResetStore interface {
+	// InsertPasswordReset saves the reset, ErrStudentNotFound if its student doesn't exist
+	InsertPasswordReset(reset PasswordReset) error
+	// ResetPassword replaces the password of the student of the reset with the token hash, hashing the new one,
+	// and uses up every reset of the student. It returns the username of the student, or ErrPasswordResetInvalid
+	// if the reset doesn't exist, was used or is expired at the given time.
+	ResetPassword(tokenHash, password string, at time.Time) (string, error)
+}
+
+// LoginFailureStore keeps the refused logins for the administrators to review.
+type LoginFailureStore interface {
+	InsertLoginFailure(failure LoginFailure) error
+	// LoginFailures returns the latest failures first, at most limit of them,
+	// only the ones of the username unless it is empty
+	LoginFailures(username string, limit int) ([]LoginFailure, error)
+}
@@ -0,0 +1,1404 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStore is a Store that keeps all the data in memory.
+// It follows the same rules as the SQLite store and is meant for tests
+// and for running the API without a database file.
+type memoryStore struct {
+	mu sync.Mutex
+
+	teachers       map[int]Teacher
+	students       map[string]Student
+	availabilities map[int]memoryAvailability
+	// deletedAvailabilities are the deleted availabilities by ID, for the calendar feeds
+	deletedAvailabilities map[int]memoryAvailability
+	rules                 map[int]AvailabilityRule
+	policies              map[memoryPolicyKey]DurationPolicy
+	bookings              map[int]LessonReservation
+	waitlist              map[int]WaitlistEntry
+	// calendarFeeds are the feeds by token
+	calendarFeeds map[string]CalendarFeed
+	jobRuns       map[string]JobRun
+	reminders     map[memoryReminderKey]time.Time
+	// subjects are the subjects by ID, the teachers keep the names of theirs
+	subjects map[int]Subject
+	admins   map[string]Admin
+	// passwordResets are the resets by token hash
+	passwordResets map[string]PasswordReset
+	// loginFailures are the refused logins, the oldest first
+	loginFailures []LoginFailure
+
+	nextTeacherID      int
+	nextAvailabilityID int
+	nextRuleID         int
+	nextBookingID      int
+	nextWaitlistID     int
+	nextSubjectID      int
+	nextLoginFailureID int
+}
+
+// memoryAvailability is an availability together with the teacher it belongs to.
+type memoryAvailability struct {
+	Availability
+	TeacherID int
+}
+
+// memoryPolicyKey identifies the duration policy of a teacher for a subject.
+type memoryPolicyKey struct {
+	TeacherID int
+	Subject   string
+}
+
+// memoryReminderKey identifies a reminder of a booking.
+type memoryReminderKey struct {
+	BookingID int
+	Reminder  string
+}
+
+// newMemoryStore returns an empty in-memory Store.
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		teachers:              map[int]Teacher{},
+		students:              map[string]Student{},
+		availabilities:        map[int]memoryAvailability{},
+		deletedAvailabilities: map[int]memoryAvailability{},
+		rules:                 map[int]AvailabilityRule{},
+		policies:              map[memoryPolicyKey]DurationPolicy{},
+		bookings:              map[int]LessonReservation{},
+		waitlist:              map[int]WaitlistEntry{},
+		calendarFeeds:         map[string]CalendarFeed{},
+		jobRuns:               map[string]JobRun{},
+		reminders:             map[memoryReminderKey]time.Time{},
+		subjects:              map[int]Subject{},
+		admins:                map[string]Admin{},
+		passwordResets:        map[string]PasswordReset{},
+		nextTeacherID:         1,
+		nextAvailabilityID:    1,
+		nextRuleID:            1,
+		nextBookingID:         1,
+		nextWaitlistID:        1,
+		nextSubjectID:         1,
+		nextLoginFailureID:    1,
+	}
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// Teachers
+
+func (s *memoryStore) AllTeachers() ([]Teacher, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var teachers []Teacher
+	for _, id := range sortedKeys(s.teachers) {
+		teacher := s.teachers[id]
+		teacher.Password = ""
+		teachers = append(teachers, teacher)
+	}
+	return teachers, nil
+}
+
+func (s *memoryStore) TeacherIDByFullName(name, surname string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range sortedKeys(s.teachers) {
+		teacher := s.teachers[id]
+		if teacher.Name == name && teacher.Surname == surname {
+			return teacher.ID, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (s *memoryStore) TeacherExists(teacherID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, exists := s.teachers[teacherID]
+	return exists, nil
+}
+
+func (s *memoryStore) TeacherByID(teacherID int) (Teacher, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	teacher, exists := s.teachers[teacherID]
+	if !exists {
+		return Teacher{}, &ErrTeacherNotFound{TeacherID: teacherID}
+	}
+	return teacher, nil
+}
+
+func (s *memoryStore) TeacherByUsername(username string) (Teacher, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, teacher := range s.teachers {
+		if username != "" && teacher.Username == username {
+			return teacher, nil
+		}
+	}
+	return Teacher{}, &ErrTeacherNotFound{Username: username}
+}
+
+func (s *memoryStore) InsertTeacher(teacher Teacher) error {
+	teacher, err := withHashedTeacherPassword(teacher)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insertTeacher(teacher)
+}
+
+// withHashedTeacherPassword hashes the password of a teacher with an account, and drops it otherwise.
+func withHashedTeacherPassword(teacher Teacher) (Teacher, error) {
+	if teacher.Username == "" {
+		teacher.Password = ""
+		return teacher, nil
+	}
+	if teacher.Password == "" {
+		return teacher, ErrTeacherPasswordRequired
+	}
+	hashedPassword, err := hashPassword(teacher.Password)
+	if err != nil {
+		return teacher, err
+	}
+	teacher.Password = hashedPassword
+	return teacher, nil
+}
+
+// insertTeacher inserts the teacher, whose password is already hashed. The caller holds the lock.
+func (s *memoryStore) insertTeacher(teacher Teacher) error {
+	for _, other := range s.teachers {
+		if teacher.Username != "" && other.Username == teacher.Username {
+			return ErrUsernameTaken
+		}
+	}
+	teacher.ID = s.nextTeacherID
+	teacher.TimeZone = timeZoneOrUTC(teacher.TimeZone)
+	teacher.Subjects = s.subjectNames(teacher.Subjects)
+	s.nextTeacherID++
+	s.teachers[teacher.ID] = teacher
+	return nil
+}
+
+func (s *memoryStore) UpdateTeacherTimeZone(teacherID int, timeZone string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	teacher, exists := s.teachers[teacherID]
+	if !exists {
+		return &ErrTeacherNotFound{TeacherID: teacherID}
+	}
+	teacher.TimeZone = timeZone
+	s.teachers[teacherID] = teacher
+	return nil
+}
+
+// Students
+
+func (s *memoryStore) AllStudents() ([]Student, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usernames := make([]string, 0, len(s.students))
+	for username := range s.students {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	var students []Student
+	for _, username := range usernames {
+		students = append(students, s.students[username])
+	}
+	return students, nil
+}
+
+func (s *memoryStore) StudentByUsername(username string) (Student, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	student, exists := s.students[username]
+	if !exists {
+		return Student{}, &ErrStudentNotFound{StudentID: username}
+	}
+	return student, nil
+}
+
+func (s *memoryStore) InsertStudent(student Student) error {
+	if err := validatePassword(student.Password); err != nil {
+		return err
+	}
+	hashedPassword, err := hashPassword(student.Password)
+	if err != nil {
+		return err
+	}
+	student.Password = hashedPassword
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insertStudent(student)
+}
+
+// insertStudent inserts the student, whose password is already hashed. The caller holds the lock.
+func (s *memoryStore) insertStudent(student Student) error {
+	if _, exists := s.students[student.Username]; exists {
+		return ErrUsernameTaken
+	}
+	student.TimeZone = timeZoneOrUTC(student.TimeZone)
+	student.PasswordChangedAt = time.Now()
+	s.students[student.Username] = student
+	return nil
+}
+
+func (s *memoryStore) UpdateStudentTimeZone(username, timeZone string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	student, exists := s.students[username]
+	if !exists {
+		return &ErrStudentNotFound{StudentID: username}
+	}
+	student.TimeZone = timeZone
+	s.students[username] = student
+	return nil
+}
+
+func (s *memoryStore) UpdateStudentProfile(student Student) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved, exists := s.students[student.Username]
+	if !exists {
+		return &ErrStudentNotFound{StudentID: student.Username}
+	}
+	saved.Name, saved.Surname, saved.DateOfBirth = student.Name, student.Surname, student.DateOfBirth
+	saved.TimeZone, saved.Email = timeZoneOrUTC(student.TimeZone), student.Email
+	s.students[student.Username] = saved
+	return nil
+}
+
+func (s *memoryStore) UpdateStudentPassword(username, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	student, exists := s.students[username]
+	if !exists {
+		return &ErrStudentNotFound{StudentID: username}
+	}
+	student.Password = hashedPassword
+	student.PasswordChangedAt = time.Now()
+	s.students[username] = student
+	return nil
+}
+
+func (s *memoryStore) DeleteStudent(username string, from time.Time) ([]LessonReservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.students[username]; !exists {
+		return nil, &ErrStudentNotFound{StudentID: username}
+	}
+
+	var freed []LessonReservation
+	for _, id := range sortedKeys(s.bookings) {
+		booking := s.bookings[id]
+		if booking.StudentUsername != username {
+			continue
+		}
+		if booking.Status == bookingBooked && booking.StartsAt.After(from) {
+			availability := s.availabilities[booking.AvailabilityID]
+			availability.Booked = false
+			availability.Sequence++
+			s.availabilities[availability.ID] = availability
+			freed = append(freed, booking)
+		}
+		for key := range s.reminders {
+			if key.BookingID == id {
+				delete(s.reminders, key)
+			}
+		}
+		delete(s.bookings, id)
+	}
+	sort.SliceStable(freed, func(i, j int) bool {
+		return freed[i].StartsAt.Before(freed[j].StartsAt)
+	})
+
+	for id, entry := range s.waitlist {
+		if entry.StudentUsername == username {
+			delete(s.waitlist, id)
+		}
+	}
+	for token, feed := range s.calendarFeeds {
+		if feed.StudentUsername == username {
+			delete(s.calendarFeeds, token)
+		}
+	}
+	for tokenHash, reset := range s.passwordResets {
+		if reset.StudentUsername == username {
+			delete(s.passwordResets, tokenHash)
+		}
+	}
+	delete(s.students, username)
+	return freed, nil
+}
+
+// Availabilities
+
+func (s *memoryStore) TeacherAvailabilities(teacherID int) ([]Availability, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.teachers[teacherID]; !exists {
+		return nil, &ErrTeacherNotFound{TeacherID: teacherID}
+	}
+
+	var availabilities []Availability
+	for _, id := range sortedKeys(s.availabilities) {
+		availability := s.availabilities[id]
+		if availability.TeacherID == teacherID {
+			availabilities = append(availabilities, availability.Availability)
+		}
+	}
+	sort.SliceStable(availabilities, func(i, j int) bool {
+		return availabilities[i].StartsAt.Before(availabilities[j].StartsAt)
+	})
+	return availabilities, nil
+}
+
+func (s *memoryStore) DeletedTeacherAvailabilities(teacherID int) ([]Availability, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var availabilities []Availability
+	for _, id := range sortedKeys(s.deletedAvailabilities) {
+		availability := s.deletedAvailabilities[id]
+		if availability.TeacherID == teacherID {
+			availabilities = append(availabilities, availability.Availability)
+		}
+	}
+	sort.SliceStable(availabilities, func(i, j int) bool {
+		return availabilities[i].StartsAt.Before(availabilities[j].StartsAt)
+	})
+	return availabilities, nil
+}
+
+// deleteAvailability deletes the availability, keeping it aside with its deletion counted.
+func (s *memoryStore) deleteAvailability(availability memoryAvailability) {
+	delete(s.availabilities, availability.ID)
+	availability.Sequence++
+	s.deletedAvailabilities[availability.ID] = availability
+}
+
+func (s *memoryStore) TeacherBookedAvailabilities(teacherID int) ([]TeacherLesson, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.teachers[teacherID]; !exists {
+		return nil, &ErrTeacherNotFound{TeacherID: teacherID}
+	}
+
+	var lessons []TeacherLesson
+	for _, id := range sortedKeys(s.bookings) {
+		booking := s.bookings[id]
+		if booking.TeacherID != teacherID || isCancelled(booking.Status) {
+			continue
+		}
+		student := s.students[booking.StudentUsername]
+		lessons = append(lessons, TeacherLesson{
+			Availability:    s.availabilities[booking.AvailabilityID].Availability,
+			BookingID:       booking.ID,
+			StudentUsername: student.Username,
+			StudentName:     student.Name,
+			StudentSurname:  student.Surname,
+			Subject:         booking.Subject,
+			Status:          booking.Status,
+		})
+	}
+	sort.Slice(lessons, func(i, j int) bool {
+		return lessons[i].StartsAt.Before(lessons[j].StartsAt)
+	})
+	return lessons, nil
+}
+
+func (s *memoryStore) InsertAvailability(availability Availability, teacherID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insertAvailability(availability, teacherID)
+}
+
+// insertAvailability inserts the availability, the caller holds the lock.
+func (s *memoryStore) insertAvailability(availability Availability, teacherID int) error {
+	if _, exists := s.teachers[teacherID]; !exists {
+		return &ErrTeacherNotFound{TeacherID: teacherID}
+	}
+
+	for _, other := range s.availabilities {
+		if other.TeacherID == teacherID &&
+			isOverlapping(other.StartsAt, other.EndsAt(), availability.StartsAt, availability.EndsAt()) {
+			return ErrOverlappingAvailabilities
+		}
+	}
+
+	availability.ID = s.nextAvailabilityID
+	availability.StartsAt = availability.StartsAt.UTC()
+	s.nextAvailabilityID++
+	s.availabilities[availability.ID] = memoryAvailability{Availability: availability, TeacherID: teacherID}
+	return nil
+}
+
+func (s *memoryStore) DeleteAvailability(teacherID, availabilityID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	availability, exists := s.availabilities[availabilityID]
+	if !exists || availability.TeacherID != teacherID {
+		return ErrAvailabilityNotFound
+	}
+	if availability.Booked {
+		return ErrAvailabilityAlreadyBooked
+	}
+	s.deleteAvailability(availability)
+
+	// No one can wait for a deleted availability any longer
+	for id, entry := range s.waitlist {
+		if entry.AvailabilityID == availabilityID && entry.Status == waitlistWaiting {
+			delete(s.waitlist, id)
+		}
+	}
+	return nil
+}
+
+// Availability rules
+
+func (s *memoryStore) InsertAvailabilityRule(rule AvailabilityRule) (AvailabilityRuleExpansion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.teachers[rule.TeacherID]; !exists {
+		return AvailabilityRuleExpansion{}, &ErrTeacherNotFound{TeacherID: rule.TeacherID}
+	}
+
+	rule.ID = s.nextRuleID
+	slots, err := expandAvailabilityRule(rule)
+	if err != nil {
+		return AvailabilityRuleExpansion{}, err
+	}
+	s.nextRuleID++
+	s.rules[rule.ID] = rule
+
+	expansion := AvailabilityRuleExpansion{Rule: rule, Slots: []Availability{}, Conflicts: []Availability{}}
+	for _, slot := range slots {
+		if err := s.insertAvailability(slot, rule.TeacherID); err == ErrOverlappingAvailabilities {
+			expansion.Conflicts = append(expansion.Conflicts, slot)
+		} else {
+			expansion.Slots = append(expansion.Slots, slot)
+		}
+	}
+	return expansion, nil
+}
+
+func (s *memoryStore) TeacherAvailabilityRules(teacherID int) ([]AvailabilityRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.teachers[teacherID]; !exists {
+		return nil, &ErrTeacherNotFound{TeacherID: teacherID}
+	}
+
+	var rules []AvailabilityRule
+	for _, id := range sortedKeys(s.rules) {
+		if s.rules[id].TeacherID == teacherID {
+			rules = append(rules, s.rules[id])
+		}
+	}
+	return rules, nil
+}
+
+func (s *memoryStore) CancelAvailabilityRule(teacherID, ruleID int, from time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule, exists := s.rules[ruleID]
+	if !exists || rule.TeacherID != teacherID {
+		return 0, ErrAvailabilityRuleNotFound
+	}
+	rule.Cancelled = true
+	s.rules[ruleID] = rule
+
+	deleted := 0
+	for _, availability := range s.availabilities {
+		if availability.RuleID == ruleID && !availability.Booked && !availability.StartsAt.Before(from) {
+			s.deleteAvailability(availability)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Duration policies
+
+func (s *memoryStore) TeacherDurationPolicies(teacherID int) ([]DurationPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.teachers[teacherID]; !exists {
+		return nil, &ErrTeacherNotFound{TeacherID: teacherID}
+	}
+
+	var policies []DurationPolicy
+	for key, policy := range s.policies {
+		if key.TeacherID == teacherID {
+			policies = append(policies, policy)
+		}
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Subject < policies[j].Subject
+	})
+	return policies, nil
+}
+
+func (s *memoryStore) SaveDurationPolicy(policy DurationPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.teachers[policy.TeacherID]; !exists {
+		return &ErrTeacherNotFound{TeacherID: policy.TeacherID}
+	}
+	s.policies[memoryPolicyKey{TeacherID: policy.TeacherID, Subject: policy.Subject}] = policy
+	return nil
+}
+
+func (s *memoryStore) DeleteDurationPolicy(teacherID int, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memoryPolicyKey{TeacherID: teacherID, Subject: subject}
+	if _, exists := s.policies[key]; !exists {
+		return ErrDurationPolicyNotFound
+	}
+	delete(s.policies, key)
+	return nil
+}
+
+// Bookings
+
+func (s *memoryStore) BookingByID(id string) (LessonReservation, error) {
+	bookingID, err := strconv.Atoi(id)
+	if err != nil {
+		return LessonReservation{}, ErrBookingNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	booking, exists := s.bookings[bookingID]
+	if !exists {
+		return LessonReservation{}, ErrBookingNotFound
+	}
+	return booking, nil
+}
+
+func (s *memoryStore) StudentBookings(username string) ([]LessonBooked, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.students[username]; !exists {
+		return nil, &ErrStudentNotFound{StudentID: username}
+	}
+
+	var bookings []LessonBooked
+	for _, id := range sortedKeys(s.bookings) {
+		booking := s.bookings[id]
+		if booking.StudentUsername != username {
+			continue
+		}
+		teacher := s.teachers[booking.TeacherID]
+		bookings = append(bookings, LessonBooked{
+			ID:                  booking.ID,
+			StartsAt:            booking.StartsAt,
+			DurationMinutes:     booking.DurationMinutes,
+			TeacherName:         teacher.Name,
+			TeacherSurname:      teacher.Surname,
+			Subject:             booking.Subject,
+			Status:              booking.Status,
+			BookingCancellation: booking.BookingCancellation,
+		})
+	}
+	sort.SliceStable(bookings, func(i, j int) bool {
+		return bookings[i].StartsAt.Before(bookings[j].StartsAt)
+	})
+	return bookings, nil
+}
+
+func (s *memoryStore) InsertBooking(booking LessonReservation) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insertBooking(booking)
+}
+
+// insertBooking runs the checks of a new booking, books its availability and returns the booking ID.
+// The caller holds the lock.
+func (s *memoryStore) insertBooking(booking LessonReservation) (int, error) {
+	if _, exists := s.students[booking.StudentUsername]; !exists {
+		return 0, &ErrStudentNotFound{StudentID: booking.StudentUsername}
+	}
+	if _, exists := s.teachers[booking.TeacherID]; !exists {
+		return 0, &ErrTeacherNotFound{TeacherID: booking.TeacherID}
+	}
+	availability, exists := s.availabilities[booking.AvailabilityID]
+	if !exists || availability.TeacherID != booking.TeacherID {
+		return 0, errors.New("Availability not related to the teacher")
+	}
+	if availability.Booked {
+		return 0, ErrAvailabilityAlreadyBooked
+	}
+	if !isSubjectAllowed(availability.Availability, booking.Subject) {
+		return 0, fmt.Errorf("This availability is reserved for %s lessons", availability.Subject)
+	}
+	subject, err := s.teacherSubject(booking.TeacherID, booking.Subject)
+	if err != nil {
+		return 0, err
+	}
+	booking.Subject = subject
+
+	// Check for overlapping times with other bookings made by the same student,
+	// the cancelled ones don't count
+	for _, other := range s.bookings {
+		if other.StudentUsername != booking.StudentUsername || other.AvailabilityID == booking.AvailabilityID || isCancelled(other.Status) {
+			continue
+		}
+		otherEnd := other.StartsAt.Add(time.Duration(other.DurationMinutes) * time.Minute)
+		if isOverlapping(other.StartsAt, otherEnd, availability.StartsAt, availability.EndsAt()) {
+			return 0, errors.New("Overlapped times with existing bookings for the same student")
+		}
+	}
+
+	availability.Booked = true
+	availability.Sequence++
+	s.availabilities[availability.ID] = availability
+
+	booking.ID = s.nextBookingID
+	booking.StartsAt = availability.StartsAt
+	booking.DurationMinutes = availability.DurationMinutes
+	booking.Status = bookingBooked
+	booking.BookingCancellation = BookingCancellation{}
+	s.nextBookingID++
+	s.bookings[booking.ID] = booking
+	return booking.ID, nil
+}
+
+func (s *memoryStore) CancelBooking(id string, status string, cancellation BookingCancellation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	booking, err := s.bookedLesson(id)
+	if err != nil {
+		return err
+	}
+	booking.Status = status
+	booking.BookingCancellation = cancellation
+	s.bookings[booking.ID] = booking
+
+	availability := s.availabilities[booking.AvailabilityID]
+	availability.Booked = false
+	availability.Sequence++
+	s.availabilities[availability.ID] = availability
+	return nil
+}
+
+func (s *memoryStore) UpdateBookingStatus(id string, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	booking, err := s.bookedLesson(id)
+	if err != nil {
+		return err
+	}
+	booking.Status = status
+	s.bookings[booking.ID] = booking
+	return nil
+}
+
+func (s *memoryStore) BookingsStartingBetween(from, to time.Time) ([]LessonReservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var bookings []LessonReservation
+	for _, id := range sortedKeys(s.bookings) {
+		booking := s.bookings[id]
+		if booking.Status == bookingBooked && !booking.StartsAt.Before(from) && booking.StartsAt.Before(to) {
+			bookings = append(bookings, booking)
+		}
+	}
+	sort.SliceStable(bookings, func(i, j int) bool {
+		return bookings[i].StartsAt.Before(bookings[j].StartsAt)
+	})
+	return bookings, nil
+}
+
+func (s *memoryStore) CompleteBookingsEndedBefore(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	completed := 0
+	for id, booking := range s.bookings {
+		if booking.Status == bookingBooked && booking.EndsAt().Before(before) {
+			booking.Status = bookingCompleted
+			s.bookings[id] = booking
+			completed++
+		}
+	}
+	return completed, nil
+}
+
+// bookedLesson returns the booking with the given ID if it is still booked. The caller holds the lock.
+func (s *memoryStore) bookedLesson(id string) (LessonReservation, error) {
+	bookingID, err := strconv.Atoi(id)
+	if err != nil {
+		return LessonReservation{}, ErrBookingNotFound
+	}
+	booking, exists := s.bookings[bookingID]
+	if !exists {
+		return LessonReservation{}, ErrBookingNotFound
+	}
+	if booking.Status != bookingBooked {
+		return LessonReservation{}, ErrBookingClosed
+	}
+	return booking, nil
+}
+
+// Waitlist
+
+func (s *memoryStore) InsertWaitlistEntry(entry WaitlistEntry) (WaitlistEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.students[entry.StudentUsername]; !exists {
+		return WaitlistEntry{}, &ErrStudentNotFound{StudentID: entry.StudentUsername}
+	}
+	if _, exists := s.teachers[entry.TeacherID]; !exists {
+		return WaitlistEntry{}, &ErrTeacherNotFound{TeacherID: entry.TeacherID}
+	}
+	subject, err := s.teacherSubject(entry.TeacherID, entry.Subject)
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+	entry.Subject = subject
+	if entry.AvailabilityID != 0 {
+		availability, exists := s.availabilities[entry.AvailabilityID]
+		if !exists || availability.TeacherID != entry.TeacherID {
+			return WaitlistEntry{}, ErrAvailabilityNotFound
+		}
+		if err := checkWaitlistAvailability(availability.Availability, entry.Subject); err != nil {
+			return WaitlistEntry{}, err
+		}
+		for _, booking := range s.bookings {
+			if booking.AvailabilityID == entry.AvailabilityID && booking.StudentUsername == entry.StudentUsername && booking.Status == bookingBooked {
+				return WaitlistEntry{}, ErrAvailabilityAlreadyBooked
+			}
+		}
+	}
+
+	// The same student can't wait twice for the same lesson
+	for _, other := range s.waitlist {
+		if other.StudentUsername != entry.StudentUsername || other.TeacherID != entry.TeacherID || other.Status != waitlistWaiting {
+			continue
+		}
+		if entry.AvailabilityID != 0 && other.AvailabilityID == entry.AvailabilityID ||
+			entry.AvailabilityID == 0 && other.AvailabilityID == 0 && other.WeekStart.Equal(*entry.WeekStart) {
+			return WaitlistEntry{}, ErrAlreadyOnWaitlist
+		}
+	}
+
+	entry.ID = s.nextWaitlistID
+	entry.Status = waitlistWaiting
+	entry.BookingID = 0
+	entry.CreatedAt = time.Now().UTC()
+	if entry.WeekStart != nil && entry.WeekEnd != nil {
+		weekStart, weekEnd := entry.WeekStart.UTC(), entry.WeekEnd.UTC()
+		entry.WeekStart, entry.WeekEnd = &weekStart, &weekEnd
+	}
+	s.nextWaitlistID++
+	s.waitlist[entry.ID] = entry
+	return entry, nil
+}
+
+func (s *memoryStore) StudentWaitlist(username string) ([]WaitlistEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.students[username]; !exists {
+		return nil, &ErrStudentNotFound{StudentID: username}
+	}
+
+	var entries []WaitlistEntry
+	for _, id := range sortedKeys(s.waitlist) {
+		if entry := s.waitlist[id]; entry.StudentUsername == username {
+			entries = append(entries, s.withWaitlistDetails(entry))
+		}
+	}
+	return entries, nil
+}
+
+func (s *memoryStore) TeacherWaitlist(teacherID int) ([]WaitlistEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.teachers[teacherID]; !exists {
+		return nil, &ErrTeacherNotFound{TeacherID: teacherID}
+	}
+
+	var entries []WaitlistEntry
+	for _, id := range sortedKeys(s.waitlist) {
+		if entry := s.waitlist[id]; entry.TeacherID == teacherID && entry.Status == waitlistWaiting {
+			entries = append(entries, s.withWaitlistDetails(entry))
+		}
+	}
+	return entries, nil
+}
+
+func (s *memoryStore) DeleteWaitlistEntry(username string, entryID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.waitlist[entryID]
+	if !exists || entry.StudentUsername != username || entry.Status != waitlistWaiting {
+		return ErrWaitlistEntryNotFound
+	}
+	delete(s.waitlist, entryID)
+	return nil
+}
+
+func (s *memoryStore) AssignFreedAvailability(availabilityID int) (*WaitlistEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	availability, exists := s.availabilities[availabilityID]
+	if !exists {
+		return nil, ErrAvailabilityNotFound
+	}
+	if availability.Booked || !availability.StartsAt.After(time.Now()) {
+		return nil, nil
+	}
+
+	for _, id := range sortedKeys(s.waitlist) {
+		entry := s.waitlist[id]
+		if entry.TeacherID != availability.TeacherID || entry.Status != waitlistWaiting {
+			continue
+		}
+		if entry.AvailabilityID != availabilityID &&
+			!(entry.AvailabilityID == 0 && !availability.StartsAt.Before(*entry.WeekStart) && availability.StartsAt.Before(*entry.WeekEnd)) {
+			continue
+		}
+
+		bookingID, err := s.insertBooking(LessonReservation{
+			StudentUsername: entry.StudentUsername,
+			TeacherID:       availability.TeacherID,
+			AvailabilityID:  availabilityID,
+			Subject:         entry.Subject,
+		})
+		if err != nil {
+			// the student can't take this lesson, for example because of another booking at the same time
+			continue
+		}
+		entry.Status, entry.BookingID = waitlistAssigned, bookingID
+		s.waitlist[id] = entry
+		return &entry, nil
+	}
+	return nil, nil
+}
+
+// withWaitlistDetails fills the teacher and the start of the availability of an entry. The caller holds the lock.
+func (s *memoryStore) withWaitlistDetails(entry WaitlistEntry) WaitlistEntry {
+	teacher := s.teachers[entry.TeacherID]
+	entry.TeacherName, entry.TeacherSurname = teacher.Name, teacher.Surname
+	if availability, exists := s.availabilities[entry.AvailabilityID]; exists {
+		startsAt := availability.StartsAt
+		entry.StartsAt = &startsAt
+	}
+	return entry
+}
+
+// Imports
+
+func (s *memoryStore) ImportTeachers(teachers []Teacher, dryRun bool) (map[int]error, error) {
+	//the passwords are hashed before taking the lock, as for a single teacher
+	rowErrors := map[int]error{}
+	hashed := make([]Teacher, len(teachers))
+	for i, teacher := range teachers {
+		var err error
+		if hashed[i], err = withHashedTeacherPassword(teacher); err != nil {
+			rowErrors[i] = err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.importRows(len(hashed), dryRun, rowErrors, func(i int) error {
+		return s.insertTeacher(hashed[i])
+	}), nil
+}
+
+func (s *memoryStore) ImportStudents(students []Student, dryRun bool) (map[int]error, error) {
+	rowErrors := map[int]error{}
+	hashed := make([]Student, len(students))
+	for i, student := range students {
+		err := validatePassword(student.Password)
+		var hashedPassword string
+		if err == nil {
+			hashedPassword, err = hashPassword(student.Password)
+		}
+		if err != nil {
+			rowErrors[i] = err
+		}
+		hashed[i] = student
+		hashed[i].Password = hashedPassword
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.importRows(len(hashed), dryRun, rowErrors, func(i int) error {
+		return s.insertStudent(hashed[i])
+	}), nil
+}
+
+func (s *memoryStore) ImportAvailabilities(availabilities []ImportedAvailability, dryRun bool) (map[int]error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.importRows(len(availabilities), dryRun, map[int]error{}, func(i int) error {
+		return s.insertAvailability(availabilities[i].Availability, availabilities[i].TeacherID)
+	}), nil
+}
+
+// importRows inserts the rows of an import that have no error yet and adds the errors of the ones that fail.
+// When a row failed or with dryRun the teachers, the students, the availabilities and the subjects are put back as they were,
+// like the rollback of the SQLite store. The caller holds the lock.
+func (s *memoryStore) importRows(count int, dryRun bool, rowErrors map[int]error, insert func(i int) error) map[int]error {
+	teachers, students, availabilities := maps.Clone(s.teachers), maps.Clone(s.students), maps.Clone(s.availabilities)
+	subjects := maps.Clone(s.subjects)
+	nextTeacherID, nextAvailabilityID, nextSubjectID := s.nextTeacherID, s.nextAvailabilityID, s.nextSubjectID
+
+	for i := 0; i < count; i++ {
+		if rowErrors[i] != nil {
+			continue
+		}
+		if err := insert(i); err != nil {
+			rowErrors[i] = err
+		}
+	}
+	if len(rowErrors) > 0 || dryRun {
+		s.teachers, s.students, s.availabilities, s.subjects = teachers, students, availabilities, subjects
+		s.nextTeacherID, s.nextAvailabilityID, s.nextSubjectID = nextTeacherID, nextAvailabilityID, nextSubjectID
+	}
+	return rowErrors
+}
+
+// Exports
+
+func (s *memoryStore) ExportData() (DataExport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	export := DataExport{ExportedAt: time.Now().UTC()}
+	for _, id := range sortedKeys(s.teachers) {
+		teacher := s.teachers[id]
+		teacher.Password = ""
+		export.Teachers = append(export.Teachers, teacher)
+	}
+	usernames := make([]string, 0, len(s.students))
+	for username := range s.students {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	for _, username := range usernames {
+		student := s.students[username]
+		student.Password = ""
+		export.Students = append(export.Students, student)
+	}
+	for _, id := range sortedKeys(s.availabilities) {
+		a := s.availabilities[id]
+		export.Availabilities = append(export.Availabilities, ExportedAvailability{TeacherID: a.TeacherID, Availability: a.Availability})
+	}
+	for _, id := range sortedKeys(s.bookings) {
+		export.Bookings = append(export.Bookings, s.bookings[id])
+	}
+	return export, nil
+}
+
+// Calendar feeds
+
+func (s *memoryStore) CalendarFeed(feed CalendarFeed) (CalendarFeed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkCalendarFeedOwner(feed); err != nil {
+		return CalendarFeed{}, err
+	}
+	for _, saved := range s.calendarFeeds {
+		if saved.StudentUsername == feed.StudentUsername && saved.TeacherID == feed.TeacherID {
+			return saved, nil
+		}
+	}
+	s.calendarFeeds[feed.Token] = feed
+	return feed, nil
+}
+
+func (s *memoryStore) ReplaceCalendarFeed(feed CalendarFeed) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkCalendarFeedOwner(feed); err != nil {
+		return err
+	}
+	for token, saved := range s.calendarFeeds {
+		if saved.StudentUsername == feed.StudentUsername && saved.TeacherID == feed.TeacherID {
+			delete(s.calendarFeeds, token)
+		}
+	}
+	s.calendarFeeds[feed.Token] = feed
+	return nil
+}
+
+func (s *memoryStore) CalendarFeedByToken(token string) (CalendarFeed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	feed, exists := s.calendarFeeds[token]
+	if !exists {
+		return CalendarFeed{}, ErrCalendarFeedNotFound
+	}
+	return feed, nil
+}
+
+// checkCalendarFeedOwner checks that the student or the teacher of the feed exists. The caller holds the lock.
+func (s *memoryStore) checkCalendarFeedOwner(feed CalendarFeed) error {
+	if feed.StudentUsername != "" {
+		if _, exists := s.students[feed.StudentUsername]; !exists {
+			return &ErrStudentNotFound{StudentID: feed.StudentUsername}
+		}
+		return nil
+	}
+	if _, exists := s.teachers[feed.TeacherID]; !exists {
+		return &ErrTeacherNotFound{TeacherID: feed.TeacherID}
+	}
+	return nil
+}
+
+// Scheduler
+
+func (s *memoryStore) JobRun(name string) (JobRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if run, exists := s.jobRuns[name]; exists {
+		return run, nil
+	}
+	return JobRun{Name: name}, nil
+}
+
+func (s *memoryStore) SaveJobRun(run JobRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobRuns[run.Name] = run
+	return nil
+}
+
+func (s *memoryStore) ClaimLessonReminder(bookingID int, reminder string, sentAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memoryReminderKey{BookingID: bookingID, Reminder: reminder}
+	if _, claimed := s.reminders[key]; claimed {
+		return false, nil
+	}
+	s.reminders[key] = sentAt
+	return true, nil
+}
+
+// Subjects
+
+func (s *memoryStore) AllSubjects() ([]Subject, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var subjects []Subject
+	for _, subject := range s.subjects {
+		subjects = append(subjects, subject)
+	}
+	sort.Slice(subjects, func(i, j int) bool { return subjects[i].Name < subjects[j].Name })
+	return subjects, nil
+}
+
+func (s *memoryStore) SetTeacherSubjects(teacherID int, subjects []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	teacher, exists := s.teachers[teacherID]
+	if !exists {
+		return nil, &ErrTeacherNotFound{TeacherID: teacherID}
+	}
+	teacher.Subjects = s.subjectNames(subjects)
+	s.teachers[teacherID] = teacher
+	return teacher.Subjects, nil
+}
+
+func (s *memoryStore) SearchTeachers(search TeacherSearch) ([]Teacher, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix := strings.ToLower(search.NamePrefix)
+	var teachers []Teacher
+	for _, id := range sortedKeys(s.teachers) {
+		teacher := s.teachers[id]
+		if search.Subject != "" && !slices.ContainsFunc(teacher.Subjects, func(name string) bool { return strings.EqualFold(name, search.Subject) }) {
+			continue
+		}
+		if prefix != "" && !strings.HasPrefix(strings.ToLower(teacher.Name), prefix) && !strings.HasPrefix(strings.ToLower(teacher.Surname), prefix) &&
+			!strings.HasPrefix(strings.ToLower(teacher.Name+" "+teacher.Surname), prefix) {
+			continue
+		}
+		if !search.FreeFrom.IsZero() && !s.hasFreeSlot(teacher.ID, search) {
+			continue
+		}
+		teacher.Password = ""
+		teachers = append(teachers, teacher)
+	}
+	sort.SliceStable(teachers, func(i, j int) bool {
+		if teachers[i].Surname != teachers[j].Surname {
+			return teachers[i].Surname < teachers[j].Surname
+		}
+		return teachers[i].Name < teachers[j].Name
+	})
+	return teachers, nil
+}
+
+// hasFreeSlot checks if the teacher has a free availability in the window of the search. The caller holds the lock.
+func (s *memoryStore) hasFreeSlot(teacherID int, search TeacherSearch) bool {
+	for _, availability := range s.availabilities {
+		if availability.TeacherID != teacherID || availability.Booked || availability.StartsAt.Before(search.FreeFrom) {
+			continue
+		}
+		if !search.FreeTo.IsZero() && availability.EndsAt().After(search.FreeTo) {
+			continue
+		}
+		if search.Subject != "" && !isSubjectAllowed(availability.Availability, search.Subject) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// subjectNames returns the names of the subjects as saved, creating the ones that don't exist yet,
+// in alphabetical order and without duplicates. The caller holds the lock.
+func (s *memoryStore) subjectNames(subjects []string) []string {
+	var names []string
+	for _, name := range subjects {
+		subject, exists := s.subjectNamed(name)
+		if !exists {
+			subject = Subject{ID: s.nextSubjectID, Name: name}
+			s.nextSubjectID++
+			s.subjects[subject.ID] = subject
+		}
+		if !slices.Contains(names, subject.Name) {
+			names = append(names, subject.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// subjectNamed returns the subject with the name, ignoring the case. The caller holds the lock.
+func (s *memoryStore) subjectNamed(name string) (Subject, bool) {
+	for _, subject := range s.subjects {
+		if strings.EqualFold(subject.Name, name) {
+			return subject, true
+		}
+	}
+	return Subject{}, false
+}
+
+// teacherSubject returns the subject of a lesson with the teacher as the teacher spells it, and
+// ErrSubjectNotTaught if the teacher doesn't teach it. The caller holds the lock.
+func (s *memoryStore) teacherSubject(teacherID int, subject string) (string, error) {
+	subjects := s.teachers[teacherID].Subjects
+	if len(subjects) == 0 {
+		return subject, nil
+	}
+	for _, name := range subjects {
+		if strings.EqualFold(name, strings.TrimSpace(subject)) {
+			return name, nil
+		}
+	}
+	return "", ErrSubjectNotTaught
+}
+
+// Administrators
+
+func (s *memoryStore) AllAdmins() ([]Admin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var admins []Admin
+	for _, username := range sortedKeys(s.admins) {
+		admin := s.admins[username]
+		admin.Password = ""
+		admins = append(admins, admin)
+	}
+	return admins, nil
+}
+
+func (s *memoryStore) AdminByUsername(username string) (Admin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	admin, exists := s.admins[username]
+	if !exists {
+		return Admin{}, ErrAdminNotFound
+	}
+	return admin, nil
+}
+
+func (s *memoryStore) InsertAdmin(admin Admin) error {
+	if admin.Password == "" {
+		return ErrAdminPasswordRequired
+	}
+	hashedPassword, err := hashPassword(admin.Password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.admins[admin.Username]; exists {
+		return ErrUsernameTaken
+	}
+	admin.Password = hashedPassword
+	s.admins[admin.Username] = admin
+	return nil
+}
+
+// Password resets
+
+func (s *memoryStore) InsertPasswordReset(reset PasswordReset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.students[reset.StudentUsername]; !exists {
+		return &ErrStudentNotFound{StudentID: reset.StudentUsername}
+	}
+	s.passwordResets[reset.TokenHash] = reset
+	return nil
+}
+
+func (s *memoryStore) ResetPassword(tokenHash, password string, at time.Time) (string, error) {
+	if err := validatePassword(password); err != nil {
+		return "", err
+	}
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reset, exists := s.passwordResets[tokenHash]
+	if !exists || reset.UsedAt != nil || !reset.ExpiresAt.After(at) {
+		return "", ErrPasswordResetInvalid
+	}
+	student, exists := s.students[reset.StudentUsername]
+	if !exists {
+		return "", ErrPasswordResetInvalid
+	}
+	student.Password = hashedPassword
+	student.PasswordChangedAt = time.Now()
+	s.students[student.Username] = student
+
+	for hash, other := range s.passwordResets {
+		if other.StudentUsername == student.Username && other.UsedAt == nil {
+			other.UsedAt = &at
+			s.passwordResets[hash] = other
+		}
+	}
+	return student.Username, nil
+}
+
+// Login failures
+
+func (s *memoryStore) InsertLoginFailure(failure LoginFailure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failure.ID = s.nextLoginFailureID
+	s.nextLoginFailureID++
+	s.loginFailures = append(s.loginFailures, failure)
+	return nil
+}
+
+func (s *memoryStore) LoginFailures(username string, limit int) ([]LoginFailure, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var failures []LoginFailure
+	for i := len(s.loginFailures) - 1; i >= 0 && len(failures) < limit; i-- {
+		if username == "" || s.loginFailures[i].Username == username {
+			failures = append(failures, s.loginFailures[i])
+		}
+	}
+	return failures, nil
+}
+
+// Utils
+
+// isOverlapping checks if the interval [startA, endA) overlaps [startB, endB).
+func isOverlapping(startA, endA, startB, endB time.Time) bool {
+	return startA.Before(endB) && startB.Before(endA)
+}
+
+// sortedKeys returns the keys of the map in ascending order.
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// sqliteStore is the Store backed by the SQLite database.
+type sqliteStore struct {
+	db *sql.DB
+	// readDB is a read-only connection to the same file, for the long reads that shouldn't hold the write lock
+	readDB *sql.DB
+}
+
+// newSQLiteStore opens the SQLite database in the given file and returns a Store using it.
+func newSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := openDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	readDB, err := openReadOnlyDatabase(path)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db, readDB: readDB}, nil
+}
+
+func (s *sqliteStore) Close() error {
+	s.readDB.Close()
+	return s.db.Close()
+}
+
+// Teachers
+
+func (s *sqliteStore) AllTeachers() ([]Teacher, error) {
+	return getAllTeachers(s.db)
+}
+
+func (s *sqliteStore) TeacherIDByFullName(name, surname string) (int, error) {
+	return getTeacherIDByFullName(s.db, name, surname)
+}
+
+func (s *sqliteStore) TeacherExists(teacherID int) (bool, error) {
+	return isTeacherExists(s.db, teacherID)
+}
+
+func (s *sqliteStore) TeacherByID(teacherID int) (Teacher, error) {
+	return getTeacherByID(s.db, teacherID)
+}
+
+func (s *sqliteStore) TeacherByUsername(username string) (Teacher, error) {
+	return getTeacherByUsername(s.db, username)
+}
+
+func (s *sqliteStore) InsertTeacher(teacher Teacher) error {
+	return createTeacher(s.db, teacher)
+}
+
+func (s *sqliteStore) UpdateTeacherTimeZone(teacherID int, timeZone string) error {
+	return updateTeacherTimeZone(s.db, teacherID, timeZone)
+}
+
+// Students
+
+func (s *sqliteStore) AllStudents() ([]Student, error) {
+	return getAllStudents(s.db)
+}
+
+func (s *sqliteStore) StudentByUsername(username string) (Student, error) {
+	return getStudentByUsername(s.db, username)
+}
+
+func (s *sqliteStore) InsertStudent(student Student) error {
+	return insertStudent(s.db, student)
+}
+
+func (s *sqliteStore) UpdateStudentTimeZone(username, timeZone string) error {
+	return updateStudentTimeZone(s.db, username, timeZone)
+}
+
+func (s *sqliteStore) UpdateStudentProfile(student Student) error {
+	return updateStudentProfile(s.db, student)
+}
+
+func (s *sqliteStore) UpdateStudentPassword(username, password string) error {
+	return updateStudentPassword(s.db, username, password)
+}
+
+func (s *sqliteStore) DeleteStudent(username string, from time.Time) ([]LessonReservation, error) {
+	return deleteStudent(s.db, username, from)
+}
+
+// Availabilities
+
+func (s *sqliteStore) TeacherAvailabilities(teacherID int) ([]Availability, error) {
+	return getTeacherAvailabilities(s.db, teacherID)
+}
+
+func (s *sqliteStore) DeletedTeacherAvailabilities(teacherID int) ([]Availability, error) {
+	return getDeletedTeacherAvailabilities(s.db, teacherID)
+}
+
+func (s *sqliteStore) TeacherBookedAvailabilities(teacherID int) ([]TeacherLesson, error) {
+	return getTeacherAvailabilitiesByID(s.db, teacherID)
+}
+
+func (s *sqliteStore) InsertAvailability(availability Availability, teacherID int) error {
+	return insertAvailability(s.db, availability, teacherID)
+}
+
+func (s *sqliteStore) DeleteAvailability(teacherID, availabilityID int) error {
+	return deleteAvailability(s.db, teacherID, availabilityID)
+}
+
+// Availability rules
+
+func (s *sqliteStore) InsertAvailabilityRule(rule AvailabilityRule) (AvailabilityRuleExpansion, error) {
+	return insertAvailabilityRule(s.db, rule)
+}
+
+func (s *sqliteStore) TeacherAvailabilityRules(teacherID int) ([]AvailabilityRule, error) {
+	return getTeacherAvailabilityRules(s.db, teacherID)
+}
+
+func (s *sqliteStore) CancelAvailabilityRule(teacherID, ruleID int, from time.Time) (int, error) {
+	return cancelAvailabilityRule(s.db, teacherID, ruleID, from)
+}
+
+// Duration policies
+
+func (s *sqliteStore) TeacherDurationPolicies(teacherID int) ([]DurationPolicy, error) {
+	return getTeacherDurationPolicies(s.db, teacherID)
+}
+
+func (s *sqliteStore) SaveDurationPolicy(policy DurationPolicy) error {
+	return saveDurationPolicy(s.db, policy)
+}
+
+func (s *sqliteStore) DeleteDurationPolicy(teacherID int, subject string) error {
+	return deleteDurationPolicy(s.db, teacherID, subject)
+}
+
+// Bookings
+
+func (s *sqliteStore) BookingByID(id string) (LessonReservation, error) {
+	return getBookingByID(s.db, id)
+}
+
+func (s *sqliteStore) StudentBookings(username string) ([]LessonBooked, error) {
+	return getStudentBookingsByUsername(s.db, username)
+}
+
+func (s *sqliteStore) InsertBooking(booking LessonReservation) (int, error) {
+	return insertBooking(s.db, booking)
+}
+
+func (s *sqliteStore) CancelBooking(id string, status string, cancellation BookingCancellation) error {
+	return cancelBooking(s.db, id, status, cancellation)
+}
+
+func (s *sqliteStore) UpdateBookingStatus(id string, status string) error {
+	return updateBookingStatus(s.db, id, status)
+}
+
+func (s *sqliteStore) BookingsStartingBetween(from, to time.Time) ([]LessonReservation, error) {
+	return getBookingsStartingBetween(s.db, from, to)
+}
+
+func (s *sqliteStore) CompleteBookingsEndedBefore(before time.Time) (int, error) {
+	return completeBookingsEndedBefore(s.db, before)
+}
+
+// Waitlist
+
+func (s *sqliteStore) InsertWaitlistEntry(entry WaitlistEntry) (WaitlistEntry, error) {
+	return insertWaitlistEntry(s.db, entry)
+}
+
+func (s *sqliteStore) StudentWaitlist(username string) ([]WaitlistEntry, error) {
+	return getStudentWaitlist(s.db, username)
+}
+
+func (s *sqliteStore) TeacherWaitlist(teacherID int) ([]WaitlistEntry, error) {
+	return getTeacherWaitlist(s.db, teacherID)
+}
+
+func (s *sqliteStore) DeleteWaitlistEntry(username string, entryID int) error {
+	return deleteWaitlistEntry(s.db, username, entryID)
+}
+
+func (s *sqliteStore) AssignFreedAvailability(availabilityID int) (*WaitlistEntry, error) {
+	return assignFreedAvailability(s.db, availabilityID)
+}
+
+// Imports
+
+func (s *sqliteStore) ImportTeachers(teachers []Teacher, dryRun bool) (map[int]error, error) {
+	return importTeachers(s.db, teachers, dryRun)
+}
+
+func (s *sqliteStore) ImportStudents(students []Student, dryRun bool) (map[int]error, error) {
+	return importStudents(s.db, students, dryRun)
+}
+
+func (s *sqliteStore) ImportAvailabilities(availabilities []ImportedAvailability, dryRun bool) (map[int]error, error) {
+	return importAvailabilities(s.db, availabilities, dryRun)
+}
+
+// Exports
+
+func (s *sqliteStore) ExportData() (DataExport, error) {
+	return exportData(s.readDB)
+}
+
+// Calendar feeds
+
+func (s *sqliteStore) CalendarFeed(feed CalendarFeed) (CalendarFeed, error) {
+	return getCalendarFeed(s.db, feed)
+}
+
+func (s *sqliteStore) ReplaceCalendarFeed(feed CalendarFeed) error {
+	return replaceCalendarFeed(s.db, feed)
+}
+
+func (s *sqliteStore) CalendarFeedByToken(token string) (CalendarFeed, error) {
+	return getCalendarFeedByToken(s.db, token)
+}
+
+// Scheduler
+
+func (s *sqliteStore) JobRun(name string) (JobRun, error) {
+	return getJobRun(s.db, name)
+}
+
+func (s *sqliteStore) SaveJobRun(run JobRun) error {
+	return saveJobRun(s.db, run)
+}
+
+func (s *sqliteStore) ClaimLessonReminder(bookingID int, reminder string, sentAt time.Time) (bool, error) {
+	return claimLessonReminder(s.db, bookingID, reminder, sentAt)
+}
+
+// Subjects
+
+func (s *sqliteStore) AllSubjects() ([]Subject, error) {
+	return getAllSubjects(s.db)
+}
+
+func (s *sqliteStore) SetTeacherSubjects(teacherID int, subjects []string) ([]string, error) {
+	return replaceTeacherSubjects(s.db, teacherID, subjects)
+}
+
+func (s *sqliteStore) SearchTeachers(search TeacherSearch) ([]Teacher, error) {
+	return searchTeachers(s.db, search)
+}
+
+// Administrators
+
+func (s *sqliteStore) AllAdmins() ([]Admin, error) {
+	return getAllAdmins(s.db)
+}
+
+func (s *sqliteStore) AdminByUsername(username string) (Admin, error) {
+	return getAdminByUsername(s.db, username)
+}
+
+func (s *sqliteStore) InsertAdmin(admin Admin) error {
+	return insertAdmin(s.db, admin)
+}
+
+// Password resets
+
+func (s *sqliteStore) InsertPasswordReset(reset PasswordReset) error {
+	return insertPasswordReset(s.db, reset)
+}
+
+func (s *sqliteStore) ResetPassword(tokenHash, password string, at time.Time) (string, error) {
+	return resetPassword(s.db, tokenHash, password, at)
+}
+
+// Login failures
+
+func (s *sqliteStore) InsertLoginFailure(failure LoginFailure) error {
+	return insertLoginFailure(s.db, failure)
+}
+
+func (s *sqliteStore) LoginFailures(username string, limit int) ([]LoginFailure, error) {
+	return getLoginFailures(s.db, username, limit)
+}
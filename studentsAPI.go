@@ -2,16 +2,33 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"server/models"
 )
 
-// createNewStudent creates a new student using the provided JSON data.
-func createNewStudent(c *gin.Context) {
-	connectToDB()
+// the bodies of the profile update, the password change and the account deletion, shared with the users of the API
+type (
+	studentProfileRequest   = models.StudentProfileRequest
+	studentPasswordRequest  = models.StudentPasswordRequest
+	studentPasswordResponse = models.StudentPasswordResponse
+	deleteStudentRequest    = models.DeleteStudentRequest
+)
 
+// deletedAccountReason is the cancellation reason of the lessons of a deleted account
+const deletedAccountReason = "The student deleted their account"
+
+// createNewStudent creates a new student using the provided JSON data.
+// The invalid fields are all answered at once with 422.
+func (api *apiServer) createNewStudent(c *gin.Context) {
 	var newStudent Student
 
 	//decode JSON request body to create a new student
@@ -21,10 +38,22 @@ func createNewStudent(c *gin.Context) {
 		return
 	}
 
+	newStudent.Name = strings.TrimSpace(newStudent.Name)
+	newStudent.Surname = strings.TrimSpace(newStudent.Surname)
+	newStudent.Username = strings.TrimSpace(newStudent.Username)
+	newStudent.Email = strings.TrimSpace(newStudent.Email)
+	if err := validateStudent(newStudent); err != nil {
+		invalidRequest(c, err)
+		return
+	}
+
 	//insert the new student into the database
-	err := insertStudent(db, newStudent)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	err := api.store.InsertStudent(newStudent)
+	if errors.Is(err, ErrUsernameTaken) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating the student"})
 		return
 	}
 
@@ -32,9 +61,8 @@ func createNewStudent(c *gin.Context) {
 }
 
 // getStudents retrieves a list of all students.
-func getStudents(c *gin.Context) {
-	connectToDB()
-	students, err := getAllStudents(db)
+func (api *apiServer) getStudents(c *gin.Context) {
+	students, err := api.store.AllStudents()
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No students")})
 		return
@@ -45,29 +73,31 @@ func getStudents(c *gin.Context) {
 		return
 	}
 
+	//the password hashes never leave the API
+	for i := range students {
+		students[i].Password = ""
+	}
+
 	c.IndentedJSON(http.StatusOK, students)
 }
 
 // getProfileStudent retrieves the profile of a specific student using their username.
-func getProfileStudent(c *gin.Context) {
-	connectToDB()
-
+func (api *apiServer) getProfileStudent(c *gin.Context) {
 	//retrieve the username of the student from the URL parameter
 	username := c.Param("username")
 
-	student, err := getStudentByUsername(db, username)
+	student, err := api.store.StudentByUsername(username)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("Student not found")})
 		return
 	}
 
+	student.Password = ""
 	c.IndentedJSON(http.StatusOK, student)
 }
 
 // createStudentBooking creates a new booking for a student.
-func createStudentBooking(c *gin.Context) {
-	connectToDB()
-
+func (api *apiServer) createStudentBooking(c *gin.Context) {
 	var newBooking LessonReservation
 
 	//decode JSON request body to create a new booking
@@ -77,24 +107,44 @@ func createStudentBooking(c *gin.Context) {
 		return
 	}
 
+	//the booking is always made for the student in the URL
+	newBooking.StudentUsername = c.Param("username")
+	newBooking.Subject = strings.TrimSpace(newBooking.Subject)
+	if err := api.validateBooking(newBooking); err != nil {
+		invalidRequest(c, err)
+		return
+	}
+
 	//insert the new booking into the database
-	err := insertBooking(db, newBooking)
-	if err != nil {
+	id, err := api.store.InsertBooking(newBooking)
+	switch err.(type) {
+	case nil:
+	case *ErrStudentNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": "Student not found"})
+		return
+	case *ErrTeacherNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No teachers associated with ID %d", newBooking.TeacherID)})
+		return
+	default:
+		if errors.Is(err, ErrAvailabilityAlreadyBooked) {
+			c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Booking created successfully"})
+	go api.notifyBooking(emailBookingConfirmed, id)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Booking created successfully", "id": id})
 }
 
 // getStudentBookings retrieves all bookings for a specific student using their username.
-func getStudentBookings(c *gin.Context) {
-	connectToDB()
-
+func (api *apiServer) getStudentBookings(c *gin.Context) {
 	//retrieve the username of the student from the URL parameter
 	username := c.Param("username")
 
-	bookings, err := getStudentBookingsByUsername(db, username)
+	bookings, err := api.store.StudentBookings(username)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("Student not found")})
 		return
@@ -105,22 +155,206 @@ func getStudentBookings(c *gin.Context) {
 		return
 	}
 
+	loc := api.viewerLocation(c)
+	for i := range bookings {
+		bookings[i].StartsAt = bookings[i].StartsAt.In(loc)
+		if bookings[i].CancelledAt != nil {
+			cancelledAt := bookings[i].CancelledAt.In(loc)
+			bookings[i].CancelledAt = &cancelledAt
+		}
+	}
 	c.IndentedJSON(http.StatusOK, bookings)
 }
 
-// deleteStudentBooking deletes a booking for a student using the booking ID.
-func deleteStudentBooking(c *gin.Context) {
-	connectToDB()
+// Updaters
+
+// updateStudentProfile changes the profile of a student with the fields in the body, like {"surname": "Smith"}.
+// The username can't be changed.
+func (api *apiServer) updateStudentProfile(c *gin.Context) {
+	username := c.Param("username")
+	student, err := api.store.StudentByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Student not found"})
+		return
+	}
+	var request studentProfileRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return
+	}
+
+	var v validator
+	if request.Name != nil {
+		student.Name = strings.TrimSpace(*request.Name)
+		v.check("name", validateName("name", student.Name))
+	}
+	if request.Surname != nil {
+		student.Surname = strings.TrimSpace(*request.Surname)
+		v.check("surname", validateName("surname", student.Surname))
+	}
+	if request.DateOfBirth != nil {
+		student.DateOfBirth = *request.DateOfBirth
+		v.check("date_of_birth", validateDateOfBirth(student.DateOfBirth, time.Now()))
+	}
+	if request.TimeZone != nil {
+		if student.TimeZone = *request.TimeZone; validateTimeZone(student.TimeZone) != nil || student.TimeZone == "" {
+			v.add("time_zone", fmt.Sprintf("Unknown time zone %q", student.TimeZone))
+		}
+	}
+	if request.Email != nil {
+		student.Email = strings.TrimSpace(*request.Email)
+		v.check("email", validateEmail(student.Email))
+	}
+	if err := v.err(); err != nil {
+		invalidRequest(c, err)
+		return
+	}
+
+	err = api.store.UpdateStudentProfile(student)
+	if _, notFound := err.(*ErrStudentNotFound); notFound {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Student not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating the profile"})
+		return
+	}
+	student.Password = ""
+	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully", "profile": student})
+}
+
+// changeStudentPassword replaces the password of a student, which revokes their tokens. The student needs
+// to give the current one and gets a new token, the administrator can set a new password without it.
+func (api *apiServer) changeStudentPassword(c *gin.Context) {
+	username := c.Param("username")
+	var request studentPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return
+	}
+	if err := validatePassword(request.NewPassword); err != nil {
+		invalidRequest(c, invalidField("new_password", err))
+		return
+	}
+	student, err := api.store.StudentByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Student not found"})
+		return
+	}
+	if currentPrincipal(c).Role != roleAdmin && !api.checkStudentPassword(c, student, request.OldPassword, "The current password is wrong") {
+		return
+	}
 
-	//retrieve the ID for the lessonBooked from the URL parameter
-	id := c.Param("id")
+	err = api.store.UpdateStudentPassword(username, request.NewPassword)
+	if _, notFound := err.(*ErrStudentNotFound); notFound {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Student not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error changing the password"})
+		return
+	}
+	response := studentPasswordResponse{Message: "Password changed successfully"}
+	if principal := currentPrincipal(c); principal.Role == roleStudent {
+		student, err := api.store.StudentByUsername(username)
+		if err == nil {
+			principal.PasswordSetAt = passwordStamp(student.PasswordChangedAt)
+			response.Token, response.ExpiresAt, err = api.auth.issueToken(principal)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "The password was changed, log in again"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
 
-	//delete the booking and retrieve the student's username
-	username, err := deleteBookingByID(db, id)
+// checkStudentPassword checks the password a student confirms a change of their account with, limited like
+// the logins: a stolen token can't be used to guess the password. When the password is refused it answers
+// 403 with the message, or 429 Too Many Requests once the account or the address is blocked, and returns false.
+func (api *apiServer) checkStudentPassword(c *gin.Context, student Student, password, message string) bool {
+	account := loginAccount{Role: roleStudent, Username: student.Username}
+	now := time.Now()
+	if reason, retryAfter, record := api.logins.allow(c.ClientIP(), account, now); reason != "" {
+		if record {
+			api.recordLoginFailure(c, account, reason, now)
+		}
+		tooManyAttempts(c, "Too many password attempts", retryAfter)
+		return false
+	}
+	if !checkPassword(student.Password, password) {
+		api.logins.failed(account, now)
+		api.recordLoginFailure(c, account, loginFailureInvalidCredentials, now)
+		c.JSON(http.StatusForbidden, gin.H{"message": message})
+		return false
+	}
+	api.logins.succeeded(account)
+	return true
+}
+
+// Deleters
+
+// deleteStudentAccount deletes a student with their bookings, their waitlist entries and their calendar feed.
+// The student confirms with their password, the administrator doesn't need to. The lessons still to come are
+// cancelled: their teachers are told and the freed availabilities go to the waitlist.
+func (api *apiServer) deleteStudentAccount(c *gin.Context) {
+	username := c.Param("username")
+	//the body is only needed by the students
+	var request deleteStudentRequest
+	if err := c.ShouldBindJSON(&request); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return
+	}
+	student, err := api.store.StudentByUsername(username)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Error deleting booking"})
+		c.JSON(http.StatusNotFound, gin.H{"message": "Student not found"})
+		return
+	}
+	if currentPrincipal(c).Role != roleAdmin && !api.checkStudentPassword(c, student, request.Password, "The password is wrong") {
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, username)
+	now := time.Now()
+	cancelled, err := api.store.DeleteStudent(username, now)
+	if _, notFound := err.(*ErrStudentNotFound); notFound {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Student not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting the account"})
+		return
+	}
+
+	for i := range cancelled {
+		cancelled[i].Status = bookingCancelledByStudent
+		cancelled[i].BookingCancellation = BookingCancellation{CancellationReason: deletedAccountReason, CancelledAt: &now}
+	}
+	go api.notifyDeletedStudentLessons(student, cancelled)
+	for _, booking := range cancelled {
+		entry, err := api.store.AssignFreedAvailability(booking.AvailabilityID)
+		if err != nil {
+			log.Printf("Error assigning availability %d to the waitlist: %v", booking.AvailabilityID, err)
+		} else if entry != nil {
+			go api.notifyBooking(emailBookingConfirmed, entry.BookingID)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully", "cancelled_bookings": len(cancelled)})
+}
+
+// Utils
+
+// validateBooking checks a new booking: the teacher, the availability and a subject the teacher teaches
+// are required. Whether the availability can be booked is left to the store.
+func (api *apiServer) validateBooking(booking LessonReservation) error {
+	var v validator
+	if booking.TeacherID <= 0 {
+		v.add("teacher_id", "The teacher is required")
+	}
+	if booking.AvailabilityID <= 0 {
+		v.add("availability_id", "The availability is required")
+	}
+	if booking.Subject == "" {
+		v.add("subject", "The subject is required")
+	} else if booking.TeacherID > 0 {
+		v.check("subject", api.validateTeacherSubject(booking.TeacherID, booking.Subject))
+	}
+	return v.err()
 }
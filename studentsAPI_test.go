@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentBookingsOfTheSameSlot(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testConcurrentBookings(t, newTestAPI(t))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		testConcurrentBookings(t, newTestAPIOn(t, newTestSQLiteStore(t), loginPolicy{}))
+	})
+}
+
+// testConcurrentBookings has many students book the same availability at once: only one of them gets it.
+func testConcurrentBookings(t *testing.T, api *testAPI) {
+	teacherID := api.addTeacher("Lovelace")
+	availabilityID := api.addAvailability(teacherID, nextHour(3))
+
+	const students = 20
+	tokens := make([]string, students)
+	for i := range tokens {
+		tokens[i] = api.addStudent(fmt.Sprintf("student%d", i))
+	}
+
+	statuses := make([]int, students)
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			booking := LessonReservation{TeacherID: teacherID, AvailabilityID: availabilityID, Subject: "Maths"}
+			statuses[i] = api.do(http.MethodPost, fmt.Sprintf("/api/student/student%d/bookings", i), tokens[i], booking).Code
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	created := 0
+	for i, status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("student%d got status %d", i, status)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("%d bookings created, want 1", created)
+	}
+	bookings, err := api.store.TeacherBookedAvailabilities(teacherID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 1 {
+		t.Fatalf("%d bookings saved, want 1", len(bookings))
+	}
+}
+
+func TestBookingABookedSlotConflicts(t *testing.T) {
+	api := newTestAPI(t)
+	teacherID := api.addTeacher("Lovelace")
+	availabilityID := api.addAvailability(teacherID, nextHour(3))
+	alice, bob := api.addStudent("alice"), api.addStudent("bob")
+
+	booking := LessonReservation{TeacherID: teacherID, AvailabilityID: availabilityID, Subject: "Maths"}
+	api.expect(api.do(http.MethodPost, "/api/student/alice/bookings", alice, booking), http.StatusCreated)
+	api.expect(api.do(http.MethodPost, "/api/student/bob/bookings", bob, booking), http.StatusConflict)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"server/models"
+)
+
+// maxSubjectLength is the longest name of a subject, in characters
+const maxSubjectLength = 50
+
+// teacherSubjectsRequest is the body replacing the subjects of a teacher, shared with the users of the API
+type teacherSubjectsRequest = models.TeacherSubjectsRequest
+
+// Getters
+
+// getSubjects retrieves the subjects taught by at least one teacher or taught before, by name.
+func (api *apiServer) getSubjects(c *gin.Context) {
+	subjects, err := api.store.AllSubjects()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving the subjects"})
+		return
+	}
+	if len(subjects) == 0 {
+		c.JSON(http.StatusOK, []Subject{})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, subjects)
+}
+
+// getTeacherSubjects retrieves the subjects a teacher teaches. A teacher without subjects teaches any subject.
+func (api *apiServer) getTeacherSubjects(c *gin.Context) {
+	teacherID, errID := strconv.Atoi(c.Param("id"))
+	if errID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teacher ID"})
+		return
+	}
+	teacher, err := api.store.TeacherByID(teacherID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No teachers associated with ID %d", teacherID)})
+		return
+	}
+	if teacher.Subjects == nil {
+		teacher.Subjects = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"subjects": teacher.Subjects})
+}
+
+// searchTeachers retrieves the teachers matching the query: ?subject= for the teachers of a subject,
+// ?name= for the ones whose name or surname starts with it, and ?from= and ?to=, RFC3339 times,
+// for the ones with a free availability between the two. Without ?to= any later free availability counts,
+// and the availabilities that already started never do.
+func (api *apiServer) searchTeachers(c *gin.Context) {
+	search := TeacherSearch{Subject: strings.TrimSpace(c.Query("subject")), NamePrefix: strings.TrimSpace(c.Query("name"))}
+	var err error
+	if from := c.Query("from"); from != "" {
+		if search.FreeFrom, err = time.Parse(time.RFC3339, from); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid from time: use RFC3339, like 2024-05-01T14:00:00Z"})
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if search.FreeTo, err = time.Parse(time.RFC3339, to); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid to time: use RFC3339, like 2024-05-01T18:00:00Z"})
+			return
+		}
+		if !search.FreeFrom.IsZero() && !search.FreeTo.After(search.FreeFrom) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "The to time needs to be after the from time"})
+			return
+		}
+	}
+	if !search.FreeFrom.IsZero() || !search.FreeTo.IsZero() {
+		//only the availabilities still to come can be booked
+		search.FreeFrom = maxTime(search.FreeFrom, time.Now())
+	}
+
+	teachers, err := api.store.SearchTeachers(search)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error searching the teachers"})
+		return
+	}
+	if len(teachers) == 0 {
+		c.JSON(http.StatusOK, []Teacher{})
+		return
+	}
+	if currentPrincipal(c).Role != roleAdmin {
+		for i := range teachers {
+			teachers[i].Email = ""
+		}
+	}
+	c.IndentedJSON(http.StatusOK, teachers)
+}
+
+// Updaters
+
+// updateTeacherSubjects replaces the subjects a teacher teaches with the ones in the body,
+// like {"subjects": ["Maths", "Physics"]}. An empty list lets the teacher teach any subject again.
+func (api *apiServer) updateTeacherSubjects(c *gin.Context) {
+	teacherID, errID := strconv.Atoi(c.Param("id"))
+	if errID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teacher ID"})
+		return
+	}
+	var body teacherSubjectsRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return
+	}
+	subjects, err := normalizeSubjects(body.Subjects)
+	if err != nil {
+		invalidRequest(c, invalidField("subjects", err))
+		return
+	}
+
+	saved, err := api.store.SetTeacherSubjects(teacherID, subjects)
+	if _, notFound := err.(*ErrTeacherNotFound); notFound {
+		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No teachers associated with ID %d", teacherID)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving the subjects"})
+		return
+	}
+	if saved == nil {
+		saved = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Subjects updated successfully", "subjects": saved})
+}
+
+// Utils
+
+// normalizeSubjects trims the names of the subjects and drops the ones given twice, ignoring the case.
+// Unlike the subjects of the availabilities, the names keep their case: they are shown to the students.
+func normalizeSubjects(subjects []string) ([]string, error) {
+	var names []string
+	for _, subject := range subjects {
+		name := strings.TrimSpace(subject)
+		if name == "" {
+			return nil, fmt.Errorf("The name of a subject can't be empty")
+		}
+		if len([]rune(name)) > maxSubjectLength {
+			return nil, fmt.Errorf("The name of a subject can't be longer than %d characters", maxSubjectLength)
+		}
+		duplicate := false
+		for _, other := range names {
+			if strings.EqualFold(other, name) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// maxTime returns the later of the two times.
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func teacherLoginHandler(w http.ResponseWriter, r *http.Request) {
+	renderTeacherLoginPage(w, r, "")
+}
+
+// teacherPortalHandler logs the teacher in (on POST) and shows their availabilities and booked lessons.
+func teacherPortalHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleTeacher)
+	if err != nil {
+		if r.Method != http.MethodPost {
+			renderTeacherLoginPage(w, r, "")
+			return
+		}
+		var creds Credentials
+		r.ParseForm()
+		creds.Username = r.FormValue("username")
+		creds.Password = r.FormValue("password")
+
+		login, err := loginAPI(r).Login(r.Context(), creds.Username, creds.Password, roleTeacher)
+		if err != nil {
+			renderTeacherLoginPage(w, r, apiErrorMessage(err, "Invalid username or password"))
+			return
+		}
+		userSession = createSession(w, Session{username: login.Username, role: roleTeacher, teacherID: login.TeacherID, token: login.Token, tokenExpiry: login.ExpiresAt, timeZone: login.TimeZone})
+	}
+	renderTeacherPortalPage(w, r, userSession, "")
+}
+
+func teacherAddAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleTeacher)
+	if err != nil {
+		renderTeacherLoginPage(w, r, "")
+		return
+	}
+
+	//the day comes as YYYY-MM-DD and the times as HH:MM, in the time zone of the teacher
+	r.ParseForm()
+	loc := loadLocation(userSession.timeZone)
+	startingTime, errStart := time.ParseInLocation("2006-01-02 15:04", r.FormValue("day")+" "+r.FormValue("starting_time"), loc)
+	endingTime, errEnd := time.ParseInLocation("2006-01-02 15:04", r.FormValue("day")+" "+r.FormValue("ending_time"), loc)
+	if errStart != nil || errEnd != nil {
+		renderTeacherPortalPage(w, r, userSession, "Invalid date or time")
+		return
+	}
+	availability := Availability{
+		StartsAt:        startingTime,
+		DurationMinutes: int(endingTime.Sub(startingTime).Minutes()),
+		Booked:          false,
+		Subject:         r.FormValue("subject"),
+	}
+
+	if err := apiFor(userSession).CreateAvailability(r.Context(), userSession.teacherID, availability); err != nil {
+		renderTeacherPortalPage(w, r, userSession, apiErrorMessage(err, "The availability couldn't be added"))
+		return
+	}
+	http.Redirect(w, r, "/teacher/portal", http.StatusSeeOther)
+}
+
+func teacherDeleteAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleTeacher)
+	if err != nil {
+		renderTeacherLoginPage(w, r, "")
+		return
+	}
+
+	//retrieve ID of the availability
+	id, _ := strconv.Atoi(r.FormValue("availability_id"))
+	if err := apiFor(userSession).DeleteAvailability(r.Context(), userSession.teacherID, id); err != nil {
+		renderTeacherPortalPage(w, r, userSession, apiErrorMessage(err, "The availability couldn't be deleted"))
+		return
+	}
+	http.Redirect(w, r, "/teacher/portal", http.StatusSeeOther)
+}
+
+// teacherCancelBookingHandler cancels a lesson booked with the teacher, giving the reason to the student.
+func teacherCancelBookingHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleTeacher)
+	if err != nil {
+		renderTeacherLoginPage(w, r, "")
+		return
+	}
+
+	bookingID, _ := strconv.Atoi(r.FormValue("booking_id"))
+	if err := apiFor(userSession).CancelBooking(r.Context(), bookingID, r.FormValue("reason")); err != nil {
+		renderTeacherPortalPage(w, r, userSession, apiErrorMessage(err, "The booking couldn't be cancelled"))
+		return
+	}
+	http.Redirect(w, r, "/teacher/portal", http.StatusSeeOther)
+}
+
+// teacherResetCalendarHandler gives the teacher a new calendar feed URL, the previous one stops working.
+func teacherResetCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleTeacher)
+	if err != nil {
+		renderTeacherLoginPage(w, r, "")
+		return
+	}
+
+	if _, err := apiFor(userSession).ResetTeacherCalendarFeed(r.Context(), userSession.teacherID); err != nil {
+		renderTeacherPortalPage(w, r, userSession, apiErrorMessage(err, "The calendar link couldn't be reset"))
+		return
+	}
+	http.Redirect(w, r, "/teacher/portal", http.StatusSeeOther)
+}
+
+// teacherSubjectsHandler replaces the subjects the teacher teaches with the comma-separated ones of the form.
+func teacherSubjectsHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := checkSessionRole(w, r, roleTeacher)
+	if err != nil {
+		renderTeacherLoginPage(w, r, "")
+		return
+	}
+
+	if _, err := apiFor(userSession).SetTeacherSubjects(r.Context(), userSession.teacherID, splitSubjects(r.FormValue("subjects"))); err != nil {
+		renderTeacherPortalPage(w, r, userSession, apiErrorMessage(err, "The subjects couldn't be saved"))
+		return
+	}
+	http.Redirect(w, r, "/teacher/portal", http.StatusSeeOther)
+}
+
+// renderTeacherPortalPage shows the availabilities and the booked lessons of the teacher, with a message when an action failed.
+func renderTeacherPortalPage(w http.ResponseWriter, r *http.Request, userSession Session, message string) {
+	client := apiFor(userSession)
+	availabilities, err := client.TeacherAvailability(r.Context(), userSession.teacherID)
+	if err != nil {
+		http.Error(w, "Error fetching availabilities from the API", http.StatusInternalServerError)
+		return
+	}
+	lessons, err := client.TeacherBookings(r.Context(), userSession.teacherID)
+	if err != nil {
+		http.Error(w, "Error fetching availabilities from the API", http.StatusInternalServerError)
+		return
+	}
+	policies, err := client.TeacherDurationPolicies(r.Context(), userSession.teacherID)
+	if err != nil {
+		http.Error(w, "Error fetching availabilities from the API", http.StatusInternalServerError)
+		return
+	}
+	feed, err := client.TeacherCalendarFeed(r.Context(), userSession.teacherID)
+	if err != nil {
+		http.Error(w, "Error fetching the calendar feed from the API", http.StatusInternalServerError)
+		return
+	}
+	subjects, err := client.TeacherSubjects(r.Context(), userSession.teacherID)
+	if err != nil {
+		http.Error(w, "Error fetching the subjects from the API", http.StatusInternalServerError)
+		return
+	}
+
+	t, err := template.New("teacherPortal.html").Funcs(timeToDate).ParseFiles("teacherPortal.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = t.Execute(w, struct {
+		Username       string
+		Message        string
+		Availabilities []Availability
+		Lessons        []TeacherLesson
+		Durations      durationPolicies
+		TimeZone       string
+		CalendarURL    string
+		Subjects       []string
+		CSRFToken      string
+	}{Username: userSession.username, Message: message, Availabilities: availabilities, Lessons: lessons, Durations: policies, TimeZone: userSession.timeZone,
+		CalendarURL: feed.URL, Subjects: subjects, CSRFToken: userSession.csrfToken})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func renderTeacherLoginPage(w http.ResponseWriter, r *http.Request, errorMessage string) {
+	t, err := template.New("teacherLogin.html").Funcs(timeToDate).ParseFiles("teacherLogin.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	t.Execute(w, &Page{Title: "Teacher login", Body: errorMessage, CSRFToken: formCSRFToken(w, r)})
+}
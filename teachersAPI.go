@@ -2,10 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,32 +15,38 @@ import (
 // Getters
 
 // getTeachers retrieves a list of all teachers.
-func getTeachers(c *gin.Context) {
-	connectToDB()
-	teachers, err := getAllTeachers(db)
+func (api *apiServer) getTeachers(c *gin.Context) {
+	teachers, err := api.store.AllTeachers()
 	if err != nil {
-		log.Fatal(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving the teachers"})
+		return
 	}
 	if len(teachers) == 0 {
 		c.JSON(http.StatusOK, []Teacher{})
 		return
 	}
+	//the students browse the teachers, only the administrator sees their email addresses
+	if currentPrincipal(c).Role != roleAdmin {
+		for i := range teachers {
+			teachers[i].Email = ""
+		}
+	}
 	c.IndentedJSON(http.StatusOK, teachers)
 }
 
 // getTeacherAvailability retrieves the availabilities of a specific teacher using their ID.
-func getTeacherAvailability(c *gin.Context) {
-	connectToDB()
+func (api *apiServer) getTeacherAvailability(c *gin.Context) {
 	teacherID, errID := strconv.Atoi(c.Param("id"))
 	if errID != nil {
-		log.Fatal(errID)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teacher ID"})
+		return
 	}
-	isPresent, _ := isTeacherExists(db, teacherID)
+	isPresent, _ := api.store.TeacherExists(teacherID)
 	if !isPresent {
 		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No teachers associated with ID %d", teacherID)})
 		return
 	}
-	availabilities, err := getTeacherAvailabilities(db, teacherID)
+	availabilities, err := api.store.TeacherAvailabilities(teacherID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No availabilities")})
 		return
@@ -48,41 +55,45 @@ func getTeacherAvailability(c *gin.Context) {
 		c.JSON(http.StatusOK, []Availability{})
 		return
 	}
+	availabilitiesIn(availabilities, api.viewerLocation(c))
 	c.IndentedJSON(http.StatusOK, availabilities)
 }
 
 // getTeacherBookings retrieves the bookings of a specific teacher using their ID.
-func getTeacherBookings(c *gin.Context) {
-	connectToDB()
+func (api *apiServer) getTeacherBookings(c *gin.Context) {
 	teacherID, errID := strconv.Atoi(c.Param("id"))
 	if errID != nil {
-		log.Fatal(errID)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teacher ID"})
+		return
 	}
 	//find out if the teacher is saved in the DB
-	isPresent, _ := isTeacherExists(db, teacherID)
+	isPresent, _ := api.store.TeacherExists(teacherID)
 	if !isPresent {
 		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No teachers associated with ID %d", teacherID)})
 		return
 	}
-	//retrieve all the availabilities of the teacher
-	bookings, err := getTeacherAvailabilitiesByID(db, teacherID)
+	//retrieve all the booked availabilities of the teacher with the students who booked them
+	bookings, err := api.store.TeacherBookedAvailabilities(teacherID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No bookings")})
 		return
 	}
 	if len(bookings) == 0 {
-		c.JSON(http.StatusOK, []Availability{})
+		c.JSON(http.StatusOK, []TeacherLesson{})
 		return
 	}
+	loc := api.viewerLocation(c)
+	for i := range bookings {
+		bookings[i].StartsAt = bookings[i].StartsAt.In(loc)
+	}
 	c.IndentedJSON(http.StatusOK, bookings)
 }
 
 // getTeacherIDByNameAndSurname retrieves the ID of a teacher using their name and surname.
-func getTeacherIDByNameAndSurname(c *gin.Context) {
-	connectToDB()
+func (api *apiServer) getTeacherIDByNameAndSurname(c *gin.Context) {
 	teacherName := c.Param("name")
 	teacherSurname := c.Param("surname")
-	teacherID, errID := getTeacherIDByFullName(db, teacherName, teacherSurname)
+	teacherID, errID := api.store.TeacherIDByFullName(teacherName, teacherSurname)
 	if errID != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No teachers associated with name %s and surname %s", teacherName, teacherSurname)})
 		return
@@ -93,30 +104,45 @@ func getTeacherIDByNameAndSurname(c *gin.Context) {
 // Creators
 
 // createNewTeacher creates a new teacher using the provided JSON data.
-func createNewTeacher(c *gin.Context) {
-	connectToDB()
+// A username already taken is answered with 409.
+func (api *apiServer) createNewTeacher(c *gin.Context) {
 	var newTeacher Teacher
 
 	if err := c.ShouldBindJSON(&newTeacher); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "ERROR"})
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return
+	}
+	newTeacher.Name = strings.TrimSpace(newTeacher.Name)
+	newTeacher.Surname = strings.TrimSpace(newTeacher.Surname)
+	newTeacher.Username = strings.TrimSpace(newTeacher.Username)
+	newTeacher.Email = strings.TrimSpace(newTeacher.Email)
+	if err := validateTeacher(newTeacher); err != nil {
+		invalidRequest(c, err)
+		return
+	}
+	newTeacher.Subjects, _ = normalizeSubjects(newTeacher.Subjects)
+
+	err := api.store.InsertTeacher(newTeacher)
+	if errors.Is(err, ErrUsernameTaken) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating the teacher"})
 		return
 	}
-	insertTeacher(db, newTeacher)
 
 	c.JSON(http.StatusCreated, gin.H{"message": "Teacher created successfully"})
 }
 
 // createTeacherAvailability creates a new availability for a teacher.
-func createTeacherAvailability(c *gin.Context) {
-	connectToDB()
-	defer db.Close()
-
+func (api *apiServer) createTeacherAvailability(c *gin.Context) {
 	teacherID, errID := strconv.Atoi(c.Param("id"))
 	if errID != nil {
-		log.Fatal(errID)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teacher ID"})
+		return
 	}
 	//find out if the teacher is saved in the DB
-	isPresent, _ := isTeacherExists(db, teacherID)
+	isPresent, _ := api.store.TeacherExists(teacherID)
 	if !isPresent {
 		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No teachers associated with ID %d", teacherID)})
 		return
@@ -129,29 +155,73 @@ func createTeacherAvailability(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
 		return
 	}
-	//checking if the duration of the lesson is 1 hour
-	checkDuration, _ := checkDuration(availability.StartingTime, availability.EndingTime)
-	if !checkDuration {
-		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("The duration of each lesson need to be 1 hour")})
+	availability.Subject = normalizeSubject(availability.Subject)
+	policy, err := api.durationPolicyFor(teacherID, availability.Subject)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving the lesson durations"})
+		return
+	}
+	if err := api.validateAvailability(teacherID, availability, policy, time.Now()); err != nil {
+		invalidRequest(c, err)
 		return
 	}
 
-	err := insertAvailability(db, availability, teacherID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Error creating new availability"})
+	err = api.store.InsertAvailability(availability, teacherID)
+	if errors.Is(err, ErrOverlappingAvailabilities) {
+		invalidRequest(c, invalidField("starts_at", errors.New("The lesson overlaps another availability of the teacher")))
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating new availability"})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"message": "Availability created successfully"})
 }
 
+// Deleters
+
+// deleteTeacherAvailability deletes an availability of a teacher that hasn't been booked yet.
+func (api *apiServer) deleteTeacherAvailability(c *gin.Context) {
+	teacherID, errID := strconv.Atoi(c.Param("id"))
+	availabilityID, errAvailabilityID := strconv.Atoi(c.Param("availabilityID"))
+	if errID != nil || errAvailabilityID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid ID"})
+		return
+	}
+
+	err := api.store.DeleteAvailability(teacherID, availabilityID)
+	if err == ErrAvailabilityNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	} else if err == ErrAvailabilityAlreadyBooked {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting availability"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Availability deleted successfully"})
+}
+
 // Utils
 
-// checkDuration checks if the duration between starting and ending times is exactly 1 hour.
-func checkDuration(startingTime, endingTime time.Time) (bool, error) {
-	duration := endingTime.Sub(startingTime)
-	if duration.Hours() != 1 {
-		return false, fmt.Errorf("The duration of the lesson need to be of 1 hour")
+// validateAvailability checks a new availability of a teacher: it starts after now, for a subject the teacher
+// teaches if any, and its duration is allowed by the policy of the teacher for the subject. The lessons are
+// aligned on the clock of the teacher.
+func (api *apiServer) validateAvailability(teacherID int, availability Availability, policy DurationPolicy, now time.Time) error {
+	var v validator
+	if availability.StartsAt.IsZero() {
+		v.add("starts_at", "The starting time of the lesson is required")
+	} else if availability.StartsAt.Before(now) {
+		v.add("starts_at", "The lesson can't start in the past")
+	}
+	if availability.Subject != "" {
+		v.check("subject", api.validateTeacherSubject(teacherID, availability.Subject))
+	}
+	if !availability.StartsAt.IsZero() {
+		loc := api.teacherLocation(teacherID)
+		v.check("duration_minutes", checkDuration(policy, availability.StartsAt.In(loc), availability.EndsAt().In(loc)))
 	}
-	return true, nil
+	return v.err()
 }
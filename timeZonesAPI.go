@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	// the zone database is embedded so that the server works on machines without one
+	_ "time/tzdata"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeZoneRequest is the body of the requests changing a time zone preference
+type timeZoneRequest struct {
+	TimeZone string `json:"time_zone"`
+}
+
+// Updaters
+
+// updateStudentTimeZone changes the time zone the student sees the lessons in.
+func (api *apiServer) updateStudentTimeZone(c *gin.Context) {
+	timeZone, ok := bindTimeZone(c)
+	if !ok {
+		return
+	}
+	err := api.store.UpdateStudentTimeZone(c.Param("username"), timeZone)
+	if _, notFound := err.(*ErrStudentNotFound); notFound {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Student not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating the time zone"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Time zone updated successfully", "time_zone": timeZone})
+}
+
+// updateTeacherTimeZone changes the time zone the teacher works in.
+func (api *apiServer) updateTeacherTimeZone(c *gin.Context) {
+	teacherID, errID := strconv.Atoi(c.Param("id"))
+	if errID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teacher ID"})
+		return
+	}
+	timeZone, ok := bindTimeZone(c)
+	if !ok {
+		return
+	}
+	err := api.store.UpdateTeacherTimeZone(teacherID, timeZone)
+	if _, notFound := err.(*ErrTeacherNotFound); notFound {
+		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No teachers associated with ID %d", teacherID)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating the time zone"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Time zone updated successfully", "time_zone": timeZone})
+}
+
+// Utils
+
+// bindTimeZone decodes and validates the time zone in the request body.
+// It writes the error response and returns false when the time zone can't be used.
+func bindTimeZone(c *gin.Context) (string, bool) {
+	var request timeZoneRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return "", false
+	}
+	if err := validateTimeZone(request.TimeZone); err != nil || request.TimeZone == "" {
+		invalidRequest(c, invalidField("time_zone", fmt.Errorf("Unknown time zone %q", request.TimeZone)))
+		return "", false
+	}
+	return request.TimeZone, true
+}
+
+// viewerLocation returns the zone the times of the response are rendered in: the "tz" query
+// parameter when given, otherwise the preference of the authenticated user. The administrator
+// has no preference and sees UTC.
+func (api *apiServer) viewerLocation(c *gin.Context) *time.Location {
+	if timeZone := c.Query("tz"); timeZone != "" {
+		return loadLocation(timeZone)
+	}
+	principal := currentPrincipal(c)
+	switch principal.Role {
+	case roleStudent:
+		if student, err := api.store.StudentByUsername(principal.Username); err == nil {
+			return loadLocation(student.TimeZone)
+		}
+	case roleTeacher:
+		if teacher, err := api.store.TeacherByID(principal.TeacherID); err == nil {
+			return loadLocation(teacher.TimeZone)
+		}
+	}
+	return time.UTC
+}
+
+// teacherLocation returns the zone a teacher works in, UTC if unknown.
+func (api *apiServer) teacherLocation(teacherID int) *time.Location {
+	teacher, err := api.store.TeacherByID(teacherID)
+	if err != nil {
+		return time.UTC
+	}
+	return loadLocation(teacher.TimeZone)
+}
+
+// availabilitiesIn converts the starting times of the availabilities to the zone.
+func availabilitiesIn(availabilities []Availability, loc *time.Location) {
+	for i := range availabilities {
+		availabilities[i].StartsAt = availabilities[i].StartsAt.In(loc)
+	}
+}
+
+// validateTimeZone checks that the name is a known IANA zone. The empty name stands for UTC,
+// while "Local" is refused since it depends on the machine running the server.
+func validateTimeZone(timeZone string) error {
+	if timeZone == "Local" {
+		return fmt.Errorf("Unknown time zone %q", timeZone)
+	}
+	_, err := time.LoadLocation(timeZone)
+	return err
+}
+
+// loadLocation returns the zone with the given IANA name, UTC if the name is empty or unknown.
+func loadLocation(timeZone string) *time.Location {
+	if validateTimeZone(timeZone) != nil {
+		return time.UTC
+	}
+	loc, _ := time.LoadLocation(timeZone)
+	return loc
+}
+
+// timeZoneOrUTC is the time zone stored for an empty preference.
+func timeZoneOrUTC(timeZone string) string {
+	if timeZone == "" {
+		return "UTC"
+	}
+	return timeZone
+}
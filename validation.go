@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"server/models"
+)
+
+// limits of the fields of the requests
+const (
+	// maxNameLength is the longest name or surname, in characters
+	maxNameLength = 50
+	// minUsernameLength and maxUsernameLength bound the usernames, in characters
+	minUsernameLength = 3
+	maxUsernameLength = 32
+	// maxEmailLength is the longest email address, in bytes
+	maxEmailLength = 254
+)
+
+// minDateOfBirth is the earliest date of birth accepted
+var minDateOfBirth = time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// FieldError is the reason a field of a request is invalid, shared with the API client
+type FieldError = models.FieldError
+
+// ValidationError lists every invalid field of a request, so that they can all be fixed in one go.
+// The handlers answer it with 422 Unprocessable Entity.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// validator collects the errors of the fields of a request.
+type validator struct {
+	fields []FieldError
+}
+
+// add records an error of the field.
+func (v *validator) add(field, message string) {
+	v.fields = append(v.fields, FieldError{Field: field, Message: message})
+}
+
+// check records err, if any, as an error of the field. The fields of a *ValidationError are kept as they are.
+func (v *validator) check(field string, err error) {
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		v.fields = append(v.fields, invalid.Fields...)
+	} else if err != nil {
+		v.add(field, err.Error())
+	}
+}
+
+// err returns the errors collected as a *ValidationError, nil when there are none.
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
+
+// invalidField returns err as the error of the field, nil when err is nil.
+func invalidField(field string, err error) error {
+	var v validator
+	v.check(field, err)
+	return v.err()
+}
+
+// invalidRequest answers a request that failed the validation with 422 Unprocessable Entity: the message has
+// every error, and "errors" lists them with their fields. Any other error is answered as an error of the request.
+func invalidRequest(c *gin.Context, err error) {
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		invalid = &ValidationError{Fields: []FieldError{{Message: err.Error()}}}
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"message": invalid.Error(), "errors": invalid.Fields})
+}
+
+// Rules
+
+// validateName checks a name or a surname, the label being what it is, like "name".
+func validateName(label, name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("The %s is required", label)
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return fmt.Errorf("The %s can't be longer than %d characters", label, maxNameLength)
+	}
+	if strings.ContainsFunc(name, unicode.IsControl) {
+		return fmt.Errorf("The %s can't contain control characters", label)
+	}
+	return nil
+}
+
+// validateUsername checks a new username: letters, digits, dots, dashes and underscores only.
+func validateUsername(username string) error {
+	if username == "" {
+		return errors.New("The username is required")
+	}
+	if length := utf8.RuneCountInString(username); length < minUsernameLength || length > maxUsernameLength {
+		return fmt.Errorf("The username needs between %d and %d characters", minUsernameLength, maxUsernameLength)
+	}
+	for _, r := range username {
+		if !isUsernameRune(r) {
+			return errors.New("The username can only contain letters, digits, dots, dashes and underscores")
+		}
+	}
+	return nil
+}
+
+// isUsernameRune checks if the character is allowed in a username.
+func isUsernameRune(r rune) bool {
+	return r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_')
+}
+
+// validateDateOfBirth checks that a date of birth is given and possible at the time.
+func validateDateOfBirth(dateOfBirth, now time.Time) error {
+	if dateOfBirth.IsZero() {
+		return errors.New("The date of birth is required")
+	}
+	if dateOfBirth.After(now) {
+		return errors.New("The date of birth can't be in the future")
+	}
+	if dateOfBirth.Before(minDateOfBirth) {
+		return fmt.Errorf("The date of birth can't be before %d", minDateOfBirth.Year())
+	}
+	return nil
+}
+
+// validateStudent checks a new student, with all the fields of the registration.
+func validateStudent(student Student) error {
+	var v validator
+	v.check("name", validateName("name", student.Name))
+	v.check("surname", validateName("surname", student.Surname))
+	v.check("date_of_birth", validateDateOfBirth(student.DateOfBirth, time.Now()))
+	v.check("username", validateUsername(student.Username))
+	v.check("password", validatePassword(student.Password))
+	if err := validateTimeZone(student.TimeZone); err != nil {
+		v.add("time_zone", fmt.Sprintf("Unknown time zone %q", student.TimeZone))
+	}
+	v.check("email", validateEmail(student.Email))
+	return v.err()
+}
+
+// validateTeacher checks a new teacher. The username is optional, but a teacher with one needs a password
+// to log into the portal.
+func validateTeacher(teacher Teacher) error {
+	var v validator
+	v.check("name", validateName("name", teacher.Name))
+	v.check("surname", validateName("surname", teacher.Surname))
+	if teacher.Username != "" {
+		v.check("username", validateUsername(teacher.Username))
+		v.check("password", validatePassword(teacher.Password))
+	} else if teacher.Password != "" {
+		v.add("username", "The username is required with a password")
+	}
+	if err := validateTimeZone(teacher.TimeZone); err != nil {
+		v.add("time_zone", fmt.Sprintf("Unknown time zone %q", teacher.TimeZone))
+	}
+	v.check("email", validateEmail(teacher.Email))
+	if _, err := normalizeSubjects(teacher.Subjects); err != nil {
+		v.add("subjects", err.Error())
+	}
+	return v.err()
+}
+
+// validateTeacherSubject checks that the teacher teaches the subject. A teacher without subjects teaches
+// any subject, and a missing teacher is left to the store to report.
+func (api *apiServer) validateTeacherSubject(teacherID int, subject string) error {
+	teacher, err := api.store.TeacherByID(teacherID)
+	if err != nil || len(teacher.Subjects) == 0 {
+		return nil
+	}
+	for _, name := range teacher.Subjects {
+		if strings.EqualFold(name, strings.TrimSpace(subject)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s isn't taught by the teacher: choose one of %s", subject, strings.Join(teacher.Subjects, ", "))
+}
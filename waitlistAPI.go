@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"server/models"
+)
+
+// waitlistRequest is the body of POST /api/student/:username/waitlist, shared with the users of the API
+type waitlistRequest = models.WaitlistRequest
+
+// Getters
+
+// getStudentWaitlist retrieves the waitlist entries of a student, waiting or assigned.
+func (api *apiServer) getStudentWaitlist(c *gin.Context) {
+	entries, err := api.store.StudentWaitlist(c.Param("username"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Student not found"})
+		return
+	}
+	if len(entries) == 0 {
+		c.JSON(http.StatusOK, []WaitlistEntry{})
+		return
+	}
+	waitlistIn(entries, api.viewerLocation(c))
+	c.IndentedJSON(http.StatusOK, entries)
+}
+
+// getTeacherWaitlist retrieves the students waiting for a lesson with a teacher, first come first.
+func (api *apiServer) getTeacherWaitlist(c *gin.Context) {
+	teacherID, errID := strconv.Atoi(c.Param("id"))
+	if errID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid teacher ID"})
+		return
+	}
+	entries, err := api.store.TeacherWaitlist(teacherID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No teachers associated with ID %d", teacherID)})
+		return
+	}
+	if len(entries) == 0 {
+		c.JSON(http.StatusOK, []WaitlistEntry{})
+		return
+	}
+	waitlistIn(entries, api.viewerLocation(c))
+	c.IndentedJSON(http.StatusOK, entries)
+}
+
+// Creators
+
+// joinStudentWaitlist puts a student on the waitlist of a teacher, for a booked availability
+// or for any availability of a week.
+func (api *apiServer) joinStudentWaitlist(c *gin.Context) {
+	var request waitlistRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error parsing JSON"})
+		return
+	}
+
+	//the entry is always made for the student in the URL
+	entry := WaitlistEntry{
+		StudentUsername: c.Param("username"),
+		TeacherID:       request.TeacherID,
+		AvailabilityID:  request.AvailabilityID,
+		Subject:         strings.TrimSpace(request.Subject),
+	}
+	var v validator
+	if request.TeacherID <= 0 {
+		v.add("teacher_id", "The teacher is required")
+	}
+	if (request.AvailabilityID == 0) == (request.Week == "") {
+		v.add("availability_id", "Either the availability or the week is required")
+	}
+	if entry.Subject == "" {
+		v.add("subject", "The subject is required")
+	} else if request.TeacherID > 0 {
+		v.check("subject", api.validateTeacherSubject(request.TeacherID, entry.Subject))
+	}
+	loc := api.viewerLocation(c)
+	if request.Week != "" {
+		day, err := time.ParseInLocation("2006-01-02", request.Week, loc)
+		if err != nil {
+			v.add("week", "The week need to be a date in the YYYY-MM-DD format")
+		} else {
+			weekStart := startOfWeek(day)
+			weekEnd := weekStart.AddDate(0, 0, 7)
+			if !weekEnd.After(time.Now()) {
+				v.add("week", "The week is already over")
+			}
+			entry.WeekStart, entry.WeekEnd = &weekStart, &weekEnd
+		}
+	}
+	if err := v.err(); err != nil {
+		invalidRequest(c, err)
+		return
+	}
+
+	entry, err := api.store.InsertWaitlistEntry(entry)
+	switch err.(type) {
+	case nil:
+	case *ErrStudentNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": "Student not found"})
+		return
+	case *ErrTeacherNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("No teachers associated with ID %d", request.TeacherID)})
+		return
+	default:
+		if err == ErrAvailabilityNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		} else if err == ErrAlreadyOnWaitlist || err == ErrAvailabilityNotBooked || err == ErrAvailabilityAlreadyBooked {
+			c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		}
+		return
+	}
+
+	entries := []WaitlistEntry{entry}
+	waitlistIn(entries, loc)
+	c.IndentedJSON(http.StatusCreated, entries[0])
+}
+
+// Deleters
+
+// leaveStudentWaitlist removes a waiting entry of a student from the waitlist.
+func (api *apiServer) leaveStudentWaitlist(c *gin.Context) {
+	entryID, errID := strconv.Atoi(c.Param("entryID"))
+	if errID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid waitlist entry ID"})
+		return
+	}
+	err := api.store.DeleteWaitlistEntry(c.Param("username"), entryID)
+	if err == ErrWaitlistEntryNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error leaving the waitlist"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Waitlist left successfully"})
+}
+
+// Utils
+
+// checkWaitlistAvailability checks that a student can wait for the availability: it needs to be booked,
+// still to start and open to the subject.
+func checkWaitlistAvailability(availability Availability, subject string) error {
+	if !availability.Booked {
+		return ErrAvailabilityNotBooked
+	}
+	if !availability.StartsAt.After(time.Now()) {
+		return errors.New("The lesson has already started")
+	}
+	if !isSubjectAllowed(availability, subject) {
+		return fmt.Errorf("This availability is reserved for %s lessons", availability.Subject)
+	}
+	return nil
+}
+
+// startOfWeek returns midnight of the Monday of the week of the day, in its zone.
+func startOfWeek(day time.Time) time.Time {
+	daysSinceMonday := (int(day.Weekday()) + 6) % 7
+	return time.Date(day.Year(), day.Month(), day.Day()-daysSinceMonday, 0, 0, 0, 0, day.Location())
+}
+
+// waitlistIn converts the times of the waitlist entries to the zone.
+func waitlistIn(entries []WaitlistEntry, loc *time.Location) {
+	for i := range entries {
+		entries[i].CreatedAt = entries[i].CreatedAt.In(loc)
+		if entries[i].StartsAt != nil {
+			startsAt := entries[i].StartsAt.In(loc)
+			entries[i].StartsAt = &startsAt
+		}
+		if entries[i].WeekStart != nil && entries[i].WeekEnd != nil {
+			weekStart, weekEnd := entries[i].WeekStart.In(loc), entries[i].WeekEnd.In(loc)
+			entries[i].WeekStart, entries[i].WeekEnd = &weekStart, &weekEnd
+		}
+	}
+}